@@ -6,20 +6,42 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"math"
 	"strings"
+	"sync"
 
 	moov "github.com/moov-io/go-client/client"
 
 	"github.com/antihax/optional"
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	flagMicroDepositMinBalance = flag.Float64("micro-deposits.min-balance", 100, "Lowest balance (in USD) of the micro-deposit origination account before it's topped up")
+	flagMicroDepositTopUp      = flag.Float64("micro-deposits.top-up", 1000, "Amount (in USD) added to the micro-deposit origination account when it's below -micro-deposits.min-balance, 0 fails the run instead")
+
+	// microDepositBalanceMu serializes balance checks so concurrent iterations only top up once
+	microDepositBalanceMu sync.Mutex
+
+	microDepositAccountBalance = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Name: "apitest_micro_deposit_account_balance",
+		Help: "Balance (in USD) of the micro-deposit origination account",
+	}, nil)
 )
 
 func createAccount(ctx context.Context, api *moov.APIClient, u *user, name, number string) (*moov.Account, error) {
+	return createAccountOfType(ctx, api, u, name, number, "Savings")
+}
+
+func createAccountOfType(ctx context.Context, api *moov.APIClient, u *user, name, number, accountType string) (*moov.Account, error) {
 	req := moov.CreateAccount{
 		CustomerID: u.ID,
 		Name:       name,
 		Number:     number,
-		Type:       "Savings",
+		Type:       accountType,
 		Balance:    1000 * 100, // $1,000
 	}
 	opts := &moov.CreateAccountOpts{}
@@ -37,14 +59,12 @@ func createAccount(ctx context.Context, api *moov.APIClient, u *user, name, numb
 }
 
 func createMicroDepositAccount(ctx context.Context, api *moov.APIClient, u *user) (*moov.Account, error) {
-	// The hardcoded values here need to match paygate's expectations for the micro-deposit origination account
-	//
-	// TODO(adam): We need to do something about micro-deposit buildup that slowly depletes this account balance.
-	// It causes problems eventually as the balance runs too low for any further micro-deposits (apitest runs).
+	// These values need to match paygate's expectations for the micro-deposit origination account
+	odfi := microDepositOrigination
 	opts := &moov.SearchAccountsOpts{
-		Number:        optional.NewString("123"),
-		RoutingNumber: optional.NewString("121042882"),
-		Type_:         optional.NewString("Savings"),
+		Number:        optional.NewString(odfi.AccountNumber),
+		RoutingNumber: optional.NewString(odfi.RoutingNumber),
+		Type_:         optional.NewString(odfi.AccountType),
 	}
 	accounts, resp, err := api.AccountsApi.SearchAccounts(ctx, u.ID, opts)
 	if resp != nil && resp.Body != nil {
@@ -59,11 +79,88 @@ func createMicroDepositAccount(ctx context.Context, api *moov.APIClient, u *user
 	if len(accounts) > 0 {
 		return &accounts[0], nil
 	}
-	return createAccount(ctx, api, u, "micro-deposit origination", "123")
+	return createAccountOfType(ctx, api, u, "micro-deposit origination", odfi.AccountNumber, odfi.AccountType)
 }
 
-// Verify accountID and Transaction exist of a given amount (used to double check transfers).
-func checkTransactions(ctx context.Context, api *moov.APIClient, accountID string, u *user, amount string) error {
+// checkMicroDepositBalance tops up the micro-deposit origination account once its balance drops below
+// -micro-deposits.min-balance, as every micro-deposit slowly drains it. The account's balance is returned.
+func checkMicroDepositBalance(ctx context.Context, iter *iteration, acct *moov.Account) (int32, error) {
+	microDepositBalanceMu.Lock()
+	defer microDepositBalanceMu.Unlock()
+
+	minBalance := dollarsToCents(*flagMicroDepositMinBalance)
+	if acct.Balance >= minBalance {
+		microDepositAccountBalance.Set(float64(acct.Balance) / 100)
+		return acct.Balance, nil
+	}
+	// Another iteration could have topped up the account since it was read
+	current, err := createMicroDepositAccount(ctx, iter.api, iter.user)
+	if err != nil {
+		return 0, err
+	}
+	balance := current.Balance
+	if balance < minBalance {
+		topUp := dollarsToCents(*flagMicroDepositTopUp)
+		if topUp > 0 && balance+topUp < minBalance {
+			topUp = minBalance - balance // a single top-up needs to be enough
+		}
+		if topUp <= 0 {
+			microDepositAccountBalance.Set(float64(balance) / 100)
+			return balance, fmt.Errorf("micro-deposit account %s balance is USD %.2f, below -micro-deposits.min-balance of USD %.2f: add funds to the account or set -micro-deposits.top-up",
+				current.ID, float64(balance)/100, *flagMicroDepositMinBalance)
+		}
+		if err := topUpMicroDepositAccount(ctx, iter, current, topUp); err != nil {
+			return balance, err
+		}
+		balance += topUp
+	}
+	microDepositAccountBalance.Set(float64(balance) / 100)
+	return balance, nil
+}
+
+// topUpMicroDepositAccount posts a balancing transaction which moves amount (in cents) from a new
+// funding account into the micro-deposit origination account.
+func topUpMicroDepositAccount(ctx context.Context, iter *iteration, acct *moov.Account, amount int32) error {
+	funding, resp, err := iter.api.AccountsApi.CreateAccount(ctx, iter.user.ID, moov.CreateAccount{
+		CustomerID: iter.user.ID,
+		Name:       "micro-deposit funding",
+		Type:       "Savings",
+		Balance:    amount,
+	}, nil)
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("problem creating micro-deposit funding account: %v", err)
+	}
+	iter.track("account", funding.ID, nil)
+
+	req := moov.CreateTransaction{
+		Lines: []moov.TransactionLine{
+			{AccountID: acct.ID, Purpose: "ACHCredit", Amount: float32(amount)},
+			{AccountID: funding.ID, Purpose: "ACHDebit", Amount: float32(amount)},
+		},
+	}
+	_, resp, err = iter.api.AccountsApi.CreateTransaction(ctx, iter.user.ID, req, nil)
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+		if err := checkCORSHeaders(resp); err != nil {
+			return fmt.Errorf("top up micro-deposit account: %v", err)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("problem topping up micro-deposit account %s: %v", acct.ID, err)
+	}
+	return nil
+}
+
+func dollarsToCents(amount float64) int32 {
+	return int32(math.Round(amount * 100))
+}
+
+// Verify accountID and Transaction exist of a given amount and purpose (used to double check transfers).
+// The purpose is ACHCredit or ACHDebit depending on which direction the transfer moved money for accountID.
+func checkTransactions(ctx context.Context, api *moov.APIClient, accountID string, u *user, amount, purpose string) error {
 	opts := &moov.GetAccountTransactionsOpts{
 		Limit: optional.NewFloat32(25),
 	}
@@ -81,12 +178,15 @@ func checkTransactions(ctx context.Context, api *moov.APIClient, accountID strin
 		for j := range transactions[i].Lines {
 			// match transaction against posted ones on the account
 			line := transactions[i].Lines[j]
-			if v := fmt.Sprintf("USD %.2f", float32(line.Amount)/100.0); line.AccountID == accountID && v == amount {
+			if line.AccountID != accountID || !strings.EqualFold(line.Purpose, purpose) {
+				continue
+			}
+			if v := fmt.Sprintf("USD %.2f", float32(line.Amount)/100.0); v == amount {
 				return nil // Matched Transaction
 			}
 		}
 	}
-	return fmt.Errorf("accounts: unable to find %q transaction for account=%s", amount, accountID)
+	return fmt.Errorf("accounts: unable to find %q %s transaction for account=%s", amount, purpose, accountID)
 }
 
 func getMicroDepositsTransactions(ctx context.Context, api *moov.APIClient, accountID string, u *user) ([]*moov.Transaction, error) {
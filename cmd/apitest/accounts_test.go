@@ -0,0 +1,127 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+func TestAccounts__checkTransactions(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]moov.Transaction{
+			{
+				ID: "transaction",
+				Lines: []moov.TransactionLine{
+					{AccountID: "orig", Purpose: "ACHCredit", Amount: 1234},
+					{AccountID: "rec", Purpose: "ACHDebit", Amount: 1234},
+				},
+			},
+		})
+	}))
+	defer svc.Close()
+
+	conf := moov.NewConfiguration()
+	conf.BasePath = svc.URL
+	api := moov.NewAPIClient(conf)
+	u := &user{ID: "userID"}
+
+	ctx := context.Background()
+
+	// a pull transfer credits the originator and debits the receiver
+	if err := checkTransactions(ctx, api, "orig", u, "USD 12.34", "ACHCredit"); err != nil {
+		t.Error(err)
+	}
+	if err := checkTransactions(ctx, api, "rec", u, "USD 12.34", "achdebit"); err != nil {
+		t.Error(err)
+	}
+
+	// wrong direction or amount
+	if err := checkTransactions(ctx, api, "orig", u, "USD 12.34", "ACHDebit"); err == nil {
+		t.Error("expected error")
+	}
+	if err := checkTransactions(ctx, api, "rec", u, "USD 1.00", "ACHDebit"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestAccounts__checkMicroDepositBalance(t *testing.T) {
+	balance := int32(50 * 100)
+	var transactions []moov.CreateTransaction
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/accounts/search":
+			json.NewEncoder(w).Encode([]moov.Account{{ID: "micro-deposits", Balance: balance}})
+		case "/v1/accounts":
+			json.NewEncoder(w).Encode(moov.Account{ID: "funding"})
+		case "/v1/accounts/transactions":
+			var req moov.CreateTransaction
+			json.NewDecoder(r.Body).Decode(&req)
+			transactions = append(transactions, req)
+			json.NewEncoder(w).Encode(moov.Transaction{ID: "transaction", Lines: req.Lines})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer svc.Close()
+
+	conf := moov.NewConfiguration()
+	conf.BasePath = svc.URL
+	iter := &iteration{
+		requestID: "reqID",
+		api:       moov.NewAPIClient(conf),
+		user:      &user{ID: "userID"},
+	}
+
+	defer func(cleanup bool) { *flagCleanup = cleanup }(*flagCleanup)
+	*flagCleanup = true
+	defer resources.drain()
+
+	ctx := context.Background()
+	acct := &moov.Account{ID: "micro-deposits", Balance: balance}
+
+	// above -micro-deposits.min-balance
+	if v, err := checkMicroDepositBalance(ctx, iter, &moov.Account{ID: "micro-deposits", Balance: 200 * 100}); err != nil || v != 200*100 {
+		t.Errorf("balance=%d error=%v", v, err)
+	}
+	if len(transactions) != 0 {
+		t.Errorf("unexpected transactions: %#v", transactions)
+	}
+
+	// topped up
+	v, err := checkMicroDepositBalance(ctx, iter, acct)
+	if err != nil || v != 1050*100 {
+		t.Errorf("balance=%d error=%v", v, err)
+	}
+	if len(transactions) != 1 {
+		t.Fatalf("unexpected transactions: %#v", transactions)
+	}
+	lines := transactions[0].Lines
+	if len(lines) != 2 || lines[0].AccountID != "micro-deposits" || lines[0].Purpose != "ACHCredit" || lines[1].AccountID != "funding" || lines[0].Amount != 1000*100 {
+		t.Errorf("unexpected lines: %#v", lines)
+	}
+	if created := resources.drain(); len(created) != 1 || created[0].kind != "account" || created[0].id != "funding" {
+		t.Errorf("funding account wasn't tracked: %#v", created)
+	}
+
+	// top ups are disabled
+	*flagMicroDepositTopUp = 0
+	defer func() { *flagMicroDepositTopUp = 1000 }()
+	if _, err := checkMicroDepositBalance(ctx, iter, acct); err == nil || !strings.Contains(err.Error(), "below -micro-deposits.min-balance") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
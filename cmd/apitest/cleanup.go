@@ -0,0 +1,151 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+var (
+	// resources holds every object created with -cleanup so they can be deleted after a run.
+	resources = &resourceTracker{}
+)
+
+// resource is an object created in the Moov API by apitest.
+type resource struct {
+	kind      string
+	id        string
+	requestID string
+
+	// remove deletes the resource, it's nil when the Moov API has no way to delete it.
+	remove func(ctx context.Context) (*http.Response, error)
+}
+
+// resourceTracker records created objects in order. Everything is created after what it depends
+// on, so deleting in reverse order never removes an object which is still referenced.
+type resourceTracker struct {
+	mu      sync.Mutex
+	created []resource
+}
+
+func (rt *resourceTracker) add(r resource) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.created = append(rt.created, r)
+}
+
+// drain returns every tracked resource, most recently created first, and resets the tracker.
+func (rt *resourceTracker) drain() []resource {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	out := make([]resource, len(rt.created))
+	for i := range rt.created {
+		out[len(rt.created)-1-i] = rt.created[i]
+	}
+	rt.created = nil
+	return out
+}
+
+// track records an object this iteration created for deletion with -cleanup.
+func (iter *iteration) track(kind, id string, remove func(ctx context.Context) (*http.Response, error)) {
+	if !*flagCleanup || id == "" {
+		return
+	}
+	resources.add(resource{
+		kind:      kind,
+		id:        id,
+		requestID: iter.requestID,
+		remove:    remove,
+	})
+}
+
+func (iter *iteration) trackDepository(dep moov.Depository) {
+	iter.track("depository", dep.ID, func(ctx context.Context) (*http.Response, error) {
+		return iter.api.DepositoriesApi.DeleteDepository(ctx, dep.ID, iter.userID, nil)
+	})
+}
+
+// cleanupResources deletes everything tracked so far in reverse order. Objects which failed to delete, or can't
+// be deleted through the Moov API, are logged so they can be removed by hand.
+func cleanupResources() {
+	if !*flagCleanup {
+		return
+	}
+	created := resources.drain()
+	if len(created) == 0 {
+		return
+	}
+	log.Printf("INFO: cleaning up %d created resources", len(created))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	removed, failed := 0, 0
+	leftover := make(map[string]int)
+	for _, r := range created {
+		if r.remove == nil {
+			leftover[r.kind]++
+			continue
+		}
+		err := testReport.record("cleanup", fmt.Sprintf("delete-%s", r.kind), r.requestID, func() error {
+			return removeResource(ctx, r)
+		})
+		if err != nil {
+			failed++
+			log.Printf("ERROR: unable to remove %s %s: %v", r.kind, r.id, err)
+			continue
+		}
+		removed++
+	}
+
+	if failed > 0 {
+		log.Printf("FAILURE: removed %d resources, %d could not be removed", removed, failed)
+	} else {
+		log.Printf("SUCCESS: removed %d resources", removed)
+	}
+	if len(leftover) > 0 {
+		var kinds []string
+		for kind, n := range leftover {
+			kinds = append(kinds, fmt.Sprintf("%s=%d", kind, n))
+		}
+		sort.Strings(kinds)
+		log.Printf("INFO: left behind resources the Moov API has no way to delete: %s", strings.Join(kinds, ", "))
+	}
+}
+
+// cleanupOnInterrupt deletes tracked resources and exits once apitest is interrupted.
+func cleanupOnInterrupt() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	sig := <-sigs
+	log.Printf("INFO: received %v, cleaning up", sig)
+	cleanupResources()
+	fatalf("FAILURE: interrupted by %v", sig)
+}
+
+func removeResource(ctx context.Context, r resource) error {
+	resp, err := r.remove(ctx)
+	if resp != nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil // already removed
+		}
+	}
+	return err
+}
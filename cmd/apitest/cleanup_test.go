@@ -0,0 +1,64 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCleanup__reverseOrder(t *testing.T) {
+	defer func(cleanup bool) { *flagCleanup = cleanup }(*flagCleanup)
+	*flagCleanup = true
+
+	var removed []string
+	remover := func(id string, status int, err error) func(context.Context) (*http.Response, error) {
+		return func(ctx context.Context) (*http.Response, error) {
+			removed = append(removed, id)
+			return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader(""))}, err
+		}
+	}
+
+	iter := &iteration{requestID: "reqID"}
+	iter.track("user", "user", nil)
+	iter.track("depository", "dep", remover("dep", http.StatusOK, nil))
+	iter.track("originator", "orig", remover("orig", http.StatusNotFound, errors.New("not found")))
+	iter.track("transfer", "transfer", remover("transfer", http.StatusBadRequest, errors.New("transfer is not pending")))
+	iter.track("receiver", "", nil) // not created
+
+	created := resources.drain()
+	if len(created) != 4 || created[0].id != "transfer" || created[3].id != "user" {
+		t.Errorf("unexpected resources: %#v", created)
+	}
+	for i := range created {
+		resources.add(created[len(created)-1-i])
+	}
+
+	cleanupResources()
+	if strings.Join(removed, ",") != "transfer,orig,dep" {
+		t.Errorf("removed in wrong order: %v", removed)
+	}
+	if n := len(resources.drain()); n != 0 {
+		t.Errorf("%d resources left in tracker", n)
+	}
+
+	// only the transfer should have failed
+	failed := 0
+	for _, tc := range testReport.cases {
+		if tc.Suite == "cleanup" && tc.failed() {
+			failed++
+			if tc.Name != "delete-transfer" {
+				t.Errorf("unexpected failure: %#v", tc)
+			}
+		}
+	}
+	if failed != 1 {
+		t.Errorf("got %d failed deletes", failed)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	flagConformance = flag.Bool("conformance", false, "Check every Moov API response echoes its X-Request-ID and every 4xx response has a JSON error message")
+
+	// conformance collects how responses break the README's API requirements, it's nil unless -conformance is set.
+	conformance *conformanceChecker
+)
+
+// conformanceChecker groups requirement violations by the endpoint which returned them.
+type conformanceChecker struct {
+	// suite names the checks in the report and requirements describes them in errors and logs
+	suite        string
+	requirements string
+
+	mu        sync.Mutex
+	endpoints map[string]*endpointConformance
+}
+
+type endpointConformance struct {
+	requests int
+	failed   int
+
+	// violations are unique, as each request to an endpoint usually fails the same way
+	violations []string
+}
+
+func newConformanceChecker(suite, requirements string) *conformanceChecker {
+	return &conformanceChecker{
+		suite:        suite,
+		requirements: requirements,
+		endpoints:    make(map[string]*endpointConformance),
+	}
+}
+
+func (c *conformanceChecker) add(endpoint string, violations []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ep, exists := c.endpoints[endpoint]
+	if !exists {
+		ep = &endpointConformance{}
+		c.endpoints[endpoint] = ep
+	}
+	ep.requests++
+	if len(violations) > 0 {
+		ep.failed++
+	}
+	for _, v := range violations {
+		if !containsString(ep.violations, v) {
+			ep.violations = append(ep.violations, v)
+		}
+	}
+}
+
+// report adds a test case for every endpoint seen since the last report and returns an error listing
+// each endpoint with violations.
+func (c *conformanceChecker) report(requestID string) error {
+	c.mu.Lock()
+	endpoints := c.endpoints
+	c.endpoints = make(map[string]*endpointConformance)
+	c.mu.Unlock()
+
+	var names []string
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var failures []string
+	for _, name := range names {
+		ep := endpoints[name]
+		err := testReport.record(c.suite, name, requestID, func() error {
+			if ep.failed == 0 {
+				return nil
+			}
+			return fmt.Errorf("%d of %d responses: %s", ep.failed, ep.requests, strings.Join(ep.violations, "; "))
+		})
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d endpoints don't meet %s:\n  %s", len(failures), len(names), c.requirements, strings.Join(failures, "\n  "))
+	}
+	log.Printf("INFO: %d endpoints meet %s", len(names), c.requirements)
+	return nil
+}
+
+// wrap returns a transport which checks every response from underlying meets the API requirements.
+func (c *conformanceChecker) wrap(underlying http.RoundTripper) http.RoundTripper {
+	if underlying == nil {
+		underlying = http.DefaultTransport
+	}
+	return &conformanceTransport{
+		underlying: underlying,
+		checker:    c,
+	}
+}
+
+type conformanceTransport struct {
+	underlying http.RoundTripper
+	checker    *conformanceChecker
+}
+
+func (t *conformanceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := endpointName(req.Method, req.URL.Path) // -local rewrites the request's path
+	resp, err := t.underlying.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	violations, err := checkConformance(req, resp)
+	if err != nil {
+		return resp, err
+	}
+	t.checker.add(endpoint, violations)
+	return resp, nil
+}
+
+// checkConformance returns how resp breaks the API requirements. The body of 4xx responses is read
+// and then replaced so callers can still decode it.
+func checkConformance(req *http.Request, resp *http.Response) ([]string, error) {
+	var violations []string
+	if sent := req.Header.Get("X-Request-ID"); sent != "" {
+		if echoed := resp.Header.Get("X-Request-ID"); echoed != sent {
+			violations = append(violations, fmt.Sprintf("X-Request-ID wasn't echoed (got %q)", echoed))
+		}
+	}
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		bs, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("problem reading %s response: %v", resp.Status, err)
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(bs))
+
+		if errorMessage(bs) == "" {
+			violations = append(violations, fmt.Sprintf("HTTP %d response has no JSON error message", resp.StatusCode))
+		}
+	}
+	return violations, nil
+}
+
+// errorMessage returns the error field of a JSON response body.
+func errorMessage(body []byte) string {
+	var wrapper struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &wrapper); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(wrapper.Error)
+}
+
+// endpointName returns the operation for a request, or its route from authProtectedRoutes so
+// requests for different IDs are grouped together.
+func endpointName(method, path string) string {
+	if service, name := findOperation(method, path); service != "unknown" {
+		return fmt.Sprintf("%s.%s", service, name)
+	}
+	if route := findRoute(authProtectedRoutes, path); route != "" {
+		return fmt.Sprintf("%s %s", method, route)
+	}
+	return fmt.Sprintf("%s %s", method, path)
+}
+
+// findRoute returns the route (e.g. /v1/ach/files/{fileID}) which matches path with the fewest path parameters.
+func findRoute(routes []string, path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	best, bestParams := "", 0
+	for _, route := range routes {
+		parts := strings.Split(strings.Trim(route, "/"), "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		params := 0
+		for i := range parts {
+			if strings.HasPrefix(parts[i], "{") {
+				params++
+			} else if parts[i] != segments[i] {
+				params = -1
+				break
+			}
+		}
+		if params >= 0 && (best == "" || params < bestParams) {
+			best, bestParams = route, params
+		}
+	}
+	return best
+}
+
+func containsString(values []string, s string) bool {
+	for i := range values {
+		if values[i] == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConformance__transport(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/ach/depositories":
+			w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "missing routing number"}`))
+		case "/v1/ach/originators":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("404 page not found"))
+		default:
+			w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+			w.Write([]byte("{}"))
+		}
+	}))
+	defer svc.Close()
+
+	checker := newConformanceChecker("conformance", "the API requirements")
+	client := &http.Client{Transport: checker.wrap(nil)}
+	for _, path := range []string{"/v1/ach/depositories", "/v1/ach/originators", "/v1/ach/originators", "/v1/ach/files/abc"} {
+		req, _ := http.NewRequest("GET", svc.URL+path, nil)
+		req.Header.Set("X-Request-ID", "request")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 4xx bodies can still be read by the caller
+		bs, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if len(bs) == 0 {
+			t.Errorf("%s: empty body", path)
+		}
+	}
+
+	err := checker.report("request")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, expected := range []string{
+		"1 of 3 endpoints",
+		`paygate.GetOriginators: 2 of 2 responses: X-Request-ID wasn't echoed (got ""); HTTP 404 response has no JSON error message`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("missing %q: %v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "GetDepositories") || strings.Contains(err.Error(), "/v1/ach/files/{fileID}") {
+		t.Errorf("unexpected failure: %v", err)
+	}
+
+	// endpoints are reset after each report
+	if err := checker.report("request"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConformance__endpointName(t *testing.T) {
+	cases := map[string]string{
+		"/v1/ach/depositories":             "paygate.GetDepositories",
+		"/v1/ach/files/abc/batches/def":    "GET /v1/ach/files/{fileID}/batches/{batchID}",
+		"/v1/watchman/companies/watch/abc": "GET /v1/watchman/companies/watch/{watchID}",
+		"/v1/watchman/companies/abc/watch": "GET /v1/watchman/companies/{companyID}/watch",
+		"/v1/other/path":                   "GET /v1/other/path",
+	}
+	for path, expected := range cases {
+		if name := endpointName("GET", path); name != expected {
+			t.Errorf("%s: got %q, expected %q", path, name, expected)
+		}
+	}
+}
+
+func TestConformance__errorMessage(t *testing.T) {
+	if msg := errorMessage([]byte(`{"error": " bad request "}`)); msg != "bad request" {
+		t.Errorf("unexpected message: %q", msg)
+	}
+	for _, body := range []string{"", "bad request", `{"error": ""}`, `{"message": "bad request"}`} {
+		if msg := errorMessage([]byte(body)); msg != "" {
+			t.Errorf("%q: unexpected message: %q", body, msg)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/moov-io/base"
+
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	flagDaemon   = flag.Bool("daemon", false, "Run scenarios on a schedule forever as a canary, see -interval")
+	flagInterval = flag.Duration("interval", 5*time.Minute, "How often to run scenarios with -daemon")
+
+	// daemon tracks the outcome of each scheduled run for /status and metrics.
+	daemon = &daemonStatus{}
+
+	daemonRuns = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Name: "apitest_runs",
+		Help: "Counter of scheduled apitest runs by result",
+	}, []string{"result"})
+
+	daemonLastRunSuccess = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Name: "apitest_last_run_success",
+		Help: "1 if the last scheduled apitest run passed, 0 otherwise",
+	}, nil)
+
+	daemonLastRunTimestamp = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Name: "apitest_last_run_timestamp_seconds",
+		Help: "Unix timestamp of when the last scheduled apitest run finished",
+	}, nil)
+
+	daemonLastRunDuration = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Name: "apitest_last_run_duration_seconds",
+		Help: "How long the last scheduled apitest run took",
+	}, nil)
+
+	daemonLastSuccessTimestamp = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Name: "apitest_last_success_timestamp_seconds",
+		Help: "Unix timestamp of when the last passing scheduled apitest run finished",
+	}, nil)
+)
+
+func validateDaemonFlags() error {
+	if !*flagDaemon {
+		return nil
+	}
+	if *flagPing || *flagLoad || *flagPauseAfterTransfers {
+		return errors.New("-daemon cannot be used with -ping, -load or -pause")
+	}
+	if *flagInterval <= 0 {
+		return fmt.Errorf("invalid -interval=%v", *flagInterval)
+	}
+	return nil
+}
+
+// daemonStatus is the state of scheduled runs, which is served as JSON on /status.
+type daemonStatus struct {
+	mu sync.RWMutex
+
+	runs        int
+	failures    int
+	last        *runStatus
+	lastSuccess time.Time
+	next        time.Time
+}
+
+type runStatus struct {
+	RequestID  string        `json:"requestID"`
+	Started    time.Time     `json:"started"`
+	Duration   time.Duration `json:"duration"`
+	Iterations int           `json:"iterations"`
+	Failed     int           `json:"failed"`
+	Error      string        `json:"error,omitempty"`
+}
+
+func (rs *runStatus) passed() bool {
+	return rs.Error == ""
+}
+
+func (ds *daemonStatus) record(rs *runStatus) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	finished := rs.Started.Add(rs.Duration)
+	ds.runs++
+	ds.last = rs
+	if rs.passed() {
+		ds.lastSuccess = finished
+		daemonRuns.With("result", "success").Add(1)
+		daemonLastRunSuccess.Set(1)
+		daemonLastSuccessTimestamp.Set(float64(finished.Unix()))
+	} else {
+		ds.failures++
+		daemonRuns.With("result", "failure").Add(1)
+		daemonLastRunSuccess.Set(0)
+	}
+	daemonLastRunTimestamp.Set(float64(finished.Unix()))
+	daemonLastRunDuration.Set(rs.Duration.Seconds())
+}
+
+func (ds *daemonStatus) scheduled(next time.Time) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.next = next
+}
+
+// handleStatus responds with the last run's outcome and age. A 503 is returned after a failed run so
+// the endpoint can be checked directly by uptime monitors.
+func (ds *daemonStatus) handleStatus(w http.ResponseWriter, r *http.Request) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	status := struct {
+		Healthy     bool       `json:"healthy"`
+		Interval    string     `json:"interval"`
+		Runs        int        `json:"runs"`
+		Failures    int        `json:"failures"`
+		LastRun     *runStatus `json:"lastRun,omitempty"`
+		LastRunAge  string     `json:"lastRunAge,omitempty"`
+		LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+		NextRun     *time.Time `json:"nextRun,omitempty"`
+	}{
+		Healthy:  ds.last == nil || ds.last.passed(),
+		Interval: flagInterval.String(),
+		Runs:     ds.runs,
+		Failures: ds.failures,
+		LastRun:  ds.last,
+	}
+	if ds.last != nil {
+		status.LastRunAge = time.Since(ds.last.Started.Add(ds.last.Duration)).Truncate(time.Second).String()
+	}
+	if !ds.lastSuccess.IsZero() {
+		status.LastSuccess = &ds.lastSuccess
+	}
+	if !ds.next.IsZero() {
+		status.NextRun = &ds.next
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if !status.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// runDaemon runs the selected scenarios every -interval until apitest is stopped. Failed runs are
+// logged and recorded, but never stop the daemon.
+func runDaemon(ctx context.Context, selected []*scenario) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		select {
+		case sig := <-sigs:
+			log.Printf("INFO: received %v, shutting down", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	log.Printf("INFO: running scenarios every %v", *flagInterval)
+
+	ticker := time.NewTicker(*flagInterval)
+	defer ticker.Stop()
+	for {
+		// Only keep the current run in our report, otherwise it grows forever
+		testReport.reset()
+
+		rs := runScheduled(ctx, base.ID(), selected)
+		daemon.record(rs)
+		if rs.passed() {
+			log.Printf("SUCCESS: scheduled run %s passed in %v", rs.RequestID, rs.Duration)
+		} else {
+			log.Printf("FAILURE: scheduled run %s: %s", rs.RequestID, rs.Error)
+		}
+		if err := writeReport(); err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+
+		daemon.scheduled(time.Now().Add(*flagInterval))
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runScheduled pings each application and then runs the selected scenarios once.
+func runScheduled(ctx context.Context, requestID string, selected []*scenario) (rs *runStatus) {
+	rs = &runStatus{
+		RequestID: requestID,
+		Started:   time.Now(),
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			rs.Error = fmt.Sprintf("panic: %v", v)
+		}
+		rs.Duration = time.Since(rs.Started)
+	}()
+
+	if err := pingApps(ctx, requestID); err != nil {
+		rs.Error = err.Error()
+		return rs
+	}
+	defer cleanupResources()
+
+	iterations, failed, err := run(ctx, requestID, selected)
+	rs.Iterations, rs.Failed = len(iterations)+failed, failed
+	switch {
+	case err != nil:
+		rs.Error = err.Error()
+	case failed > 0:
+		rs.Error = fmt.Sprintf("%d of %d iterations failed", failed, rs.Iterations)
+	}
+	return rs
+}
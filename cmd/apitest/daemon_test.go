@@ -0,0 +1,76 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDaemon__status(t *testing.T) {
+	ds := &daemonStatus{}
+
+	var status struct {
+		Healthy     bool       `json:"healthy"`
+		Runs        int        `json:"runs"`
+		Failures    int        `json:"failures"`
+		LastRun     *runStatus `json:"lastRun"`
+		LastSuccess *time.Time `json:"lastSuccess"`
+	}
+	check := func(code int) {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		ds.handleStatus(w, httptest.NewRequest("GET", "/status", nil))
+		w.Flush()
+
+		if w.Code != code {
+			t.Errorf("got HTTP %d", w.Code)
+		}
+		if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// nothing has ran yet
+	check(http.StatusOK)
+	if !status.Healthy || status.Runs != 0 || status.LastRun != nil {
+		t.Errorf("unexpected status: %#v", status)
+	}
+
+	ds.record(&runStatus{RequestID: "a", Started: time.Now(), Duration: time.Second, Iterations: 1})
+	check(http.StatusOK)
+	if !status.Healthy || status.Runs != 1 || status.LastSuccess == nil {
+		t.Errorf("unexpected status: %#v", status)
+	}
+
+	ds.record(&runStatus{RequestID: "b", Started: time.Now(), Iterations: 1, Failed: 1, Error: "1 of 1 iterations failed"})
+	check(http.StatusServiceUnavailable)
+	if status.Healthy || status.Runs != 2 || status.Failures != 1 || status.LastRun.RequestID != "b" {
+		t.Errorf("unexpected status: %#v", status)
+	}
+}
+
+func TestDaemon__validateFlags(t *testing.T) {
+	defer func(daemon, ping bool, interval time.Duration) {
+		*flagDaemon, *flagPing, *flagInterval = daemon, ping, interval
+	}(*flagDaemon, *flagPing, *flagInterval)
+
+	*flagDaemon = true
+	if err := validateDaemonFlags(); err != nil {
+		t.Error(err)
+	}
+	*flagPing = true
+	if err := validateDaemonFlags(); err == nil {
+		t.Error("expected error with -ping")
+	}
+	*flagPing, *flagInterval = false, 0
+	if err := validateDaemonFlags(); err == nil {
+		t.Error("expected error with -interval=0")
+	}
+}
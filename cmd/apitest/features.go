@@ -14,7 +14,7 @@ type featureFlags struct {
 }
 
 func grabPaygateFeatures(flagLocal *bool, paygateAdminAddress string, httpClient *http.Client) (*featureFlags, error) {
-	if !*flagLocal && !*flagLocalDev {
+	if !*flagLocal && !*flagLocalDev && !*flagMock {
 		return &featureFlags{
 			AccountsCallsDisabled:  true,
 			CustomersCallsDisabled: true,
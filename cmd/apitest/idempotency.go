@@ -0,0 +1,364 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/moov-io/ach"
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/antihax/optional"
+)
+
+func init() {
+	registerScenario(&scenario{
+		name: "idempotency",
+		steps: []*step{
+			featuresStep,
+			userStep,
+			oauthStep,
+			microDepositAccountStep,
+			originatorStep,
+			receiverStep,
+			idempotencyStep,
+		},
+	})
+}
+
+var (
+	// idempotencyStep replays each mutating request apitest makes with the same X-Idempotency-Key,
+	// as every POST, PUT and PATCH endpoint must support it.
+	idempotencyStep = &step{
+		name:      "idempotency",
+		dependsOn: []string{"originator", "receiver"},
+		run: func(ctx context.Context, iter *iteration) error {
+			// The generated client reads and closes response bodies, so keep a copy to compare replays with
+			tr := iter.conf.HTTPClient.Transport
+			iter.conf.HTTPClient.Transport = &recordingTransport{underlying: tr}
+			defer func() { iter.conf.HTTPClient.Transport = tr }()
+
+			for _, r := range idempotentReplays(ctx, iter) {
+				if err := checkReplay(ctx, iter, r); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+)
+
+// idempotentReplay is a mutating request which is sent twice with the same X-Idempotency-Key.
+type idempotentReplay struct {
+	name string
+
+	// call makes the request and returns the ID of what was created, if the response has one
+	call func(ctx context.Context, key string) (string, *http.Response, error)
+
+	// track records the created object for -cleanup
+	track func(id string)
+
+	// count returns how many objects exist. The first request should add created objects to it and the
+	// replay none.
+	count   func(ctx context.Context) (int, error)
+	created int
+}
+
+// volatileReplayHeaders are response headers which can differ between a request and its replay.
+var volatileReplayHeaders = map[string]bool{
+	"Date":         true,
+	"Set-Cookie":   true,
+	"X-Request-Id": true,
+}
+
+// checkReplay sends r twice and expects the same response and object back, without creating a duplicate.
+// Replays must have the same status, headers (besides volatileReplayHeaders) and body as the first response.
+func checkReplay(ctx context.Context, iter *iteration, r idempotentReplay) error {
+	before := 0
+	if r.count != nil {
+		n, err := r.count(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %v", r.name, err)
+		}
+		before = n
+	}
+
+	key := generateID()
+	firstID, first, err := r.call(ctx, key)
+	if err != nil {
+		return fmt.Errorf("%s: %v", r.name, err)
+	}
+	if r.track != nil {
+		r.track(firstID)
+	}
+	secondID, second, err := r.call(ctx, key)
+	if err != nil {
+		return fmt.Errorf("%s: replay with X-Idempotency-Key %s: %v", r.name, key, err)
+	}
+	if first.StatusCode != second.StatusCode {
+		return fmt.Errorf("%s: replay returned HTTP status %s, first request returned %s", r.name, second.Status, first.Status)
+	}
+	if firstID != secondID {
+		return fmt.Errorf("%s: replay returned %s, first request created %s", r.name, secondID, firstID)
+	}
+	if err := compareReplayHeaders(first.Header, second.Header); err != nil {
+		return fmt.Errorf("%s: %v", r.name, err)
+	}
+	if a, b := recordedBody(first), recordedBody(second); !bytes.Equal(a, b) {
+		return fmt.Errorf("%s: replay returned body %q, first request returned %q", r.name, b, a)
+	}
+
+	if r.count != nil {
+		after, err := r.count(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %v", r.name, err)
+		}
+		if after-before != r.created {
+			return fmt.Errorf("%s: %d created, expected %d", r.name, after-before, r.created)
+		}
+	}
+	iter.logf("SUCCESS: replayed %s with the same X-Idempotency-Key", r.name)
+	return nil
+}
+
+// compareReplayHeaders returns an error for the first header a replay changed.
+func compareReplayHeaders(first, second http.Header) error {
+	names := make(map[string]bool)
+	for k := range first {
+		names[k] = true
+	}
+	for k := range second {
+		names[k] = true
+	}
+	for k := range names {
+		if volatileReplayHeaders[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+		a, b := strings.Join(first[k], ", "), strings.Join(second[k], ", ")
+		if a != b {
+			return fmt.Errorf("replay returned %s: %q, first request returned %q", k, b, a)
+		}
+	}
+	return nil
+}
+
+// recordingTransport keeps a copy of each response body, which recordedBody returns once the body has been
+// read and closed.
+type recordingTransport struct {
+	underlying http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	underlying := t.underlying
+	if underlying == nil {
+		underlying = http.DefaultTransport
+	}
+	resp, err := underlying.RoundTrip(req)
+	if err != nil || resp.Body == nil {
+		return resp, err
+	}
+	bs, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &replayBody{Reader: bytes.NewReader(bs), bs: bs}
+	return resp, nil
+}
+
+type replayBody struct {
+	*bytes.Reader
+	bs []byte
+}
+
+func (b *replayBody) Close() error {
+	return nil
+}
+
+// recordedBody returns the body recordingTransport kept for resp.
+func recordedBody(resp *http.Response) []byte {
+	if body, ok := resp.Body.(*replayBody); ok {
+		return body.bs
+	}
+	return nil
+}
+
+func closeReplay(resp *http.Response) {
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+}
+
+func idempotentReplays(ctx context.Context, iter *iteration) []idempotentReplay {
+	api, userID := iter.api, iter.userID
+
+	first, last := name()
+	userReq := moov.CreateUser{
+		Email:     email(first, last),
+		Password:  *flagPassword,
+		FirstName: first,
+		LastName:  last,
+		Phone:     phone(),
+	}
+	origReq := originatorRequest(iter.featureFlags, iter.originatorDepository.ID)
+	recReq := receiverRequest(iter.user, iter.featureFlags, iter.receiverDepository.ID)
+
+	// The depository is created in its replay, then used for micro-deposits
+	var acct *moov.Account
+	var dep moov.Depository
+
+	// micro-deposit transactions can only be read when accounts calls are enabled
+	var microDepositCount func(ctx context.Context) (int, error)
+	if !iter.featureFlags.AccountsCallsDisabled {
+		microDepositCount = func(ctx context.Context) (int, error) {
+			transactions, resp, err := api.AccountsApi.GetAccountTransactions(ctx, acct.ID, userID, nil)
+			closeReplay(resp)
+			return len(transactions), err
+		}
+	}
+
+	replays := []idempotentReplay{
+		{
+			name: "CreateUser",
+			call: func(ctx context.Context, key string) (string, *http.Response, error) {
+				u, resp, err := api.UserApi.CreateUser(ctx, userReq, &moov.CreateUserOpts{XIdempotencyKey: optional.NewString(key)})
+				closeReplay(resp)
+				return u.ID, resp, err
+			},
+			track: func(id string) { iter.track("user", id, nil) },
+		},
+		{
+			name: "CreateOAuth2Client",
+			call: func(ctx context.Context, key string) (string, *http.Response, error) {
+				clients, resp, err := api.OAuth2Api.CreateOAuth2Client(ctx, &moov.CreateOAuth2ClientOpts{XIdempotencyKey: optional.NewString(key)})
+				closeReplay(resp)
+				if len(clients) == 0 {
+					return "", resp, err
+				}
+				return clients[0].ClientId, resp, err
+			},
+			track: func(id string) { iter.track("oauth-client", id, nil) },
+			count: func(ctx context.Context) (int, error) {
+				clients, resp, err := api.OAuth2Api.GetClientsForUserId(ctx, nil)
+				closeReplay(resp)
+				return len(clients), err
+			},
+			created: 1,
+		},
+		{
+			name: "AddDepository",
+			call: func(ctx context.Context, key string) (string, *http.Response, error) {
+				var err error
+				if acct == nil {
+					if acct, err = createAccount(ctx, api, iter.user, "idempotency account", ""); err != nil {
+						return "", nil, err
+					}
+					iter.track("account", acct.ID, nil)
+				}
+				req := moov.CreateDepository{
+					BankName:      "Moov Bank",
+					AccountNumber: acct.AccountNumber,
+					RoutingNumber: acct.RoutingNumber,
+					Holder:        iter.user.Name,
+					HolderType:    "Individual",
+					Type:          acct.Type,
+				}
+				d, resp, err := api.DepositoriesApi.AddDepository(ctx, userID, req, &moov.AddDepositoryOpts{XIdempotencyKey: optional.NewString(key)})
+				closeReplay(resp)
+				dep = d
+				return d.ID, resp, err
+			},
+			track: func(id string) { iter.trackDepository(dep) },
+			count: func(ctx context.Context) (int, error) {
+				deps, resp, err := api.DepositoriesApi.GetDepositories(ctx, userID, nil)
+				closeReplay(resp)
+				return len(deps), err
+			},
+			created: 1,
+		},
+		{
+			name: "InitiateMicroDeposits",
+			call: func(ctx context.Context, key string) (string, *http.Response, error) {
+				resp, err := api.DepositoriesApi.InitiateMicroDeposits(ctx, dep.ID, userID, &moov.InitiateMicroDepositsOpts{XIdempotencyKey: optional.NewString(key)})
+				closeReplay(resp)
+				return "", resp, err
+			},
+			count:   microDepositCount,
+			created: 2, // micro-deposits are two transactions
+		},
+		{
+			name: "AddOriginator",
+			call: func(ctx context.Context, key string) (string, *http.Response, error) {
+				orig, resp, err := api.OriginatorsApi.AddOriginator(ctx, userID, origReq, &moov.AddOriginatorOpts{XIdempotencyKey: optional.NewString(key)})
+				closeReplay(resp)
+				return orig.ID, resp, err
+			},
+			track: func(id string) {
+				iter.track("originator", id, func(ctx context.Context) (*http.Response, error) {
+					return api.OriginatorsApi.DeleteOriginator(ctx, id, userID, nil)
+				})
+			},
+			count: func(ctx context.Context) (int, error) {
+				origs, resp, err := api.OriginatorsApi.GetOriginators(ctx, userID, nil)
+				closeReplay(resp)
+				return len(origs), err
+			},
+			created: 1,
+		},
+		{
+			name: "AddReceivers",
+			call: func(ctx context.Context, key string) (string, *http.Response, error) {
+				rec, resp, err := api.ReceiversApi.AddReceivers(ctx, userID, recReq, &moov.AddReceiversOpts{XIdempotencyKey: optional.NewString(key)})
+				closeReplay(resp)
+				return rec.ID, resp, err
+			},
+			track: func(id string) {
+				iter.track("receiver", id, func(ctx context.Context) (*http.Response, error) {
+					return api.ReceiversApi.DeleteReceiver(ctx, id, userID, nil)
+				})
+			},
+			count: func(ctx context.Context) (int, error) {
+				recs, resp, err := api.ReceiversApi.GetReceivers(ctx, userID, nil)
+				closeReplay(resp)
+				return len(recs), err
+			},
+			created: 1,
+		},
+	}
+
+	transferType := "Push"
+	if *flagACHType == ach.TEL {
+		transferType = "Pull" // TEL entries can only debit the receiver
+	}
+	transferReq, err := transferRequest(iter.receiver, iter.originator, transferType, "USD 12.34")
+	if err != nil {
+		return replays // -ach.type was validated on startup
+	}
+	replays = append(replays, idempotentReplay{
+		name: "AddTransfer",
+		call: func(ctx context.Context, key string) (string, *http.Response, error) {
+			tx, resp, err := api.TransfersApi.AddTransfer(ctx, userID, transferReq, &moov.AddTransferOpts{XIdempotencyKey: optional.NewString(key)})
+			closeReplay(resp)
+			return tx.ID, resp, err
+		},
+		track: func(id string) {
+			iter.track("transfer", id, func(ctx context.Context) (*http.Response, error) {
+				return api.TransfersApi.DeleteTransferByID(ctx, id, userID, nil)
+			})
+		},
+		count: func(ctx context.Context) (int, error) {
+			transfers, resp, err := api.TransfersApi.GetTransfers(ctx, userID, nil)
+			closeReplay(resp)
+			return len(transfers), err
+		},
+		created: 1,
+	})
+	return replays
+}
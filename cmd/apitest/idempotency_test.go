@@ -0,0 +1,139 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIdempotency__checkReplay(t *testing.T) {
+	ctx := context.Background()
+	iter := &iteration{logf: t.Logf}
+
+	// replays receive the first response
+	var keys []string
+	objects, tracked := 0, 0
+	saved := map[string]string{}
+	r := idempotentReplay{
+		name: "AddThing",
+		call: func(ctx context.Context, key string) (string, *http.Response, error) {
+			keys = append(keys, key)
+			if id, exists := saved[key]; exists {
+				return id, &http.Response{StatusCode: http.StatusOK}, nil
+			}
+			objects++
+			saved[key] = fmt.Sprintf("thing-%d", objects)
+			return saved[key], &http.Response{StatusCode: http.StatusOK}, nil
+		},
+		track: func(id string) { tracked++ },
+		count: func(ctx context.Context) (int, error) {
+			return objects, nil
+		},
+		created: 1,
+	}
+	if err := checkReplay(ctx, iter, r); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("unexpected X-Idempotency-Keys: %v", keys)
+	}
+	if tracked != 1 {
+		t.Errorf("tracked %d objects", tracked)
+	}
+
+	// keys which are ignored create duplicates
+	saved = map[string]string{}
+	call := r.call
+	r.call = func(ctx context.Context, key string) (string, *http.Response, error) {
+		return call(ctx, generateID())
+	}
+	if err := checkReplay(ctx, iter, r); err == nil || !strings.Contains(err.Error(), "AddThing: replay returned thing-3, first request created thing-2") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// duplicates without an ID in the response are found by counting
+	r.call = func(ctx context.Context, key string) (string, *http.Response, error) {
+		objects++
+		return "", &http.Response{StatusCode: http.StatusOK}, nil
+	}
+	if err := checkReplay(ctx, iter, r); err == nil || !strings.Contains(err.Error(), "2 created, expected 1") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// replays must have the same status
+	status := http.StatusCreated
+	r.call = func(ctx context.Context, key string) (string, *http.Response, error) {
+		resp := &http.Response{StatusCode: status, Status: http.StatusText(status)}
+		status = http.StatusConflict
+		return "", resp, nil
+	}
+	r.count = nil
+	if err := checkReplay(ctx, iter, r); err == nil || !strings.Contains(err.Error(), "replay returned HTTP status Conflict") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// replays must have the same headers, besides volatile ones
+	var responses []*http.Response
+	r.call = func(ctx context.Context, key string) (string, *http.Response, error) {
+		resp := responses[0]
+		responses = responses[1:]
+		return "", resp, nil
+	}
+	responses = []*http.Response{
+		{StatusCode: http.StatusCreated, Header: http.Header{"Date": {"Mon"}, "X-Request-Id": {"a"}}},
+		{StatusCode: http.StatusCreated, Header: http.Header{"Date": {"Tue"}, "X-Request-Id": {"b"}}},
+	}
+	if err := checkReplay(ctx, iter, r); err != nil {
+		t.Error(err)
+	}
+	responses = []*http.Response{
+		{StatusCode: http.StatusCreated, Header: http.Header{"Location": {"/things/1"}}},
+		{StatusCode: http.StatusCreated, Header: http.Header{"Location": {"/things/2"}}},
+	}
+	if err := checkReplay(ctx, iter, r); err == nil || !strings.Contains(err.Error(), `replay returned Location: "/things/2", first request returned "/things/1"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// replays must have the same body
+	responses = []*http.Response{
+		{StatusCode: http.StatusCreated, Body: &replayBody{bs: []byte(`{"amount":1}`)}},
+		{StatusCode: http.StatusCreated, Body: &replayBody{bs: []byte(`{"amount":2}`)}},
+	}
+	if err := checkReplay(ctx, iter, r); err == nil || !strings.Contains(err.Error(), `replay returned body "{\"amount\":2}"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestIdempotency__recordingTransport(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"thing"}`))
+	}))
+	defer svc.Close()
+
+	client := &http.Client{Transport: &recordingTransport{}}
+	resp, err := client.Get(svc.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(bs) != `{"id":"thing"}` {
+		t.Errorf("read %q", bs)
+	}
+
+	// the body is kept after it's been read and closed
+	if bs := recordedBody(resp); string(bs) != `{"id":"thing"}` {
+		t.Errorf("recorded %q", bs)
+	}
+	if bs := recordedBody(&http.Response{}); bs != nil {
+		t.Errorf("recorded %q", bs)
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/moov-io/base"
+)
+
+var (
+	flagLoad                = flag.Bool("load", false, "Run scenarios continuously at a target rate for load testing (see -load.* flags)")
+	flagLoadRequestRate     = flag.Float64("load.requests-per-second", 0, "Target Moov API requests per second")
+	flagLoadTransferRate    = flag.Float64("load.transfers-per-minute", 0, "Target iterations (transfers) started per minute")
+	flagLoadRampUp          = flag.Duration("load.ramp-up", 0, "Duration to linearly increase up to the target rate")
+	flagLoadDuration        = flag.Duration("load.duration", 5*time.Minute, "Duration to generate load for, including ramp-up")
+	flagLoadConcurrency     = flag.Int("load.concurrency", 100, "Maximum number of concurrent iterations")
+	flagLoadSummaryInterval = flag.Duration("load.summary-interval", 10*time.Second, "How often to print a summary of throughput, errors and latency")
+
+	// loadRequests is set in load mode and both paces and records every Moov API request.
+	loadRequests *loadTransport
+)
+
+// maxLatencySamples is how many latencies are kept for each operation to compute percentiles from.
+const maxLatencySamples = 10000
+
+func validateLoadFlags() error {
+	if !*flagLoad {
+		return nil
+	}
+	if *flagFakeData {
+		return errors.New("-load cannot be used with -fake-data")
+	}
+	if (*flagLoadRequestRate > 0) == (*flagLoadTransferRate > 0) {
+		return errors.New("-load requires one of -load.requests-per-second or -load.transfers-per-minute")
+	}
+	if *flagLoadDuration <= 0 || *flagLoadRampUp < 0 || *flagLoadRampUp > *flagLoadDuration {
+		return fmt.Errorf("invalid -load.duration=%v and -load.ramp-up=%v", *flagLoadDuration, *flagLoadRampUp)
+	}
+	if *flagLoadConcurrency <= 0 {
+		return fmt.Errorf("invalid -load.concurrency=%d", *flagLoadConcurrency)
+	}
+	return nil
+}
+
+// pacer spaces out events to hit a target rate, which can be linearly ramped up to.
+type pacer struct {
+	mu sync.Mutex
+
+	started time.Time
+	target  float64 // events per second
+	rampUp  time.Duration
+
+	next time.Time
+}
+
+func newPacer(perSecond float64, rampUp time.Duration) *pacer {
+	return &pacer{
+		started: time.Now(),
+		target:  perSecond,
+		rampUp:  rampUp,
+	}
+}
+
+// rate returns the events per second allowed at a given time. During ramp-up we start at 10% of the target.
+func (p *pacer) rate(when time.Time) float64 {
+	elapsed := when.Sub(p.started)
+	if p.rampUp <= 0 || elapsed >= p.rampUp {
+		return p.target
+	}
+	r := p.target * float64(elapsed) / float64(p.rampUp)
+	if min := p.target / 10; r < min {
+		return min
+	}
+	return r
+}
+
+// wait blocks until the next event is allowed.
+func (p *pacer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	at := p.next
+	p.next = at.Add(time.Duration(float64(time.Second) / p.rate(at)))
+	p.mu.Unlock()
+
+	t := time.NewTimer(time.Until(at))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loadTransport wraps each Moov API request to record its latency and outcome. When requests are
+// paced each one waits for its turn before being sent.
+type loadTransport struct {
+	underlying http.RoundTripper
+	pacer      *pacer
+
+	stats *loadStats
+}
+
+func (t *loadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.pacer != nil {
+		if err := t.pacer.wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	service, name := findOperation(req.Method, req.URL.Path)
+	start := time.Now()
+	resp, err := t.underlying.RoundTrip(req)
+
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	t.stats.recordRequest(fmt.Sprintf("%s.%s", service, name), time.Since(start), status, err)
+	return resp, err
+}
+
+// wrap returns the transport for one iteration's HTTP client.
+func (t *loadTransport) wrap(underlying http.RoundTripper) http.RoundTripper {
+	return &loadTransport{
+		underlying: underlying,
+		pacer:      t.pacer,
+		stats:      t.stats,
+	}
+}
+
+type loadStats struct {
+	mu sync.Mutex
+
+	started    time.Time
+	rand       *rand.Rand
+	iterations struct {
+		passed, failed int
+	}
+	operations map[string]*operationStats
+}
+
+type operationStats struct {
+	requests  int
+	clientErr int // 4xx responses
+	errors    int // transport errors and 5xx responses
+
+	seen      int
+	latencies []time.Duration
+}
+
+func newLoadStats() *loadStats {
+	return &loadStats{
+		started:    time.Now(),
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		operations: make(map[string]*operationStats),
+	}
+}
+
+func (s *loadStats) recordRequest(name string, latency time.Duration, status int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ops, exists := s.operations[name]
+	if !exists {
+		ops = &operationStats{}
+		s.operations[name] = ops
+	}
+	ops.requests++
+	switch {
+	case err != nil || status >= 500:
+		ops.errors++
+	case status >= 400:
+		ops.clientErr++
+	}
+
+	// Keep a uniform sample of latencies (reservoir sampling) so long runs don't grow forever.
+	ops.seen++
+	if len(ops.latencies) < maxLatencySamples {
+		ops.latencies = append(ops.latencies, latency)
+	} else if idx := s.rand.Intn(ops.seen); idx < maxLatencySamples {
+		ops.latencies[idx] = latency
+	}
+}
+
+func (s *loadStats) recordIteration(passed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if passed {
+		s.iterations.passed++
+	} else {
+		s.iterations.failed++
+	}
+}
+
+// percentile returns the p-th (0-100) percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * p / 100)
+	return sorted[idx]
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// summary renders throughput, error rates and latency percentiles of every operation so far.
+func (s *loadStats) summary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := time.Since(s.started)
+	minutes := elapsed.Minutes()
+	iterations := s.iterations.passed + s.iterations.failed
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "load summary after %v: %d iterations (%.1f/min), %.1f%% failed\n",
+		elapsed.Truncate(time.Second), iterations, float64(iterations)/minutes, percent(s.iterations.failed, iterations))
+
+	names := make([]string, 0, len(s.operations))
+	for name := range s.operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "OPERATION\tREQUESTS\tREQ/S\t4XX\tERRORS\tP50\tP90\tP99\tMAX")
+	total, errs := 0, 0
+	for _, name := range names {
+		ops := s.operations[name]
+		total += ops.requests
+		errs += ops.errors
+
+		sorted := append([]time.Duration(nil), ops.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		fmt.Fprintf(w, "%s\t%d\t%.2f\t%.1f%%\t%.1f%%\t%v\t%v\t%v\t%v\n",
+			name, ops.requests, float64(ops.requests)/elapsed.Seconds(),
+			percent(ops.clientErr, ops.requests), percent(ops.errors, ops.requests),
+			percentile(sorted, 50).Round(time.Millisecond), percentile(sorted, 90).Round(time.Millisecond),
+			percentile(sorted, 99).Round(time.Millisecond), percentile(sorted, 100).Round(time.Millisecond))
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t%.2f\t\t%.1f%%\t\t\t\t\n", total, float64(total)/elapsed.Seconds(), percent(errs, total))
+	w.Flush()
+
+	return buf.String()
+}
+
+// runLoad starts iterations of the selected scenarios at the target rate until -load.duration has passed
+// and then waits for any in-flight iterations. Every successful iteration is returned along with how many failed.
+func runLoad(ctx context.Context, selected []*scenario) ([]*iteration, int) {
+	stats := newLoadStats()
+	loadRequests = &loadTransport{stats: stats}
+	if *flagLoadRequestRate > 0 {
+		loadRequests.pacer = newPacer(*flagLoadRequestRate, *flagLoadRampUp)
+		log.Printf("INFO: load testing at %.2f requests/second for %v (ramp-up: %v)", *flagLoadRequestRate, *flagLoadDuration, *flagLoadRampUp)
+	}
+	var starts *pacer
+	if *flagLoadTransferRate > 0 {
+		starts = newPacer(*flagLoadTransferRate/60, *flagLoadRampUp)
+		log.Printf("INFO: load testing at %.2f transfers/minute for %v (ramp-up: %v)", *flagLoadTransferRate, *flagLoadDuration, *flagLoadRampUp)
+	}
+
+	// Print a summary while load is generated
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(*flagLoadSummaryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				logmu.Lock()
+				log.Print(stats.summary())
+				logmu.Unlock()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	deadline, cancel := context.WithTimeout(ctx, *flagLoadDuration)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var iterations []*iteration
+
+	slots := make(chan struct{}, *flagLoadConcurrency)
+	for i := 0; deadline.Err() == nil; i++ {
+		if starts != nil {
+			if err := starts.wait(deadline); err != nil {
+				break
+			}
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-deadline.Done():
+			continue
+		}
+		wg.Add(1)
+		go func(sc *scenario) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			iter := iterate(ctx, base.ID(), sc)
+			stats.recordIteration(iter != nil)
+			if iter != nil {
+				mu.Lock()
+				iterations = append(iterations, iter)
+				mu.Unlock()
+			}
+		}(selected[i%len(selected)])
+	}
+	log.Printf("INFO: load duration reached, waiting on in-flight iterations")
+	wg.Wait()
+	close(done)
+
+	log.Print(stats.summary())
+	return iterations, stats.iterations.failed
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad__pacerRate(t *testing.T) {
+	p := newPacer(100, 10*time.Second)
+	if r := p.rate(p.started); r != 10 {
+		t.Errorf("expected 10%% floor, got %.2f", r)
+	}
+	if r := p.rate(p.started.Add(5 * time.Second)); r != 50 {
+		t.Errorf("halfway through ramp-up got %.2f", r)
+	}
+	if r := p.rate(p.started.Add(time.Minute)); r != 100 {
+		t.Errorf("after ramp-up got %.2f", r)
+	}
+
+	p = newPacer(100, 0)
+	if r := p.rate(p.started); r != 100 {
+		t.Errorf("without ramp-up got %.2f", r)
+	}
+}
+
+func TestLoad__stats(t *testing.T) {
+	stats := newLoadStats()
+	for i := 1; i <= 100; i++ {
+		stats.recordRequest("paygate.AddTransfer", time.Duration(i)*time.Millisecond, 200, nil)
+	}
+	stats.recordRequest("auth.UserLogin", time.Millisecond, 403, nil)
+	stats.recordRequest("auth.UserLogin", time.Millisecond, 0, errors.New("connection refused"))
+	stats.recordIteration(true)
+	stats.recordIteration(false)
+
+	ops := stats.operations["auth.UserLogin"]
+	if ops.requests != 2 || ops.clientErr != 1 || ops.errors != 1 {
+		t.Errorf("unexpected stats: %#v", ops)
+	}
+
+	out := stats.summary()
+	if !strings.Contains(out, "2 iterations") || !strings.Contains(out, "50.0% failed") {
+		t.Errorf("unexpected summary: %s", out)
+	}
+	if !strings.Contains(out, "paygate.AddTransfer") || !strings.Contains(out, "100ms") {
+		t.Errorf("unexpected summary: %s", out)
+	}
+}
+
+func TestLoad__percentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 10; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Second)
+	}
+	if d := percentile(latencies, 50); d != 5*time.Second {
+		t.Errorf("p50=%v", d)
+	}
+	if d := percentile(latencies, 100); d != 10*time.Second {
+		t.Errorf("max=%v", d)
+	}
+	if d := percentile(nil, 99); d != 0 {
+		t.Errorf("empty=%v", d)
+	}
+}
+
+func TestLoad__validateFlags(t *testing.T) {
+	defer func(load bool, rps, tpm float64) {
+		*flagLoad, *flagLoadRequestRate, *flagLoadTransferRate = load, rps, tpm
+	}(*flagLoad, *flagLoadRequestRate, *flagLoadTransferRate)
+
+	*flagLoad = true
+	if err := validateLoadFlags(); err == nil {
+		t.Error("expected error without a rate")
+	}
+	*flagLoadRequestRate, *flagLoadTransferRate = 10, 60
+	if err := validateLoadFlags(); err == nil {
+		t.Error("expected error with both rates")
+	}
+	*flagLoadTransferRate = 0
+	if err := validateLoadFlags(); err != nil {
+		t.Error(err)
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 
 	moov "github.com/moov-io/go-client/client"
@@ -18,16 +17,16 @@ import (
 )
 
 // setMoovAuthCookie adds authentication onto our Moov API client for all requests
-func setMoovAuthCookie(conf *moov.Configuration, user *user) {
-	if user.Cookie.Value != "" {
-		conf.AddDefaultHeader("Cookie", fmt.Sprintf("moov_auth=%s", user.Cookie.Value))
-	} else {
-		log.Fatalf("no cookie found (userId: %v)", user.ID)
+func setMoovAuthCookie(conf *moov.Configuration, user *user) error {
+	if user.Cookie.Value == "" {
+		return fmt.Errorf("no cookie found (userId: %v)", user.ID)
 	}
+	conf.AddDefaultHeader("Cookie", fmt.Sprintf("moov_auth=%s", user.Cookie.Value))
 
 	if _, exists := conf.DefaultHeader["X-User-Id"]; !exists {
 		conf.AddDefaultHeader("X-User-Id", user.ID)
 	}
+	return nil
 }
 
 func removeMoovAuthCookie(conf *moov.Configuration) {
@@ -16,17 +16,18 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/moov-io/api"
 	"github.com/moov-io/api/cmd/apitest/local"
+	"github.com/moov-io/api/cmd/apitest/mock"
 	"github.com/moov-io/base"
 	"github.com/moov-io/base/admin"
 	"github.com/moov-io/base/http/bind"
@@ -44,6 +45,7 @@ var (
 	flagDebug      = flag.Bool("debug", false, "Enable Debug logging.")
 	flagLocal      = flag.Bool("local", false, "Use local HTTP addresses (e.g. 'go run')")
 	flagLocalDev   = flag.Bool("dev", false, "Use tilt local HTTP address")
+	flagMock       = flag.Bool("mock", false, "Run against an in-process mock of the Moov API instead of a deployed setup")
 
 	flagPing    = flag.Bool("ping", false, "Ping Moov applications and quit")
 	flagVersion = flag.Bool("version", false, "Show the version and quit")
@@ -51,10 +53,10 @@ var (
 	adminAddr = flag.String("admin.addr", bind.Admin("apitest"), "Admin HTTP listen address")
 
 	// Business logic flags
-	flagACHType = flag.String("ach.type", "PPD", "ACH Service Class Code (SEC) to use. Options: PPD, IAT")
+	flagACHType = flag.String("ach.type", "PPD", "ACH Standard Entry Class (SEC) code to use. Options: CCD, IAT, PPD, TEL, WEB")
 	flagOAuth   = flag.Bool("oauth", false, "Use OAuth instead of cookie auth")
 
-	flagCleanup = flag.Bool("cleanup", false, "Cleanup files, transfers, etc after creation")
+	flagCleanup = flag.Bool("cleanup", false, "Delete transfers, receivers, originators and depositories after each run (or on SIGINT)")
 
 	flagFakeData       = flag.Bool("fake-data", false, "Generate fake data (instead of one transfer) across several routing numbers, receivers, and originators")
 	flagFakeIterations = flag.Int("fake-data.iterations", 1000, "How many users and transfers to create")
@@ -64,7 +66,9 @@ var (
 
 	// TODO(adam): can we run this in CI now? with paygate's docker-compose setup??
 	flagVerifyTransfers    = flag.String("verify-transfers.dir", "", "Verify the created transfers exist in the given directory of ACH files")
-	flagVerifyInitialSleep = flag.Duration("verify-transfers.initial-sleep", 1*time.Minute, "Duration to sleep so paygate can process and merge all transfers")
+	flagVerifyTimeout      = flag.Duration("verify-transfers.timeout", 5*time.Minute, "Duration to wait for paygate to merge all transfers")
+	flagVerifyPollInterval = flag.Duration("verify-transfers.poll-interval", 5*time.Second, "How often to re-read merged files while waiting on transfers")
+	flagVerifyInitialSleep = flag.Duration("verify-transfers.initial-sleep", 0, "Deprecated: use -verify-transfers.timeout. Duration to sleep before transfers are first checked")
 
 	flagPauseAfterTransfers = flag.Bool("pause", false, "time.Sleep after transfers (intended for prometheus to scrape metrics)")
 	flagPauseDuration       = flag.Duration("pause.duration", 2*time.Minute, "Duration to pause for after transfers")
@@ -83,34 +87,138 @@ func main() {
 
 	adminServer := admin.NewServer(*adminAddr)
 	adminServer.AddVersionHandler(api.Version()) // Setup 'GET /version'
+	if *flagDaemon {
+		adminServer.AddHandler("/status", daemon.handleStatus) // Setup 'GET /status'
+	}
 	go func() {
 		log.Printf("listening on %s", adminServer.BindAddr())
 		adminServer.Listen()
 	}()
 	defer adminServer.Shutdown()
 
+	if v := *flagReportFormat; v != "" && v != "junit" && v != "json" {
+		fatalf("FAILURE: unknown -report.format %q", v)
+	}
+	*flagACHType = strings.ToUpper(*flagACHType)
+	if err := validateACHType(*flagACHType); err != nil {
+		fatalf("FAILURE: %v", err)
+	}
+	if err := validateLoadFlags(); err != nil {
+		fatalf("FAILURE: %v", err)
+	}
+	if err := validateDaemonFlags(); err != nil {
+		fatalf("FAILURE: %v", err)
+	}
+	if *flagVerifyInitialSleep > 0 {
+		log.Printf("WARN: -verify-transfers.initial-sleep is deprecated, transfers are checked every -verify-transfers.poll-interval until -verify-transfers.timeout instead")
+	}
+	defer func() {
+		if err := writeReport(); err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+	}()
+
+	if *flagConformance {
+		conformance = newConformanceChecker("conformance", "the API requirements")
+		httpClient.Transport = conformance.wrap(httpClient.Transport)
+	}
+	if *flagOpenAPISpec != "" {
+		spec, err := loadOpenAPISpec(*flagOpenAPISpec, adminHTTPClient)
+		if err != nil {
+			fatalf("FAILURE: -openapi.spec: %v", err)
+		}
+		openapi = newOpenAPIValidator(spec)
+	}
+
+	if *flagMock {
+		if *flagLocal || *flagLocalDev {
+			fatalf("FAILURE: -mock cannot be used with -local or -dev")
+		}
+		srv := mock.NewServer(*flagVerifyTransfers)
+		srv.InboundDir = *flagInboundDir
+		if *flagOAuthTokenExpiry > 0 {
+			srv.TokenExpiration = *flagOAuthTokenExpiry
+		}
+		if err := srv.Start(); err != nil {
+			fatalf("FAILURE: %v", err)
+		}
+		defer srv.Close()
+		log.Printf("INFO: started mock Moov API on %s", srv.URL)
+
+		*flagApiAddress = srv.URL
+		*flagCustomersAdminAddress = srv.URL
+		*flagPaygateAdminAddress = srv.URL
+	}
+
+	microDepositOrigination = setupMicroDepositOrigination(*flagPaygateAdminAddress, adminHTTPClient)
+	log.Printf("INFO: micro-deposit origination account=%s routing=%s type=%s",
+		microDepositOrigination.AccountNumber, microDepositOrigination.RoutingNumber, microDepositOrigination.AccountType)
+
 	ctx := context.TODO()
 	requestID := base.ID()
 
-	// Basic sanity check against apps
-	if err := pingApps(ctx, requestID); err != nil {
-		log.Fatalf("FAILURE: %v", err)
-	}
-	if *flagPing {
-		log.Println("INFO: all applications responded")
-		return
+	// Basic sanity check against apps, the daemon pings before every run instead.
+	if !*flagDaemon {
+		if err := pingApps(ctx, requestID); err != nil {
+			fatalf("FAILURE: %v", err)
+		}
+		if *flagPing {
+			log.Println("INFO: all applications responded")
+			return
+		}
 	}
 
 	// If we're going to verify we need the directory to be empty beforehand
 	if *flagVerifyTransfers != "" && !verifyDirIsEmpty(*flagVerifyTransfers) {
-		log.Fatalf("FAILURE: verify directory %s is not empty", *flagVerifyTransfers)
+		fatalf("FAILURE: verify directory %s is not empty", *flagVerifyTransfers)
+	}
+
+	if err := loadScenarioFiles(*flagScenarioFiles); err != nil {
+		fatalf("FAILURE: %v", err)
+	}
+	selected, err := findScenarios(*flagScenarios)
+	if err != nil {
+		fatalf("FAILURE: %v", err)
+	}
+	if err := validateTransferTypes(*flagACHType, selected); err != nil {
+		fatalf("FAILURE: %v", err)
+	}
+	if err := validateInboundFlags(selected); err != nil {
+		fatalf("FAILURE: %v", err)
+	}
+
+	if *flagDaemon {
+		runDaemon(ctx, selected)
+		return
+	}
+	if *flagCleanup {
+		go cleanupOnInterrupt()
+	}
+	_, _, err = run(ctx, requestID, selected)
+	cleanupResources()
+	if err != nil {
+		fatalf("FAILURE: %v", err)
+	}
+
+	// Pause after transfers
+	if *flagPauseAfterTransfers {
+		log.Printf("pausing for %v\n", flagPauseDuration)
+		time.Sleep(*flagPauseDuration)
 	}
+}
 
+// run performs one pass of the selected scenarios, checks each user's resources for auth bypasses and
+// verifies their transfers were merged. The number of iterations which failed is returned along with
+// any fatal error.
+func run(ctx context.Context, requestID string, selected []*scenario) ([]*iteration, int, error) {
 	var mu sync.Mutex
 	var iterations []*iteration
+	failed := 0
 
 	// Run either one or many iterations
-	if *flagFakeData {
+	if *flagLoad {
+		iterations, failed = runLoad(ctx, selected)
+	} else if *flagFakeData {
 		fmt.Println("") // add buffer space in output
 
 		var wg sync.WaitGroup
@@ -118,57 +226,108 @@ func main() {
 		for i := 0; i < *flagFakeIterations; i++ {
 			wg.Add(1)
 			gate.Start()
-			go func() {
-				if iter := iterate(ctx, requestID); iter != nil {
-					mu.Lock()
+			go func(sc *scenario) {
+				iter := iterate(ctx, requestID, sc)
+				mu.Lock()
+				if iter != nil {
 					iterations = append(iterations, iter)
-					mu.Unlock()
+				} else {
+					failed++
 				}
+				mu.Unlock()
 				gate.Done()
 				wg.Done()
-			}()
+			}(selected[i%len(selected)])
 		}
 		wg.Wait()
 	} else {
-		if iter := iterate(ctx, requestID); iter != nil {
+		for _, sc := range selected {
+			iter := iterate(ctx, requestID, sc)
+			if iter == nil {
+				failed++
+				continue
+			}
 			iterations = append(iterations, iter) // just one user and transfer
 
+			if iter.transfer.ID == "" {
+				continue // scenario didn't create a transfer
+			}
+
 			// Verify you can't just add x-user-id
 			ac := &authChecker{
 				apiAddress: *flagApiAddress,
 				requestID:  iter.requestID,
 				userID:     iter.userID,
+				track:      iter.track,
 
 				origDepID:    iter.originatorDepository.ID,
 				originatorID: iter.originator.ID,
 				recDepID:     iter.receiverDepository.ID,
 				receiverID:   iter.receiver.ID,
 				transferID:   iter.transfer.ID,
+				customerID:   iter.receiver.CustomerID,
+			}
+			if iter.receiverAccount != nil {
+				ac.accountID = iter.receiverAccount.ID
 			}
-			if err := ac.checkAll(); err != nil {
-				log.Fatalf("FAILURE: auth bypass %s", err)
+			if err := ac.checkAll(ctx); err != nil {
+				return iterations, failed, fmt.Errorf("auth bypass %s", err)
 			}
 			log.Println("INFO: CORS headers present on all HTTP responses")
 		}
 	}
 
-	// Verify every transfer we made exists
-	if *flagVerifyTransfers != "" {
-		if len(iterations) == 0 {
-			log.Fatalf("FAILURE: unable to create any transfers, see above output logs for errors")
+	if conformance != nil {
+		if err := conformance.report(requestID); err != nil {
+			return iterations, failed, err
 		}
-		log.Printf("Sleeping for %v to let paygate collect and merge %d transfers", flagVerifyInitialSleep, len(iterations))
-		time.Sleep(*flagVerifyInitialSleep)
-		if err := verifyTransfersWereMerged(*flagVerifyTransfers, iterations); err != nil {
-			log.Fatalf("FAILURE: %v", err)
+	}
+	if openapi != nil {
+		if err := openapi.report(requestID); err != nil {
+			return iterations, failed, err
 		}
 	}
 
-	// Pause after transfers
-	if *flagPauseAfterTransfers {
-		log.Printf("pausing for %v\n", flagPauseDuration)
-		time.Sleep(*flagPauseDuration)
+	// Verify every transfer we made exists
+	transfers := withTransfers(iterations)
+	if (*flagVerifyTransfers != "" || *flagVerifyRemoteAddress != "" || *flagVerifyTransfersAPI) && len(transfers) == 0 {
+		return iterations, failed, errors.New("unable to create any transfers, see above output logs for errors")
+	}
+	if (*flagVerifyTransfers != "" || *flagVerifyRemoteAddress != "" || *flagVerifyTransfersAPI) && *flagVerifyInitialSleep > 0 {
+		log.Printf("Sleeping for %v before checking %d transfers", *flagVerifyInitialSleep, len(transfers))
+		time.Sleep(*flagVerifyInitialSleep)
+	}
+	if *flagVerifyTransfersAPI {
+		err := testReport.record("verify", "transfers-api", requestID, func() error {
+			statuses := strings.Split(*flagVerifyStatuses, ",")
+			return verifyTransfersThroughAPI(ctx, transfers, statuses, *flagVerifyTimeout, *flagVerifyPollInterval)
+		})
+		if err != nil {
+			return iterations, failed, err
+		}
+	}
+	if *flagVerifyTransfers != "" {
+		err := testReport.record("verify", "transfers-merged", requestID, func() error {
+			return waitForMergedTransfers(localDir(*flagVerifyTransfers), transfers, *flagVerifyTimeout, *flagVerifyPollInterval)
+		})
+		if err != nil {
+			return iterations, failed, err
+		}
+	}
+	if *flagVerifyRemoteAddress != "" {
+		err := testReport.record("verify", "transfers-uploaded", requestID, func() error {
+			src, err := openRemoteSource(*flagVerifyRemoteAddress, *flagVerifyRemoteUsername, *flagVerifyRemotePassword, *flagVerifyRemotePath)
+			if err != nil {
+				return err
+			}
+			defer src.close()
+			return waitForMergedTransfers(src, transfers, *flagVerifyTimeout, *flagVerifyPollInterval)
+		})
+		if err != nil {
+			return iterations, failed, err
+		}
 	}
+	return iterations, failed, nil
 }
 
 var apiAddressOnce sync.Once
@@ -214,6 +373,18 @@ func makeConfiguration() *moov.Configuration {
 			Debug:      *flagDebug,
 		}
 	}
+	if conformance != nil {
+		conf.HTTPClient.Transport = conformance.wrap(conf.HTTPClient.Transport)
+	}
+	if openapi != nil {
+		conf.HTTPClient.Transport = openapi.wrap(conf.HTTPClient.Transport)
+	}
+	conf.HTTPClient.Transport = &metricsTransport{
+		underlying: conf.HTTPClient.Transport,
+	}
+	if loadRequests != nil {
+		conf.HTTPClient.Transport = loadRequests.wrap(conf.HTTPClient.Transport)
+	}
 	return conf
 }
 
@@ -222,49 +393,42 @@ func pingApps(ctx context.Context, requestID string) error {
 	conf.AddDefaultHeader("X-Request-ID", requestID)
 	api := moov.NewAPIClient(conf)
 
-	// ACH
-	resp, err := api.MonitorApi.PingACH(ctx, &moov.PingACHOpts{})
-	if err != nil {
-		return fmt.Errorf("ERROR: failed to ping ACH: %v", err)
-	}
-	resp.Body.Close()
-	log.Println("ACH PONG")
-
-	// auth
-	resp, err = api.MonitorApi.PingAuth(ctx, &moov.PingAuthOpts{})
-	if err != nil {
-		return fmt.Errorf("ERROR: failed to ping auth: %v", err)
-	}
-	resp.Body.Close()
-	log.Println("auth PONG")
-
-	// fed
-	resp, err = api.MonitorApi.PingFED(ctx, &moov.PingFEDOpts{})
-	if err != nil {
-		return fmt.Errorf("ERROR: failed to ping FED: %v", err)
-	}
-	resp.Body.Close()
-	log.Println("FED PONG")
-
-	// Watchman
-	resp, err = api.MonitorApi.PingWatchman(ctx, &moov.PingWatchmanOpts{})
-	if err != nil {
-		return fmt.Errorf("ERROR: failed to ping Watchman: %v", err)
-	}
-	resp.Body.Close()
-	log.Println("Watchman PONG")
-
-	// paygate
-	resp, err = api.MonitorApi.PingPaygate(ctx, &moov.PingPaygateOpts{})
-	if err != nil {
-		return fmt.Errorf("ERROR: failed to ping paygate: %v", err)
+	pings := []struct {
+		name string
+		ping func() (*http.Response, error)
+	}{
+		{"ACH", func() (*http.Response, error) { return api.MonitorApi.PingACH(ctx, &moov.PingACHOpts{}) }},
+		{"auth", func() (*http.Response, error) { return api.MonitorApi.PingAuth(ctx, &moov.PingAuthOpts{}) }},
+		{"FED", func() (*http.Response, error) { return api.MonitorApi.PingFED(ctx, &moov.PingFEDOpts{}) }},
+		{"Watchman", func() (*http.Response, error) { return api.MonitorApi.PingWatchman(ctx, &moov.PingWatchmanOpts{}) }},
+		{"paygate", func() (*http.Response, error) { return api.MonitorApi.PingPaygate(ctx, &moov.PingPaygateOpts{}) }},
+	}
+	for i := range pings {
+		err := testReport.record("ping", pings[i].name, requestID, func() error {
+			resp, err := pings[i].ping()
+			if err != nil {
+				return fmt.Errorf("ERROR: failed to ping %s: %v", pings[i].name, err)
+			}
+			resp.Body.Close()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("%s PONG", pings[i].name)
 	}
-	resp.Body.Close()
-	log.Println("paygate PONG")
 	return nil
 }
 
+// iteration holds the state shared between each step of a scenario.
 type iteration struct {
+	conf *moov.Configuration
+	api  *moov.APIClient
+	logf func(tpl string, args ...interface{})
+
+	featureFlags        *featureFlags
+	microDepositAccount *moov.Account
+
 	user       *user
 	oauthToken moov.OAuth2Token
 
@@ -280,6 +444,9 @@ type iteration struct {
 	receiverDepository moov.Depository
 
 	transfer moov.Transfer
+
+	// vars are values captured from responses by scenario file steps
+	vars map[string]string
 }
 
 var (
@@ -296,12 +463,16 @@ var (
 	}, []string{"source"})
 )
 
-func iterate(ctx context.Context, requestID string) *iteration {
+func iterate(ctx context.Context, requestID string, sc *scenario) *iteration {
 	var failureOncer sync.Once
 
+	// Logs are buffered when running many iterations so each iteration's output stays together
+	buffered := *flagFakeData || *flagLoad
+	failed := false
+
 	var lines []string
 	debugLogger := func(tpl string, args ...interface{}) {
-		if *flagFakeData {
+		if buffered {
 			lines = append(lines, fmt.Sprintf(tpl, args...))
 		} else {
 			log.Printf(tpl, args...)
@@ -312,13 +483,16 @@ func iterate(ctx context.Context, requestID string) *iteration {
 			failedTransfers.With("source", "apitest").Add(1)
 		})
 
-		if *flagFakeData {
+		if buffered {
 			lines = append(lines, fmt.Sprintf(tpl, args...))
 		} else {
 			log.Printf(tpl, args...)
 		}
 	}
 	defer func() { // after an iteration print all logs at once
+		if *flagLoad && !failed {
+			return // only failed iterations are logged while load testing
+		}
 		logmu.Lock()
 		defer logmu.Unlock()
 		for i := range lines {
@@ -331,175 +505,36 @@ func iterate(ctx context.Context, requestID string) *iteration {
 	conf.AddDefaultHeader("X-Request-ID", requestID)
 	conf.AddDefaultHeader("Origin", "https://moov.io")
 	debugLogger("Using X-Request-ID: %s", requestID)
-	api := moov.NewAPIClient(conf)
-
-	featureFlags, err := grabPaygateFeatures(flagLocal, *flagPaygateAdminAddress, adminHTTPClient)
-	if err != nil {
-		errLogger("FAILURE: %v", err)
-		return nil
-	}
-
-	// Create our random user
-	user, err := createUser(ctx, api)
-	if err != nil {
-		errLogger("FAILURE: %v", err)
-		return nil
-	}
-	debugLogger("SUCCESS: Created user %s (email: %s)", user.ID, user.Email)
-
-	// Add auth cookie and userId on every request from now on
-	setMoovAuthCookie(conf, user)
-
-	// Verify Cookie works
-	if err := verifyUserIsLoggedIn(ctx, api, user); err != nil {
-		errLogger("FAILURE: %v", err)
-		return nil
-	}
-	debugLogger("SUCCESS: Cookie works for user %s", user.ID)
-
-	oauthToken, err := createOAuthToken(ctx, api, user)
-	if err != nil {
-		errLogger("FAILURE: %v", err)
-		return nil
-	}
-	expiresIn, _ := time.ParseDuration(fmt.Sprintf("%ds", oauthToken.ExpiresIn))
-	if v := os.Getenv("TRAVIS_OS_NAME"); v != "" {
-		// Hide our OAuth2 access_token from TravisCI logs...
-		debugLogger("SUCCESS: Created OAuth access token, expires in %v", expiresIn)
-	}
-	debugLogger("SUCCESS: Created OAuth access token (%s), expires in %v", oauthToken.AccessToken, expiresIn)
-
-	if *flagOAuth {
-		debugLogger("Using OAuth for all requests now.")
-
-		removeMoovAuthCookie(conf) // we only want OAuth credentials on requests
-		setMoovOAuthToken(conf, oauthToken)
-	}
-
-	// Setup our micro-deposit origination account (or read its info if already setup)
-	microDepositOrig, err := createMicroDepositAccount(ctx, api, user)
-	if err != nil {
-		errLogger("FAILURE: %v", err)
-		return nil
-	}
-	debugLogger("INFO: micro-deposit account=%s", microDepositOrig.ID)
-
-	// Create Originator Account
-	// We create these accounts because they won't exist in the Accounts service already. (We're using fake data/accounts.)
-	origAcct, err := createAccount(ctx, api, user, "from account", "")
-	if err != nil {
-		errLogger("FAILURE: %v", err)
-		return nil
-	}
-
-	// Create Originator Depository
-	origDep, err := createDepository(ctx, api, user, origAcct)
-	if err != nil {
-		errLogger("FAILURE: %v", err)
-		return nil
-	}
-	debugLogger("SUCCESS: Created Originator Depository (id=%s) for user", origDep.ID)
-
-	// Create Originator
-	orig, err := createOriginator(ctx, api, user, featureFlags, origDep.ID)
-	if err != nil {
-		errLogger("FAILURE: %v", err)
-		return nil
-	}
-	debugLogger("SUCCESS: Created Originator (id=%s) for user", orig.ID)
-
-	// By default with -local assume we want to approve customers.
-	if !featureFlags.CustomersCallsDisabled {
-		if err := attemptCustomerApproval(ctx, *flagCustomersAdminAddress, orig.CustomerID); err != nil {
-			errLogger("FAILURE: %v", err)
-			return nil
-		} else {
-			debugLogger("INFO: approved customer=%s", orig.CustomerID)
+	debugLogger("Running scenario %s", sc.name)
+
+	iter := &iteration{
+		conf:      conf,
+		api:       moov.NewAPIClient(conf),
+		logf:      debugLogger,
+		requestID: requestID,
+	}
+
+	started := time.Now()
+	results := sc.run(ctx, iter)
+	testReport.addResults(sc.name, requestID, started, results)
+
+	for _, result := range results {
+		switch {
+		case result.skipped:
+			failed = true
+			debugLogger("SKIPPED: %s: %v", result.name, result.err)
+		case result.err != nil:
+			failed = true
+			errLogger("FAILURE: %s: %v", result.name, result.err)
 		}
 	}
-
-	// Create Receiver Account
-	receiverAcct, err := createAccount(ctx, api, user, "to account", "")
-	if err != nil {
-		errLogger("FAILURE: %v", err)
+	if failed {
 		return nil
 	}
 
-	// Create Receiver Depository
-	receiverDep, err := createDepository(ctx, api, user, receiverAcct)
-	if err != nil {
-		errLogger("FAILURE: %v", err)
-		return nil
-	}
-	debugLogger("SUCCESS: Created Receiver Depository (id=%s) for user", receiverDep.ID)
-
-	// Create Receiver
-	receiver, err := createReceiver(ctx, api, user, featureFlags, receiverDep.ID)
-	if err != nil {
-		errLogger("FAILURE: %v", err)
-		return nil
-	}
-	debugLogger("SUCCESS: Created Receiver (id=%s) for user", receiver.ID)
-
-	if !featureFlags.CustomersCallsDisabled {
-		if err := attemptCustomerApproval(ctx, *flagCustomersAdminAddress, receiver.CustomerID); err != nil {
-			errLogger("FAILURE: %v", err)
-			return nil
-		} else {
-			debugLogger("INFO: approved customer=%s", receiver.CustomerID)
-		}
-	}
-
-	// Create Transfer
-	tx, err := createTransfer(ctx, api, receiver, orig, amount(), user.ID)
-	if err != nil {
-		errLogger("FAILURE: %v", err)
-		return nil
-	}
-	debugLogger("SUCCESS: Created %s transfer (id=%s) for user", tx.Amount, tx.ID)
-
-	// Verify the Transaction was posted
-	if !featureFlags.AccountsCallsDisabled {
-		if err := checkTransactions(ctx, api, origAcct.ID, user, tx.Amount); err != nil {
-			errLogger("FAILURE: %v", err)
-			return nil
-		}
-		if err := checkTransactions(ctx, api, receiverAcct.ID, user, tx.Amount); err != nil {
-			errLogger("FAILURE: %v", err)
-			return nil
-		}
-		debugLogger("SUCCESS: Matched transactions on accounts")
-	}
-
-	// Attempt a Failed login
-	if err := attemptFailedLogin(ctx, api); err != nil {
-		errLogger("FAILURE: %v", err)
-		return nil
-	}
-	debugLogger("SUCCESS: invalid login credentials were rejected")
-
-	// Attempt a Failed OAuth2 auth check
-	if err := attemptFailedOAuth2Login(ctx, api); err != nil {
-		errLogger("FAILURE: %v", err)
-		return nil
-	}
-	debugLogger("SUCCESS: invalid OAuth2 access token was rejected")
-
 	successfulTransfers.With("source", "apitest").Add(1)
 
-	return &iteration{
-		user:                 user,
-		oauthToken:           *oauthToken,
-		requestID:            requestID,
-		userID:               user.ID,
-		originator:           orig,
-		originatorAccount:    origAcct,
-		originatorDepository: origDep,
-		receiver:             receiver,
-		receiverAccount:      receiverAcct,
-		receiverDepository:   receiverDep,
-		transfer:             tx,
-	}
+	return iter
 }
 
 // amount returns a random amount in string form accepted by the Moov API
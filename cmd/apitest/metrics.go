@@ -0,0 +1,51 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	apiRequestDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Name:    "moov_api_request_duration_seconds",
+		Help:    "Histogram of Moov API request latencies",
+		Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"service", "operation"})
+
+	apiResponses = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Name: "moov_api_responses",
+		Help: "Counter of Moov API responses by status code",
+	}, []string{"service", "operation", "status"})
+)
+
+// metricsTransport records the latency and response status of every Moov API request for /metrics.
+type metricsTransport struct {
+	underlying http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	service, name := findOperation(req.Method, req.URL.Path)
+	start := time.Now()
+	resp, err := t.underlying.RoundTrip(req)
+
+	apiRequestDuration.With("service", service, "operation", name).Observe(time.Since(start).Seconds())
+	apiResponses.With("service", service, "operation", name, "status", statusLabel(resp, err)).Add(1)
+
+	return resp, err
+}
+
+// statusLabel returns the HTTP status code, or "error" when no response was read.
+func statusLabel(resp *http.Response, err error) string {
+	if err != nil || resp == nil {
+		return "error"
+	}
+	return strconv.Itoa(resp.StatusCode)
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func findMetric(t *testing.T, name string, labels map[string]string) *dto.Metric {
+	t.Helper()
+
+	families, err := stdprometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range family.GetMetric() {
+			found := 0
+			for _, pair := range m.GetLabel() {
+				if v, exists := labels[pair.GetName()]; exists && v != pair.GetValue() {
+					continue next
+				} else if exists {
+					found++
+				}
+			}
+			if found == len(labels) {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+func TestMetricsTransport(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer svc.Close()
+
+	client := &http.Client{
+		Transport: &metricsTransport{underlying: http.DefaultTransport},
+	}
+	resp, err := client.Post(svc.URL+"/v1/ach/depositories/abc/micro-deposits", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	m := findMetric(t, "moov_api_responses", map[string]string{"service": "paygate", "operation": "InitiateMicroDeposits", "status": "409"})
+	if m == nil || m.GetCounter().GetValue() < 1 {
+		t.Errorf("unexpected counter: %v", m)
+	}
+	m = findMetric(t, "moov_api_request_duration_seconds", map[string]string{"service": "paygate", "operation": "InitiateMicroDeposits"})
+	if m == nil || m.GetHistogram().GetSampleCount() < 1 {
+		t.Errorf("unexpected histogram: %v", m)
+	}
+
+	// Transport errors are counted too
+	svc.Close()
+	if _, err := client.Get(svc.URL + "/v1/ach/ping"); err == nil {
+		t.Fatal("expected error")
+	}
+	if m := findMetric(t, "moov_api_responses", map[string]string{"service": "ach", "operation": "PingACH", "status": "error"}); m == nil {
+		t.Error("missing transport error counter")
+	}
+}
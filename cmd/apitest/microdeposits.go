@@ -0,0 +1,177 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/antihax/optional"
+)
+
+var (
+	flagMicroDepositMaxAttempts = flag.Int("micro-deposits.max-attempts", 5, "Incorrect micro-deposit confirmations paygate allows before it stops accepting them for a Depository")
+)
+
+func init() {
+	registerScenario(&scenario{
+		name: "micro-deposits",
+		steps: []*step{
+			featuresStep,
+			userStep,
+			oauthStep,
+			microDepositAccountStep,
+			microDepositRetriesStep,
+			microDepositMaxAttemptsStep,
+		},
+	})
+}
+
+var (
+	// microDepositRetriesStep confirms with incorrect amounts before the correct ones and then checks
+	// a verified Depository can't be confirmed or sent micro-deposits again.
+	microDepositRetriesStep = &step{
+		name:      "micro-deposit-retries",
+		dependsOn: []string{"micro-deposit-account"},
+		run: func(ctx context.Context, iter *iteration) error {
+			acct, dep, err := createUnverifiedDepository(ctx, iter, "micro-deposit retries account")
+			if err != nil {
+				return err
+			}
+			amounts, err := initiateMicroDeposits(ctx, iter.api, acct.ID, dep, iter.user)
+			if err != nil {
+				return err
+			}
+			wrong, err := incorrectMicroDeposits(amounts)
+			if err != nil {
+				return err
+			}
+
+			resp, err := confirmMicroDeposits(ctx, iter.api, dep, iter.user, wrong)
+			if err := checkMicroDepositResponse(ctx, iter, dep, "confirming incorrect amounts", resp, err, http.StatusBadRequest, "unverified"); err != nil {
+				return err
+			}
+			resp, err = confirmMicroDeposits(ctx, iter.api, dep, iter.user, amounts)
+			if err := checkMicroDepositResponse(ctx, iter, dep, "confirming after an incorrect attempt", resp, err, http.StatusOK, "verified"); err != nil {
+				return err
+			}
+			resp, err = confirmMicroDeposits(ctx, iter.api, dep, iter.user, amounts)
+			if err := checkMicroDepositResponse(ctx, iter, dep, "confirming twice", resp, err, http.StatusBadRequest, "verified"); err != nil {
+				return err
+			}
+			resp, err = iter.api.DepositoriesApi.InitiateMicroDeposits(ctx, dep.ID, iter.userID, &moov.InitiateMicroDepositsOpts{
+				XIdempotencyKey: optional.NewString(generateID()),
+			})
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return checkMicroDepositResponse(ctx, iter, dep, "initiating micro-deposits on a verified depository", resp, err, http.StatusBadRequest, "verified")
+		},
+	}
+
+	// microDepositMaxAttemptsStep confirms with incorrect amounts -micro-deposits.max-attempts times
+	// and checks paygate then refuses the correct amounts.
+	microDepositMaxAttemptsStep = &step{
+		name:      "micro-deposit-max-attempts",
+		dependsOn: []string{"micro-deposit-account"},
+		run: func(ctx context.Context, iter *iteration) error {
+			acct, dep, err := createUnverifiedDepository(ctx, iter, "micro-deposit attempts account")
+			if err != nil {
+				return err
+			}
+			amounts, err := initiateMicroDeposits(ctx, iter.api, acct.ID, dep, iter.user)
+			if err != nil {
+				return err
+			}
+			wrong, err := incorrectMicroDeposits(amounts)
+			if err != nil {
+				return err
+			}
+
+			for i := 1; i <= *flagMicroDepositMaxAttempts; i++ {
+				expected := "unverified"
+				if i == *flagMicroDepositMaxAttempts {
+					expected = "" // paygate may reject the depository once attempts run out, it just can't be verified
+				}
+				resp, err := confirmMicroDeposits(ctx, iter.api, dep, iter.user, wrong)
+				what := fmt.Sprintf("incorrect attempt %d of %d", i, *flagMicroDepositMaxAttempts)
+				if err := checkMicroDepositResponse(ctx, iter, dep, what, resp, err, http.StatusBadRequest, expected); err != nil {
+					return err
+				}
+			}
+			resp, err := confirmMicroDeposits(ctx, iter.api, dep, iter.user, amounts)
+			return checkMicroDepositResponse(ctx, iter, dep, "confirming after max attempts", resp, err, http.StatusBadRequest, "")
+		},
+	}
+)
+
+// createUnverifiedDepository creates an account and a Depository for it without sending micro-deposits.
+func createUnverifiedDepository(ctx context.Context, iter *iteration, name string) (*moov.Account, moov.Depository, error) {
+	acct, err := createAccount(ctx, iter.api, iter.user, name, "")
+	if err != nil {
+		return nil, moov.Depository{}, err
+	}
+	iter.track("account", acct.ID, nil)
+
+	dep, err := addDepository(ctx, iter.api, iter.user, acct)
+	if err != nil {
+		return acct, dep, err
+	}
+	iter.trackDepository(dep)
+	iter.logf("SUCCESS: Created unverified Depository (id=%s) for user", dep.ID)
+	return acct, dep, nil
+}
+
+// checkMicroDepositResponse compares the HTTP status code of a micro-deposit call and then the Depository's status.
+// An empty depositoryStatus only requires the Depository is not verified.
+func checkMicroDepositResponse(ctx context.Context, iter *iteration, dep moov.Depository, what string, resp *http.Response, err error, statusCode int, depositoryStatus string) error {
+	if resp == nil {
+		return fmt.Errorf("%s: no response: %v", what, err)
+	}
+	if resp.StatusCode != statusCode {
+		return fmt.Errorf("%s: got HTTP status %d, expected %d (error: %v)", what, resp.StatusCode, statusCode, err)
+	}
+	// err is expected for 4xx responses, but not from missing CORS headers
+	if err := checkCORSHeaders(resp); err != nil {
+		return fmt.Errorf("%s: %v", what, err)
+	}
+	current, err := getDepository(ctx, iter, dep.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %v", what, err)
+	}
+	switch {
+	case depositoryStatus == "" && strings.EqualFold(current.Status, "verified"):
+		return fmt.Errorf("%s: depository %s is verified", what, dep.ID)
+	case depositoryStatus != "" && !strings.EqualFold(current.Status, depositoryStatus):
+		return fmt.Errorf("%s: depository %s is %s, expected %s", what, dep.ID, current.Status, depositoryStatus)
+	}
+	iter.logf("SUCCESS: %s returned HTTP %d and left depository %s", what, resp.StatusCode, current.Status)
+	return nil
+}
+
+// incorrectMicroDeposits returns amounts which differ from the micro-deposits paygate sent, each is
+// moved up by a cent (wrapping from $0.99 to $0.01).
+func incorrectMicroDeposits(amounts moov.Amounts) (moov.Amounts, error) {
+	var wrong moov.Amounts
+	for _, amt := range amounts.Amounts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimPrefix(amt, "USD")), 64)
+		if err != nil {
+			return wrong, fmt.Errorf("invalid micro-deposit amount %q: %v", amt, err)
+		}
+		cents := int(math.Round(value*100))%99 + 1
+		wrong.Amounts = append(wrong.Amounts, fmt.Sprintf("USD %.2f", float64(cents)/100))
+	}
+	if len(wrong.Amounts) == 0 {
+		return wrong, fmt.Errorf("no micro-deposit amounts found")
+	}
+	return wrong, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+var (
+	flagMicroDepositAccountNumber = flag.String("micro-deposits.account-number", os.Getenv("ODFI_ACCOUNT_NUMBER"), "Account number of paygate's micro-deposit origination account (default read from paygate's config, or 123)")
+	flagMicroDepositRoutingNumber = flag.String("micro-deposits.routing-number", os.Getenv("ODFI_ROUTING_NUMBER"), "Routing number of paygate's micro-deposit origination account (default read from paygate's config, or 121042882)")
+	flagMicroDepositAccountType   = flag.String("micro-deposits.account-type", os.Getenv("ODFI_ACCOUNT_TYPE"), "Type of paygate's micro-deposit origination account (default read from paygate's config, or Savings)")
+
+	// microDepositOrigination is the account paygate sends micro-deposits from, set before any scenarios run.
+	microDepositOrigination = defaultODFIAccount
+)
+
+// odfiAccount is the account at the ODFI which paygate originates micro-deposits from.
+type odfiAccount struct {
+	AccountNumber string `json:"accountNumber"`
+	RoutingNumber string `json:"routingNumber"`
+	AccountType   string `json:"accountType"`
+}
+
+// defaultODFIAccount matches paygate's default config.
+var defaultODFIAccount = odfiAccount{
+	AccountNumber: "123",
+	RoutingNumber: "121042882",
+	AccountType:   "Savings",
+}
+
+func (a odfiAccount) complete() bool {
+	return a.AccountNumber != "" && a.RoutingNumber != "" && a.AccountType != ""
+}
+
+// merge fills in any values missing from a with other's.
+func (a odfiAccount) merge(other odfiAccount) odfiAccount {
+	if a.AccountNumber == "" {
+		a.AccountNumber = other.AccountNumber
+	}
+	if a.RoutingNumber == "" {
+		a.RoutingNumber = other.RoutingNumber
+	}
+	if a.AccountType == "" {
+		a.AccountType = other.AccountType
+	}
+	return a
+}
+
+// setupMicroDepositOrigination decides which account paygate sends micro-deposits from. Flags (or their
+// environment variables) are used first, then paygate's admin config and finally paygate's defaults.
+func setupMicroDepositOrigination(paygateAdminAddress string, httpClient *http.Client) odfiAccount {
+	acct := odfiAccount{
+		AccountNumber: *flagMicroDepositAccountNumber,
+		RoutingNumber: *flagMicroDepositRoutingNumber,
+		AccountType:   *flagMicroDepositAccountType,
+	}
+	if !acct.complete() {
+		discovered, err := discoverODFIAccount(paygateAdminAddress, httpClient)
+		if err != nil {
+			log.Printf("INFO: unable to read micro-deposit account from paygate's config, using defaults: %v", err)
+		} else {
+			acct = acct.merge(*discovered)
+		}
+	}
+	return acct.merge(defaultODFIAccount)
+}
+
+// discoverODFIAccount reads the micro-deposit origination account from paygate's admin config endpoint.
+func discoverODFIAccount(paygateAdminAddress string, httpClient *http.Client) (*odfiAccount, error) {
+	u, err := url.Parse(paygateAdminAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", paygateAdminAddress, err)
+	}
+	u.Path = "/config"
+
+	resp, err := httpClient.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load paygate config: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+	var conf struct {
+		ODFI odfiAccount `json:"odfi"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&conf); err != nil {
+		return nil, fmt.Errorf("failed to read paygate config: %v", err)
+	}
+	if conf.ODFI == (odfiAccount{}) {
+		return nil, fmt.Errorf("no ODFI account in paygate config")
+	}
+	return &conf.ODFI, nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMicroDepositAccount__setupMicroDepositOrigination(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/config" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ODFI": {"RoutingNumber": "231380104", "AccountNumber": "456", "AccountType": ""}}`))
+	}))
+	defer svc.Close()
+
+	// discovered from paygate's config
+	acct := setupMicroDepositOrigination(svc.URL, svc.Client())
+	if acct.AccountNumber != "456" || acct.RoutingNumber != "231380104" || acct.AccountType != "Savings" {
+		t.Errorf("unexpected account: %#v", acct)
+	}
+
+	// flags are used first
+	*flagMicroDepositAccountNumber = "789"
+	defer func() { *flagMicroDepositAccountNumber = "" }()
+	acct = setupMicroDepositOrigination(svc.URL, svc.Client())
+	if acct.AccountNumber != "789" || acct.RoutingNumber != "231380104" {
+		t.Errorf("unexpected account: %#v", acct)
+	}
+
+	// paygate's defaults when the config can't be read
+	*flagMicroDepositAccountNumber = ""
+	svc.Close()
+	if acct := setupMicroDepositOrigination(svc.URL, svc.Client()); acct != defaultODFIAccount {
+		t.Errorf("unexpected account: %#v", acct)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+func TestMicroDeposits__incorrectMicroDeposits(t *testing.T) {
+	wrong, err := incorrectMicroDeposits(moov.Amounts{Amounts: []string{"USD 0.18", "USD 0.99"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wrong.Amounts) != 2 || wrong.Amounts[0] != "USD 0.19" || wrong.Amounts[1] != "USD 0.01" {
+		t.Errorf("unexpected amounts: %v", wrong.Amounts)
+	}
+
+	if _, err := incorrectMicroDeposits(moov.Amounts{}); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := incorrectMicroDeposits(moov.Amounts{Amounts: []string{"USD abc"}}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestMicroDeposits__checkMicroDepositResponse(t *testing.T) {
+	ctx := context.Background()
+	iter := &iteration{}
+	dep := moov.Depository{ID: "dep"}
+	resp := &http.Response{StatusCode: http.StatusBadRequest, Header: make(http.Header), Body: http.NoBody}
+
+	err := checkMicroDepositResponse(ctx, iter, dep, "confirming", resp, errors.New("400 Bad Request"), http.StatusOK, "verified")
+	if err == nil || !strings.Contains(err.Error(), "got HTTP status 400, expected 200") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// an expected status code doesn't hide missing CORS headers
+	err = checkMicroDepositResponse(ctx, iter, dep, "confirming", resp, errors.New("400 Bad Request"), http.StatusBadRequest, "unverified")
+	if err == nil || !strings.Contains(err.Error(), "confirming: missing CORS headers") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
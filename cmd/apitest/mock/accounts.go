@@ -0,0 +1,206 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moov-io/base"
+	moov "github.com/moov-io/go-client/client"
+)
+
+const (
+	// defaultRoutingNumber is assigned to every account, it matches paygate's micro-deposit origination account.
+	defaultRoutingNumber = "121042882"
+
+	microDepositAccountNumber = "123"
+)
+
+type account struct {
+	userID string
+	moov.Account
+}
+
+func (s *Server) addAccountsRoutes() {
+	s.handle("POST", "/v1/accounts", true, s.createAccount)
+	s.handle("GET", "/v1/accounts/search", true, s.searchAccounts)
+	s.handle("POST", "/v1/accounts/transactions", true, s.createTransaction)
+	s.handle("GET", "/v1/accounts/{accountID}/transactions", true, s.getAccountTransactions)
+}
+
+func (s *Server) createAccount(w http.ResponseWriter, r *request) {
+	var req moov.CreateAccount
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if req.Name == "" || req.Type == "" {
+		writeError(w, http.StatusBadRequest, "missing name or type")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	number := req.Number
+	if number == "" {
+		number = s.randomNumber(10)
+	}
+	now := time.Now()
+	acct := &account{
+		userID: r.userID,
+		Account: moov.Account{
+			ID:                  base.ID(),
+			CustomerID:          req.CustomerID,
+			Name:                req.Name,
+			AccountNumber:       number,
+			AccountNumberMasked: maskNumber(number),
+			RoutingNumber:       defaultRoutingNumber,
+			Status:              "Open",
+			Type:                req.Type,
+			CreatedAt:           now,
+			LastModified:        now,
+			Balance:             req.Balance,
+			BalanceAvailable:    req.Balance,
+		},
+	}
+	s.state.accounts[acct.ID] = acct
+
+	writeJSON(w, http.StatusOK, acct.Account)
+}
+
+func maskNumber(number string) string {
+	if len(number) <= 4 {
+		return number
+	}
+	return strings.Repeat("*", len(number)-4) + number[len(number)-4:]
+}
+
+// searchAccounts is not scoped to the calling user as paygate's micro-deposit origination
+// account is shared and found by its account and routing number.
+func (s *Server) searchAccounts(w http.ResponseWriter, r *request) {
+	q := r.URL.Query()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accounts := make([]moov.Account, 0)
+	for _, acct := range s.state.accounts {
+		if v := q.Get("number"); v != "" && v != acct.AccountNumber {
+			continue
+		}
+		if v := q.Get("routingNumber"); v != "" && v != acct.RoutingNumber {
+			continue
+		}
+		if v := q.Get("type"); v != "" && !strings.EqualFold(v, acct.Type) {
+			continue
+		}
+		if v := q.Get("customerID"); v != "" && v != acct.CustomerID {
+			continue
+		}
+		accounts = append(accounts, acct.Account)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].CreatedAt.Before(accounts[j].CreatedAt) })
+
+	writeJSON(w, http.StatusOK, accounts)
+}
+
+func (s *Server) createTransaction(w http.ResponseWriter, r *request) {
+	var req moov.CreateTransaction
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if len(req.Lines) == 0 {
+		writeError(w, http.StatusBadRequest, "no transaction lines")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, line := range req.Lines {
+		if _, exists := s.state.accounts[line.AccountID]; !exists {
+			writeError(w, http.StatusBadRequest, "account %s not found", line.AccountID)
+			return
+		}
+		if line.Amount <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid amount %v", line.Amount)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, s.postTransaction(req.Lines))
+}
+
+// postTransaction records lines and updates each account's balance. Line amounts are positive and
+// their purpose (ACHCredit or ACHDebit) decides the direction. s.mu needs to be held by the caller.
+func (s *Server) postTransaction(lines []moov.TransactionLine) moov.Transaction {
+	tx := moov.Transaction{
+		ID:        base.ID(),
+		Timestamp: time.Now(),
+		Lines:     lines,
+	}
+	for _, line := range lines {
+		acct, exists := s.state.accounts[line.AccountID]
+		if !exists {
+			continue
+		}
+		amount := int32(line.Amount)
+		if strings.EqualFold(line.Purpose, "ACHDebit") {
+			amount = -amount
+		}
+		acct.Balance += amount
+		acct.BalanceAvailable += amount
+	}
+	s.state.transactions = append(s.state.transactions, tx)
+	return tx
+}
+
+// findAccount returns the account with the given routing and account number, if one exists. s.mu needs to be held.
+func (s *Server) findAccount(routingNumber, accountNumber string) *account {
+	for _, acct := range s.state.accounts {
+		if acct.RoutingNumber == routingNumber && acct.AccountNumber == accountNumber {
+			return acct
+		}
+	}
+	return nil
+}
+
+func (s *Server) getAccountTransactions(w http.ResponseWriter, r *request) {
+	limit := 25
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "invalid limit %q", v)
+			return
+		}
+		limit = int(n)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct, exists := s.state.accounts[r.params["accountID"]]
+	if !exists || acct.userID != r.userID {
+		writeError(w, http.StatusNotFound, "account not found")
+		return
+	}
+
+	// newest transactions first
+	transactions := make([]moov.Transaction, 0)
+	for i := len(s.state.transactions) - 1; i >= 0 && len(transactions) < limit; i-- {
+		for _, line := range s.state.transactions[i].Lines {
+			if line.AccountID == acct.ID {
+				transactions = append(transactions, s.state.transactions[i])
+				break
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, transactions)
+}
@@ -0,0 +1,237 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/moov-io/base"
+	moov "github.com/moov-io/go-client/client"
+)
+
+const (
+	cookieName = "moov_auth"
+
+	// defaultTokenExpiration is how long OAuth2 access tokens are valid for unless Server.TokenExpiration is changed
+	defaultTokenExpiration = time.Hour
+)
+
+type userRecord struct {
+	moov.User
+	password string
+}
+
+type oauthClient struct {
+	userID string
+	moov.OAuth2Client
+}
+
+type oauthToken struct {
+	userID  string
+	expires time.Time
+}
+
+func (s *Server) addAuthRoutes() {
+	s.handle("POST", "/v1/users/create", false, s.createUser)
+	s.handle("POST", "/v1/users/login", false, s.userLogin)
+	s.handle("GET", "/v1/users/login", true, s.checkUserLogin)
+	s.handle("DELETE", "/v1/users/login", true, s.userLogout)
+
+	s.handle("POST", "/v1/oauth2/client", true, s.createOAuth2Client)
+	s.handle("GET", "/v1/oauth2/clients", true, s.getOAuth2Clients)
+	s.handle("POST", "/v1/oauth2/token", false, s.createOAuth2Token)
+	s.handle("GET", "/v1/oauth2/authorize", false, s.checkOAuth2Token)
+}
+
+// authenticate returns the userID for a request's moov_auth cookie or OAuth2 access token.
+// A X-User-Id header on its own does not authenticate a request.
+func (s *Server) authenticate(r *http.Request) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cookie, err := r.Cookie(cookieName); err == nil {
+		if userID, exists := s.state.sessions[cookie.Value]; exists {
+			return userID, true
+		}
+	}
+	if token := bearerToken(r); token != "" {
+		if t, exists := s.state.tokens[token]; exists && time.Now().Before(t.expires) {
+			return t.userID, true
+		}
+	}
+	return "", false
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+func (s *Server) createUser(w http.ResponseWriter, r *request) {
+	var req moov.CreateUser
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if req.Email == "" || req.Password == "" || req.FirstName == "" || req.LastName == "" || req.Phone == "" {
+		writeError(w, http.StatusBadRequest, "missing email, password, name or phone")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email := strings.ToLower(req.Email)
+	if _, exists := s.state.emails[email]; exists {
+		writeError(w, http.StatusBadRequest, "user with email %s already exists", req.Email)
+		return
+	}
+	u := &userRecord{
+		User: moov.User{
+			ID:         base.ID(),
+			Email:      req.Email,
+			FirstName:  req.FirstName,
+			LastName:   req.LastName,
+			Phone:      req.Phone,
+			CompanyUrl: req.CompanyUrl,
+			CreatedAt:  time.Now(),
+		},
+		password: req.Password,
+	}
+	s.state.users[u.ID] = u
+	s.state.emails[email] = u.ID
+
+	writeJSON(w, http.StatusOK, u.User)
+}
+
+func (s *Server) userLogin(w http.ResponseWriter, r *request) {
+	var req moov.Login
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, exists := s.state.users[s.state.emails[strings.ToLower(req.Email)]]
+	if !exists || u.password != req.Password {
+		writeError(w, http.StatusForbidden, "invalid credentials")
+		return
+	}
+	session := base.ID()
+	s.state.sessions[session] = u.ID
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    session,
+		Path:     "/",
+		Expires:  time.Now().Add(30 * 24 * time.Hour),
+		HttpOnly: true,
+	})
+	writeJSON(w, http.StatusOK, u.User)
+}
+
+func (s *Server) checkUserLogin(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	u := s.state.users[r.userID]
+	s.mu.Unlock()
+
+	w.Header().Set("X-User-Id", r.userID)
+	writeJSON(w, http.StatusOK, u.User)
+}
+
+func (s *Server) userLogout(w http.ResponseWriter, r *request) {
+	if cookie, err := r.Cookie(cookieName); err == nil {
+		s.mu.Lock()
+		delete(s.state.sessions, cookie.Value)
+		s.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:    cookieName,
+		Path:    "/",
+		Expires: time.Unix(0, 0),
+		MaxAge:  -1,
+	})
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) createOAuth2Client(w http.ResponseWriter, r *request) {
+	client := &oauthClient{
+		userID: r.userID,
+		OAuth2Client: moov.OAuth2Client{
+			ClientId:     base.ID(),
+			ClientSecret: base.ID(),
+			Domain:       "https://moov.io",
+		},
+	}
+
+	s.mu.Lock()
+	s.state.clients[client.ClientId] = client
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, []moov.OAuth2Client{client.OAuth2Client})
+}
+
+func (s *Server) getOAuth2Clients(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clients := make([]moov.OAuth2Client, 0)
+	for _, c := range s.state.clients {
+		if c.userID == r.userID {
+			clients = append(clients, c.OAuth2Client)
+		}
+	}
+	writeJSON(w, http.StatusOK, clients)
+}
+
+func (s *Server) createOAuth2Token(w http.ResponseWriter, r *request) {
+	q := r.URL.Query()
+	if v := q.Get("grant_type"); v != "client_credentials" {
+		writeError(w, http.StatusBadRequest, "unsupported grant_type %q", v)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, exists := s.state.clients[q.Get("client_id")]
+	if !exists || client.ClientSecret != q.Get("client_secret") {
+		writeError(w, http.StatusForbidden, "invalid client credentials")
+		return
+	}
+	token := moov.OAuth2Token{
+		AccessToken: base.ID(),
+		ExpiresIn:   int32(math.Ceil(s.TokenExpiration.Seconds())),
+		TokenType:   "Bearer",
+	}
+	s.state.tokens[token.AccessToken] = &oauthToken{
+		userID:  client.userID,
+		expires: time.Now().Add(s.TokenExpiration),
+	}
+	writeJSON(w, http.StatusOK, token)
+}
+
+func (s *Server) checkOAuth2Token(w http.ResponseWriter, r *request) {
+	token := bearerToken(r.Request)
+
+	s.mu.Lock()
+	t, exists := s.state.tokens[token]
+	s.mu.Unlock()
+
+	if !exists || time.Now().After(t.expires) {
+		writeError(w, http.StatusForbidden, "invalid access token")
+		return
+	}
+	w.Header().Set("X-User-Id", t.userID)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/moov-io/base"
+	moov "github.com/moov-io/go-client/client"
+)
+
+type customer struct {
+	userID string
+	moov.Customer
+}
+
+// approved returns true if paygate would allow transfers for the Customer.
+func (c *customer) approved() bool {
+	switch strings.ToLower(c.Status) {
+	case "ofac", "cip":
+		return true
+	}
+	return false
+}
+
+func (s *Server) addCustomersRoutes() {
+	s.handle("POST", "/v1/customers", true, s.createCustomer)
+	s.handle("GET", "/v1/customers/{customerID}", true, s.getCustomer)
+
+	// admin route
+	s.handle("PUT", "/customers/{customerID}/status", false, s.updateCustomerStatus)
+}
+
+func (s *Server) createCustomer(w http.ResponseWriter, r *request) {
+	var req moov.CreateCustomer
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if req.FirstName == "" || req.LastName == "" {
+		writeError(w, http.StatusBadRequest, "missing first or last name")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cust := s.addCustomer(r.userID, req.FirstName, req.LastName, req.Email)
+	cust.MiddleName = req.MiddleName
+	cust.NickName = req.NickName
+	cust.Suffix = req.Suffix
+	cust.BirthDate = req.BirthDate
+	cust.Metadata = req.Metadata
+	for _, p := range req.Phones {
+		cust.Phones = append(cust.Phones, moov.Phone{Number: p.Number, Type: p.Type})
+	}
+	for _, a := range req.Addresses {
+		cust.Addresses = append(cust.Addresses, moov.Address2{
+			ID:         base.ID(),
+			Type:       a.Type,
+			Address1:   a.Address1,
+			Address2:   a.Address2,
+			City:       a.City,
+			State:      a.State,
+			PostalCode: a.PostalCode,
+			Country:    a.Country,
+		})
+	}
+	writeJSON(w, http.StatusOK, cust.Customer)
+}
+
+// addCustomer saves a new Customer which needs to be approved before it's used in transfers. s.mu needs to be held.
+func (s *Server) addCustomer(userID, first, last, email string) *customer {
+	now := time.Now()
+	cust := &customer{
+		userID: userID,
+		Customer: moov.Customer{
+			ID:           base.ID(),
+			FirstName:    first,
+			LastName:     last,
+			Email:        email,
+			Status:       "Unknown",
+			CreatedAt:    now,
+			LastModified: now,
+		},
+	}
+	s.state.customers[cust.ID] = cust
+	return cust
+}
+
+func (s *Server) getCustomer(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cust, exists := s.state.customers[r.params["customerID"]]
+	if !exists || cust.userID != r.userID {
+		writeError(w, http.StatusNotFound, "customer not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, cust.Customer)
+}
+
+func (s *Server) updateCustomerStatus(w http.ResponseWriter, r *request) {
+	var req struct {
+		Status  string `json:"status"`
+		Comment string `json:"comment"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if req.Status == "" {
+		writeError(w, http.StatusBadRequest, "missing status")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cust, exists := s.state.customers[r.params["customerID"]]
+	if !exists {
+		writeError(w, http.StatusNotFound, "customer not found")
+		return
+	}
+	cust.Status = req.Status
+	cust.LastModified = time.Now()
+
+	writeJSON(w, http.StatusOK, cust.Customer)
+}
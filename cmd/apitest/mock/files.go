@@ -0,0 +1,252 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/moov-io/ach"
+)
+
+// buildFile creates the ACH file paygate would upload for a transfer. Each transfer is written into
+// its own file, which is enough for apitest to match transfers against. seq makes the entry's trace
+// number unique so return and NOC files can be matched back to the transfer.
+func buildFile(tr *transfer, parties *transferParties, cents, seq int) (*ach.File, error) {
+	now := time.Now()
+
+	file := ach.NewFile()
+	file.ID = tr.ID
+	file.Header = ach.NewFileHeader()
+	file.Header.ID = tr.ID
+	file.Header.ImmediateOrigin = parties.origDep.RoutingNumber
+	file.Header.ImmediateOriginName = parties.origDep.BankName
+	file.Header.ImmediateDestination = parties.recDep.RoutingNumber
+	file.Header.ImmediateDestinationName = parties.recDep.BankName
+	file.Header.FileCreationDate = now.Format("060102")
+	file.Header.FileCreationTime = now.Format("1504")
+
+	switch tr.StandardEntryClassCode {
+	case ach.IAT:
+		batch, err := buildIATBatch(tr, parties, cents, seq)
+		if err != nil {
+			return nil, err
+		}
+		file.AddIATBatch(*batch)
+
+	case ach.CCD, ach.PPD, ach.TEL, ach.WEB:
+		batch, err := buildBatch(tr, parties, cents, seq)
+		if err != nil {
+			return nil, err
+		}
+		file.AddBatch(batch)
+
+	default:
+		return nil, fmt.Errorf("unsupported standardEntryClassCode %q", tr.StandardEntryClassCode)
+	}
+
+	if err := file.Create(); err != nil {
+		return nil, err
+	}
+	if err := file.Validate(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func isPull(tr *transfer) bool {
+	return strings.EqualFold(tr.TransferType, "pull")
+}
+
+func serviceClassCode(tr *transfer) int {
+	if isPull(tr) {
+		return ach.DebitsOnly
+	}
+	return ach.CreditsOnly
+}
+
+// transactionCode returns the entry's code for the receiving depository's account type.
+func transactionCode(tr *transfer, dep *depository) int {
+	savings := strings.EqualFold(dep.Type, "savings")
+	switch {
+	case isPull(tr) && savings:
+		return ach.SavingsDebit
+	case isPull(tr):
+		return ach.CheckingDebit
+	case savings:
+		return ach.SavingsCredit
+	}
+	return ach.CheckingCredit
+}
+
+func effectiveEntryDate(tr *transfer) string {
+	if tr.SameDay {
+		return tr.Created.Format("060102")
+	}
+	return tr.Created.AddDate(0, 0, 1).Format("060102")
+}
+
+func entryDescription(tr *transfer) string {
+	if tr.Description == "" {
+		return "TRANSFER"
+	}
+	return tr.Description
+}
+
+// paymentTypeCode is the single or recurring indicator used in WEB and TEL entries
+func paymentTypeCode(paymentType string) string {
+	if strings.EqualFold(paymentType, "recurring") {
+		return "R"
+	}
+	return "S"
+}
+
+func buildBatch(tr *transfer, parties *transferParties, cents, seq int) (ach.Batcher, error) {
+	bh := ach.NewBatchHeader()
+	bh.ID = tr.ID
+	bh.ServiceClassCode = serviceClassCode(tr)
+	bh.CompanyName = parties.orig.Metadata
+	if bh.CompanyName == "" {
+		bh.CompanyName = parties.origDep.Holder
+	}
+	bh.CompanyIdentification = parties.orig.Identification
+	bh.StandardEntryClassCode = tr.StandardEntryClassCode
+	bh.CompanyEntryDescription = entryDescription(tr)
+	bh.EffectiveEntryDate = effectiveEntryDate(tr)
+	bh.ODFIIdentification = parties.origDep.RoutingNumber[:8]
+
+	entry := ach.NewEntryDetail()
+	entry.ID = tr.ID
+	entry.TransactionCode = transactionCode(tr, parties.recDep)
+	entry.SetRDFI(parties.recDep.RoutingNumber)
+	entry.DFIAccountNumber = parties.recDep.AccountNumber
+	entry.Amount = cents
+	entry.IdentificationNumber = parties.rec.ID
+	entry.IndividualName = parties.recDep.Holder
+	entry.SetTraceNumber(bh.ODFIIdentification, seq)
+	entry.Category = ach.CategoryForward
+
+	var paymentInformation string
+	switch tr.StandardEntryClassCode {
+	case ach.CCD:
+		paymentInformation = tr.CCDDetail.PaymentInformation
+	case ach.TEL:
+		entry.DiscretionaryData = paymentTypeCode(tr.TELDetail.PaymentType)
+	case ach.WEB:
+		entry.DiscretionaryData = paymentTypeCode(tr.WEBDetail.PaymentType)
+		paymentInformation = tr.WEBDetail.PaymentInformation
+	}
+	if paymentInformation != "" {
+		addenda05 := ach.NewAddenda05()
+		addenda05.PaymentRelatedInformation = paymentInformation
+		addenda05.SequenceNumber = 1
+		entry.AddAddenda05(addenda05)
+		entry.AddendaRecordIndicator = 1
+	}
+
+	batch, err := ach.NewBatch(bh)
+	if err != nil {
+		return nil, err
+	}
+	batch.AddEntry(entry)
+	if err := batch.Create(); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+func buildIATBatch(tr *transfer, parties *transferParties, cents, seq int) (*ach.IATBatch, error) {
+	detail := tr.IATDetail
+
+	bh := ach.NewIATBatchHeader()
+	bh.ID = tr.ID
+	bh.ServiceClassCode = serviceClassCode(tr)
+	bh.ForeignExchangeIndicator = "FF"
+	bh.ForeignExchangeReferenceIndicator = 3
+	bh.ISODestinationCountryCode = detail.ReceiverCountryCode
+	bh.OriginatorIdentification = parties.orig.Identification
+	bh.StandardEntryClassCode = ach.IAT
+	bh.CompanyEntryDescription = entryDescription(tr)
+	bh.ISOOriginatingCurrencyCode = detail.ODFIBranchCurrencyCode
+	bh.ISODestinationCurrencyCode = detail.RDFIBranchCurrencyCode
+	bh.EffectiveEntryDate = effectiveEntryDate(tr)
+	bh.ODFIIdentification = parties.origDep.RoutingNumber[:8]
+
+	entry := ach.NewIATEntryDetail()
+	entry.ID = tr.ID
+	entry.TransactionCode = transactionCode(tr, parties.recDep)
+	entry.SetRDFI(parties.recDep.RoutingNumber)
+	entry.AddendaRecords = 7
+	entry.DFIAccountNumber = parties.recDep.AccountNumber
+	entry.Amount = cents
+	entry.SetTraceNumber(bh.ODFIIdentification, seq)
+	entry.Category = ach.CategoryForward
+
+	entry.Addenda10 = ach.NewAddenda10()
+	entry.Addenda10.TransactionTypeCode = "MIS"
+	entry.Addenda10.ForeignPaymentAmount = cents
+	entry.Addenda10.Name = detail.ReceiverName
+
+	entry.Addenda11 = ach.NewAddenda11()
+	entry.Addenda11.OriginatorName = detail.OriginatorName
+	entry.Addenda11.OriginatorStreetAddress = detail.OriginatorAddress
+
+	entry.Addenda12 = ach.NewAddenda12()
+	entry.Addenda12.OriginatorCityStateProvince = fmt.Sprintf("%s*%s\\", detail.OriginatorCity, detail.OriginatorState)
+	entry.Addenda12.OriginatorCountryPostalCode = fmt.Sprintf("%s*%s\\", detail.OriginatorCountryCode, detail.OriginatorPostalCode)
+
+	entry.Addenda13 = ach.NewAddenda13()
+	entry.Addenda13.ODFIName = detail.ODFIName
+	entry.Addenda13.ODFIIDNumberQualifier = detail.ODFIIDNumberQualifier
+	entry.Addenda13.ODFIIdentification = detail.ODFIIdentification
+	entry.Addenda13.ODFIBranchCountryCode = detail.OriginatorCountryCode
+
+	entry.Addenda14 = ach.NewAddenda14()
+	entry.Addenda14.RDFIName = detail.RDFIName
+	entry.Addenda14.RDFIIDNumberQualifier = detail.RDFIIDNumberQualifier
+	entry.Addenda14.RDFIIdentification = detail.RDFIIdentification
+	entry.Addenda14.RDFIBranchCountryCode = detail.ReceiverCountryCode
+
+	entry.Addenda15 = ach.NewAddenda15()
+	entry.Addenda15.ReceiverIDNumber = parties.rec.ID
+	entry.Addenda15.ReceiverStreetAddress = detail.ReceiverAddress
+
+	entry.Addenda16 = ach.NewAddenda16()
+	entry.Addenda16.ReceiverCityStateProvince = fmt.Sprintf("%s*%s\\", detail.ReceiverCity, detail.ReceiverState)
+	entry.Addenda16.ReceiverCountryPostalCode = fmt.Sprintf("%s*%s\\", detail.ReceiverCountryCode, detail.ReceiverPostalCode)
+
+	batch := ach.NewIATBatch(bh)
+	batch.AddEntry(entry)
+	if err := batch.Create(); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// writeFile saves an ACH file into dir, named similar to paygate's merged files.
+func writeFile(dir string, tr *transfer, file *ach.File) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("problem creating %s: %v", dir, err)
+	}
+	filename := fmt.Sprintf("%s-%s-%s.ach", tr.Created.Format("20060102"), file.Header.ImmediateDestination, tr.ID)
+	path := filepath.Join(dir, filename)
+
+	fd, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("problem creating ACH file: %v", err)
+	}
+	if err := ach.NewWriter(fd).Write(file); err != nil {
+		fd.Close()
+		os.Remove(path)
+		return "", fmt.Errorf("problem writing ACH file: %v", err)
+	}
+	if err := fd.Close(); err != nil {
+		return "", fmt.Errorf("problem closing ACH file: %v", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// idempotentResponse is a response saved for an X-Idempotency-Key, which is written again for any request that
+// reuses the key instead of creating another object.
+type idempotentResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// recordingWriter saves the response written by a handler while passing it through.
+type recordingWriter struct {
+	http.ResponseWriter
+
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+// idempotencyKey returns the key responses for r are saved under, or an empty string when r isn't idempotent.
+// Keys are scoped to the user and route so they can't replay another user's responses.
+func idempotencyKey(r *request) string {
+	key := r.Header.Get("X-Idempotency-Key")
+	if key == "" {
+		return ""
+	}
+	switch r.Method {
+	case "POST", "PUT", "PATCH":
+		return r.userID + " " + r.Method + " " + r.URL.Path + " " + key
+	}
+	return ""
+}
+
+// serveIdempotent writes the saved response for r's X-Idempotency-Key, or calls h and saves its response.
+func (s *Server) serveIdempotent(w http.ResponseWriter, r *request, h handlerFunc) {
+	key := idempotencyKey(r)
+	if key == "" {
+		h(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	saved, exists := s.state.idempotent[key]
+	s.mu.Unlock()
+	if exists {
+		for k, v := range saved.header {
+			if k != "X-Request-Id" { // replays echo their own X-Request-ID
+				w.Header()[k] = v
+			}
+		}
+		w.WriteHeader(saved.status)
+		w.Write(saved.body)
+		return
+	}
+
+	rec := &recordingWriter{ResponseWriter: w}
+	h(rec, r)
+	if rec.status == 0 || rec.status >= 500 {
+		return // failed requests can be retried
+	}
+
+	s.mu.Lock()
+	s.state.idempotent[key] = &idempotentResponse{
+		status: rec.status,
+		header: w.Header().Clone(),
+		body:   rec.body.Bytes(),
+	}
+	s.mu.Unlock()
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/moov-io/ach"
+	"github.com/moov-io/api/cmd/apitest/returncodes"
+	moov "github.com/moov-io/go-client/client"
+)
+
+const transferReclaimed = "reclaimed"
+
+// processInboundFiles applies every return and NOC file in InboundDir and then removes it, similar to
+// paygate downloading them from the ODFI. s.mu needs to be held.
+func (s *Server) processInboundFiles() {
+	if s.InboundDir == "" {
+		return
+	}
+	matches, _ := filepath.Glob(filepath.Join(s.InboundDir, "*.ach"))
+	for _, path := range matches {
+		if err := s.processInboundFile(path); err != nil {
+			log.Printf("mock: problem processing inbound file %s: %v", path, err)
+			continue
+		}
+		os.Remove(path)
+	}
+}
+
+func (s *Server) processInboundFile(path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	file, err := ach.NewReader(fd).Read()
+	if err != nil {
+		return err
+	}
+	for i := range file.Batches {
+		for _, ed := range file.Batches[i].GetEntries() {
+			switch {
+			case ed.Addenda99 != nil:
+				s.returnTransfer(ed.Addenda99)
+			case ed.Addenda98 != nil:
+				s.correctDepository(ed.Addenda98)
+			}
+		}
+	}
+	return nil
+}
+
+// findTransferByTrace returns the transfer whose ACH entry has traceNumber.
+func (s *Server) findTransferByTrace(traceNumber string) *transfer {
+	for _, tr := range s.state.transfers {
+		if tr.file == nil {
+			continue
+		}
+		for _, batch := range tr.file.Batches {
+			for _, ed := range batch.GetEntries() {
+				if ed.TraceNumber == traceNumber {
+					return tr
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) returnTransfer(addenda99 *ach.Addenda99) {
+	tr := s.findTransferByTrace(addenda99.OriginalTrace)
+	if tr == nil {
+		return
+	}
+	code := ach.LookupReturnCode(addenda99.ReturnCode)
+	if code == nil {
+		return
+	}
+	// only merged transfers can be returned, which the transfer's files endpoint doesn't wait for
+	if err := s.mergeTransfer(tr); err != nil {
+		log.Printf("mock: problem merging transfer %s: %v", tr.ID, err)
+	}
+	tr.Status = transferReclaimed
+	tr.ReturnCode = moov.ReturnCode{Code: code.Code, Reason: code.Reason, Description: code.Description}
+	s.addEvent(tr.userID, transferEvent, tr.ID, fmt.Sprintf("transfer returned with %s: %s", code.Code, code.Reason))
+
+	if dep := s.findDepository(tr.userID, tr.ReceiverDepository); dep != nil && returncodes.Rejecting[code.Code] {
+		dep.Status = statusRejected
+	}
+}
+
+// correctDepository updates the Receiver's Depository from a NOC, only account and routing numbers are corrected.
+func (s *Server) correctDepository(addenda98 *ach.Addenda98) {
+	tr := s.findTransferByTrace(addenda98.OriginalTrace)
+	if tr == nil {
+		return
+	}
+	dep := s.findDepository(tr.userID, tr.ReceiverDepository)
+	if dep == nil {
+		return
+	}
+	corrected := strings.TrimSpace(addenda98.CorrectedData)
+	switch addenda98.ChangeCode {
+	case "C01":
+		dep.AccountNumber = corrected
+	case "C02":
+		dep.RoutingNumber = corrected
+	default:
+		return
+	}
+	s.addEvent(tr.userID, transferEvent, tr.ID, fmt.Sprintf("depository %s corrected with %s", dep.ID, addenda98.ChangeCode))
+}
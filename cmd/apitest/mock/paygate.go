@@ -0,0 +1,943 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moov-io/ach"
+	"github.com/moov-io/base"
+	moov "github.com/moov-io/go-client/client"
+)
+
+const (
+	statusUnverified = "unverified"
+	statusVerified   = "verified"
+	statusRejected   = "rejected"
+
+	transferPending   = "pending"
+	transferProcessed = "processed"
+
+	// defaultMergeDelay is how long transfers stay pending unless Server.MergeDelay is changed
+	defaultMergeDelay = time.Second
+
+	// maxMicroDepositAttempts is how many incorrect confirmations a Depository is rejected after, like paygate.
+	maxMicroDepositAttempts = 5
+
+	transferEvent = "TransferEvent"
+)
+
+type depository struct {
+	userID string
+	moov.Depository
+
+	// microDeposits are the amounts (in cents) sent to the account
+	microDeposits []int
+
+	// attempts counts confirmations with incorrect amounts
+	attempts int
+}
+
+type originator struct {
+	userID string
+	moov.Originator
+}
+
+type receiver struct {
+	userID string
+	moov.Receiver
+}
+
+type transfer struct {
+	userID string
+	moov.Transfer
+
+	// file is the ACH file built for this transfer, it's written into mergedDir once merged
+	file *ach.File
+}
+
+type event struct {
+	userID string
+	moov.Event
+}
+
+func (s *Server) addPaygateRoutes() {
+	// admin route
+	s.handle("GET", "/features", false, s.getFeatures)
+	s.handle("GET", "/config", false, s.getConfig)
+
+	s.handle("GET", "/v1/ach/depositories", true, s.getDepositories)
+	s.handle("POST", "/v1/ach/depositories", true, s.addDepository)
+	s.handle("GET", "/v1/ach/depositories/{depositoryID}", true, s.getDepository)
+	s.handle("PATCH", "/v1/ach/depositories/{depositoryID}", true, s.updateDepository)
+	s.handle("DELETE", "/v1/ach/depositories/{depositoryID}", true, s.deleteDepository)
+	s.handle("POST", "/v1/ach/depositories/{depositoryID}/micro-deposits", true, s.initiateMicroDeposits)
+	s.handle("POST", "/v1/ach/depositories/{depositoryID}/micro-deposits/confirm", true, s.confirmMicroDeposits)
+
+	s.handle("GET", "/v1/ach/originators", true, s.getOriginators)
+	s.handle("POST", "/v1/ach/originators", true, s.addOriginator)
+	s.handle("GET", "/v1/ach/originators/{originatorID}", true, s.getOriginator)
+	s.handle("PATCH", "/v1/ach/originators/{originatorID}", true, s.updateOriginator)
+	s.handle("DELETE", "/v1/ach/originators/{originatorID}", true, s.deleteOriginator)
+
+	s.handle("GET", "/v1/ach/receivers", true, s.getReceivers)
+	s.handle("POST", "/v1/ach/receivers", true, s.addReceiver)
+	s.handle("GET", "/v1/ach/receivers/{receiverID}", true, s.getReceiver)
+	s.handle("PATCH", "/v1/ach/receivers/{receiverID}", true, s.updateReceiver)
+	s.handle("DELETE", "/v1/ach/receivers/{receiverID}", true, s.deleteReceiver)
+
+	s.handle("GET", "/v1/ach/transfers", true, s.getTransfers)
+	s.handle("POST", "/v1/ach/transfers", true, s.addTransfer)
+	s.handle("GET", "/v1/ach/transfers/{transferID}", true, s.getTransfer)
+	s.handle("DELETE", "/v1/ach/transfers/{transferID}", true, s.deleteTransfer)
+	s.handle("GET", "/v1/ach/transfers/{transferID}/events", true, s.getTransferEvents)
+	s.handle("POST", "/v1/ach/transfers/{transferID}/files", true, s.getTransferFiles)
+
+	s.handle("GET", "/v1/ach/events", true, s.getEvents)
+	s.handle("GET", "/v1/ach/events/{eventID}", true, s.getEvent)
+}
+
+// getConfig mirrors the ODFI section of paygate's admin config endpoint, which holds the micro-deposit origination account.
+func (s *Server) getConfig(w http.ResponseWriter, r *request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"odfi": map[string]string{
+			"accountNumber": microDepositAccountNumber,
+			"routingNumber": defaultRoutingNumber,
+			"accountType":   "Savings",
+		},
+	})
+}
+
+// getFeatures mirrors paygate's admin endpoint. Both the Accounts and Customers integrations are always enabled.
+func (s *Server) getFeatures(w http.ResponseWriter, r *request) {
+	writeJSON(w, http.StatusOK, map[string]bool{
+		"accountsCallsDisabled":  false,
+		"customersCallsDisabled": false,
+	})
+}
+
+// Depositories
+
+func (s *Server) getDepositories(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deps := make([]moov.Depository, 0)
+	for _, dep := range s.state.depositories {
+		if dep.userID == r.userID {
+			deps = append(deps, dep.Depository)
+		}
+	}
+	sort.Slice(deps, func(i, j int) bool { return deps[i].Created.Before(deps[j].Created) })
+	writeJSON(w, http.StatusOK, deps)
+}
+
+func validateDepository(req moov.CreateDepository) error {
+	if req.BankName == "" || req.Holder == "" || req.AccountNumber == "" {
+		return errors.New("missing bankName, holder or accountNumber")
+	}
+	switch strings.ToLower(req.HolderType) {
+	case "individual", "business":
+	default:
+		return fmt.Errorf("invalid holderType %q", req.HolderType)
+	}
+	switch strings.ToLower(req.Type) {
+	case "checking", "savings":
+	default:
+		return fmt.Errorf("invalid type %q", req.Type)
+	}
+	if err := ach.CheckRoutingNumber(req.RoutingNumber); err != nil {
+		return fmt.Errorf("invalid routingNumber: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) addDepository(w http.ResponseWriter, r *request) {
+	var req moov.CreateDepository
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if err := validateDepository(req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	now := time.Now()
+	dep := &depository{
+		userID: r.userID,
+		Depository: moov.Depository{
+			ID:            base.ID(),
+			BankName:      req.BankName,
+			Holder:        req.Holder,
+			HolderType:    req.HolderType,
+			Type:          req.Type,
+			RoutingNumber: req.RoutingNumber,
+			AccountNumber: req.AccountNumber,
+			Status:        statusUnverified,
+			Metadata:      req.Metadata,
+			Created:       now,
+			Updated:       now,
+		},
+	}
+
+	s.mu.Lock()
+	s.state.depositories[dep.ID] = dep
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, dep.Depository)
+}
+
+// findDepository returns the user's Depository, s.mu needs to be held.
+func (s *Server) findDepository(userID, depositoryID string) *depository {
+	if dep, exists := s.state.depositories[depositoryID]; exists && dep.userID == userID {
+		return dep
+	}
+	return nil
+}
+
+func (s *Server) getDepository(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dep := s.findDepository(r.userID, r.params["depositoryID"])
+	if dep == nil {
+		writeError(w, http.StatusNotFound, "depository not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, dep.Depository)
+}
+
+func (s *Server) updateDepository(w http.ResponseWriter, r *request) {
+	var req moov.CreateDepository
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dep := s.findDepository(r.userID, r.params["depositoryID"])
+	if dep == nil {
+		writeError(w, http.StatusNotFound, "depository not found")
+		return
+	}
+	if req.BankName != "" {
+		dep.BankName = req.BankName
+	}
+	if req.Holder != "" {
+		dep.Holder = req.Holder
+	}
+	if req.HolderType != "" {
+		dep.HolderType = req.HolderType
+	}
+	if req.Type != "" {
+		dep.Type = req.Type
+	}
+	if req.Metadata != "" {
+		dep.Metadata = req.Metadata
+	}
+	// Changing account details requires the Depository to be verified again
+	if (req.RoutingNumber != "" && req.RoutingNumber != dep.RoutingNumber) || (req.AccountNumber != "" && req.AccountNumber != dep.AccountNumber) {
+		if req.RoutingNumber != "" {
+			if err := ach.CheckRoutingNumber(req.RoutingNumber); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid routingNumber: %v", err)
+				return
+			}
+			dep.RoutingNumber = req.RoutingNumber
+		}
+		if req.AccountNumber != "" {
+			dep.AccountNumber = req.AccountNumber
+		}
+		dep.Status = statusUnverified
+		dep.microDeposits = nil
+		dep.attempts = 0
+	}
+	dep.Updated = time.Now()
+
+	writeJSON(w, http.StatusOK, dep.Depository)
+}
+
+func (s *Server) deleteDepository(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dep := s.findDepository(r.userID, r.params["depositoryID"])
+	if dep == nil {
+		writeError(w, http.StatusNotFound, "depository not found")
+		return
+	}
+	delete(s.state.depositories, dep.ID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// initiateMicroDeposits sends two random amounts (under $1) to the Depository. Each is posted as a transaction
+// which credits the depository's account and debits paygate's micro-deposit origination account.
+func (s *Server) initiateMicroDeposits(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dep := s.findDepository(r.userID, r.params["depositoryID"])
+	if dep == nil {
+		writeError(w, http.StatusNotFound, "depository not found")
+		return
+	}
+	if dep.Status != statusUnverified {
+		writeError(w, http.StatusBadRequest, "depository %s is %s", dep.ID, dep.Status)
+		return
+	}
+	dep.microDeposits = []int{1 + s.rand.Intn(99), 1 + s.rand.Intn(99)}
+
+	acct := s.findAccount(dep.RoutingNumber, dep.AccountNumber)
+	origination := s.findAccount(defaultRoutingNumber, microDepositAccountNumber)
+	if acct != nil && origination != nil {
+		for _, amt := range dep.microDeposits {
+			s.postTransaction([]moov.TransactionLine{
+				{AccountID: acct.ID, Purpose: "ACHCredit", Amount: float32(amt)},
+				{AccountID: origination.ID, Purpose: "ACHDebit", Amount: float32(amt)},
+			})
+		}
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) confirmMicroDeposits(w http.ResponseWriter, r *request) {
+	var req moov.Amounts
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	var amounts []int
+	for i := range req.Amounts {
+		amt, err := parseAmount(req.Amounts[i])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		amounts = append(amounts, amt)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dep := s.findDepository(r.userID, r.params["depositoryID"])
+	if dep == nil {
+		writeError(w, http.StatusNotFound, "depository not found")
+		return
+	}
+	if dep.Status != statusUnverified {
+		writeError(w, http.StatusBadRequest, "depository %s is %s", dep.ID, dep.Status)
+		return
+	}
+	if len(dep.microDeposits) == 0 {
+		writeError(w, http.StatusBadRequest, "micro-deposits were not initiated for depository %s", dep.ID)
+		return
+	}
+	if !sameAmounts(amounts, dep.microDeposits) {
+		dep.attempts++
+		if dep.attempts >= maxMicroDepositAttempts {
+			dep.Status = statusRejected
+			dep.Updated = time.Now()
+			writeError(w, http.StatusBadRequest, "too many incorrect micro-deposit attempts, depository %s is rejected", dep.ID)
+			return
+		}
+		writeError(w, http.StatusBadRequest, "incorrect micro-deposit amounts")
+		return
+	}
+	dep.Status = statusVerified
+	dep.Updated = time.Now()
+	w.WriteHeader(http.StatusOK)
+}
+
+func sameAmounts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]int(nil), a...), append([]int(nil), b...)
+	sort.Ints(a)
+	sort.Ints(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseAmount reads an amount (e.g. "USD 12.34") into cents.
+func parseAmount(amount string) (int, error) {
+	parts := strings.Fields(amount)
+	if len(parts) != 2 || parts[0] != "USD" {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	n, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	return int(math.Round(n * 100)), nil
+}
+
+// Originators
+
+func (s *Server) getOriginators(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	origs := make([]moov.Originator, 0)
+	for _, orig := range s.state.originators {
+		if orig.userID == r.userID {
+			origs = append(origs, orig.Originator)
+		}
+	}
+	sort.Slice(origs, func(i, j int) bool { return origs[i].Created.Before(origs[j].Created) })
+	writeJSON(w, http.StatusOK, origs)
+}
+
+// verifiedDepository returns an error if the user's Depository doesn't exist or isn't verified. s.mu needs to be held.
+func (s *Server) verifiedDepository(userID, depositoryID string) (*depository, error) {
+	dep := s.findDepository(userID, depositoryID)
+	if dep == nil {
+		return nil, fmt.Errorf("depository %s not found", depositoryID)
+	}
+	if dep.Status != statusVerified {
+		return nil, fmt.Errorf("depository %s is %s", depositoryID, dep.Status)
+	}
+	return dep, nil
+}
+
+func (s *Server) addOriginator(w http.ResponseWriter, r *request) {
+	var req moov.CreateOriginator
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if req.Identification == "" {
+		writeError(w, http.StatusBadRequest, "missing identification")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.verifiedDepository(r.userID, req.DefaultDepository); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	first, last := splitName(req.Metadata)
+	cust := s.addCustomer(r.userID, first, last, "")
+
+	now := time.Now()
+	orig := &originator{
+		userID: r.userID,
+		Originator: moov.Originator{
+			ID:                base.ID(),
+			DefaultDepository: req.DefaultDepository,
+			Identification:    req.Identification,
+			CustomerID:        cust.ID,
+			BirthDate:         req.BirthDate,
+			Address:           req.Address,
+			Metadata:          req.Metadata,
+			Created:           now,
+			Updated:           now,
+		},
+	}
+	s.state.originators[orig.ID] = orig
+
+	writeJSON(w, http.StatusOK, orig.Originator)
+}
+
+// splitName returns a first and last name for a Customer created on behalf of an Originator or Receiver.
+func splitName(name string) (string, string) {
+	parts := strings.Fields(name)
+	switch len(parts) {
+	case 0:
+		return "Unknown", "Unknown"
+	case 1:
+		return parts[0], parts[0]
+	}
+	return parts[0], strings.Join(parts[1:], " ")
+}
+
+func (s *Server) findOriginator(userID, originatorID string) *originator {
+	if orig, exists := s.state.originators[originatorID]; exists && orig.userID == userID {
+		return orig
+	}
+	return nil
+}
+
+func (s *Server) getOriginator(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orig := s.findOriginator(r.userID, r.params["originatorID"])
+	if orig == nil {
+		writeError(w, http.StatusNotFound, "originator not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, orig.Originator)
+}
+
+func (s *Server) updateOriginator(w http.ResponseWriter, r *request) {
+	var req moov.CreateOriginator
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orig := s.findOriginator(r.userID, r.params["originatorID"])
+	if orig == nil {
+		writeError(w, http.StatusNotFound, "originator not found")
+		return
+	}
+	if req.DefaultDepository != "" {
+		if _, err := s.verifiedDepository(r.userID, req.DefaultDepository); err != nil {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		orig.DefaultDepository = req.DefaultDepository
+	}
+	if req.Identification != "" {
+		orig.Identification = req.Identification
+	}
+	if req.Metadata != "" {
+		orig.Metadata = req.Metadata
+	}
+	orig.Updated = time.Now()
+
+	writeJSON(w, http.StatusOK, orig.Originator)
+}
+
+func (s *Server) deleteOriginator(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orig := s.findOriginator(r.userID, r.params["originatorID"])
+	if orig == nil {
+		writeError(w, http.StatusNotFound, "originator not found")
+		return
+	}
+	delete(s.state.originators, orig.ID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Receivers
+
+func (s *Server) getReceivers(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	receivers := make([]moov.Receiver, 0)
+	for _, rec := range s.state.receivers {
+		if rec.userID == r.userID {
+			receivers = append(receivers, rec.Receiver)
+		}
+	}
+	sort.Slice(receivers, func(i, j int) bool { return receivers[i].Created.Before(receivers[j].Created) })
+	writeJSON(w, http.StatusOK, receivers)
+}
+
+func (s *Server) addReceiver(w http.ResponseWriter, r *request) {
+	var req moov.CreateReceiver
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if req.Email == "" {
+		writeError(w, http.StatusBadRequest, "missing email")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.verifiedDepository(r.userID, req.DefaultDepository); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	first, last := splitName(req.Metadata)
+	cust := s.addCustomer(r.userID, first, last, req.Email)
+
+	now := time.Now()
+	rec := &receiver{
+		userID: r.userID,
+		Receiver: moov.Receiver{
+			ID:                base.ID(),
+			Email:             req.Email,
+			DefaultDepository: req.DefaultDepository,
+			Status:            statusUnverified,
+			BirthDate:         req.BirthDate,
+			Address:           req.Address,
+			CustomerID:        cust.ID,
+			Metadata:          req.Metadata,
+			Created:           now,
+			Updated:           now,
+		},
+	}
+	s.state.receivers[rec.ID] = rec
+
+	writeJSON(w, http.StatusOK, rec.Receiver)
+}
+
+func (s *Server) findReceiver(userID, receiverID string) *receiver {
+	if rec, exists := s.state.receivers[receiverID]; exists && rec.userID == userID {
+		return rec
+	}
+	return nil
+}
+
+func (s *Server) getReceiver(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec := s.findReceiver(r.userID, r.params["receiverID"])
+	if rec == nil {
+		writeError(w, http.StatusNotFound, "receiver not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, rec.Receiver)
+}
+
+func (s *Server) updateReceiver(w http.ResponseWriter, r *request) {
+	var req moov.CreateReceiver
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec := s.findReceiver(r.userID, r.params["receiverID"])
+	if rec == nil {
+		writeError(w, http.StatusNotFound, "receiver not found")
+		return
+	}
+	if req.DefaultDepository != "" {
+		if _, err := s.verifiedDepository(r.userID, req.DefaultDepository); err != nil {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		rec.DefaultDepository = req.DefaultDepository
+	}
+	if req.Email != "" {
+		rec.Email = req.Email
+	}
+	if req.Metadata != "" {
+		rec.Metadata = req.Metadata
+	}
+	rec.Updated = time.Now()
+
+	writeJSON(w, http.StatusOK, rec.Receiver)
+}
+
+func (s *Server) deleteReceiver(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec := s.findReceiver(r.userID, r.params["receiverID"])
+	if rec == nil {
+		writeError(w, http.StatusNotFound, "receiver not found")
+		return
+	}
+	delete(s.state.receivers, rec.ID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Transfers
+
+func (s *Server) getTransfers(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transfers := make([]moov.Transfer, 0)
+	for _, tr := range s.state.transfers {
+		if tr.userID == r.userID {
+			transfers = append(transfers, tr.Transfer)
+		}
+	}
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].Created.Before(transfers[j].Created) })
+	writeJSON(w, http.StatusOK, transfers)
+}
+
+// transferParties are the objects involved in a transfer
+type transferParties struct {
+	orig    *originator
+	origDep *depository
+	rec     *receiver
+	recDep  *depository
+}
+
+// lookupParties finds the objects for a transfer and checks they're able to be used. s.mu needs to be held.
+func (s *Server) lookupParties(userID string, req moov.CreateTransfer) (*transferParties, error) {
+	p := &transferParties{
+		orig: s.findOriginator(userID, req.Originator),
+		rec:  s.findReceiver(userID, req.Receiver),
+	}
+	if p.orig == nil {
+		return nil, fmt.Errorf("originator %s not found", req.Originator)
+	}
+	if p.rec == nil {
+		return nil, fmt.Errorf("receiver %s not found", req.Receiver)
+	}
+
+	origDepID, recDepID := req.OriginatorDepository, req.ReceiverDepository
+	if origDepID == "" {
+		origDepID = p.orig.DefaultDepository
+	}
+	if recDepID == "" {
+		recDepID = p.rec.DefaultDepository
+	}
+	var err error
+	if p.origDep, err = s.verifiedDepository(userID, origDepID); err != nil {
+		return nil, fmt.Errorf("originator %v", err)
+	}
+	if p.recDep, err = s.verifiedDepository(userID, recDepID); err != nil {
+		return nil, fmt.Errorf("receiver %v", err)
+	}
+
+	for _, customerID := range []string{p.orig.CustomerID, p.rec.CustomerID} {
+		if cust, exists := s.state.customers[customerID]; exists && !cust.approved() {
+			return nil, fmt.Errorf("customer %s has status %s", cust.ID, cust.Status)
+		}
+	}
+	return p, nil
+}
+
+func (s *Server) addTransfer(w http.ResponseWriter, r *request) {
+	var req moov.CreateTransfer
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	cents, err := parseAmount(req.Amount)
+	if err != nil || cents == 0 {
+		writeError(w, http.StatusBadRequest, "invalid amount %q", req.Amount)
+		return
+	}
+	switch strings.ToLower(req.TransferType) {
+	case "push", "pull":
+	default:
+		writeError(w, http.StatusBadRequest, "invalid transferType %q", req.TransferType)
+		return
+	}
+	if req.StandardEntryClassCode == "" {
+		req.StandardEntryClassCode = ach.PPD
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parties, err := s.lookupParties(r.userID, req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	tr := &transfer{
+		userID: r.userID,
+		Transfer: moov.Transfer{
+			ID:                     base.ID(),
+			TransferType:           req.TransferType,
+			Amount:                 req.Amount,
+			Originator:             parties.orig.ID,
+			OriginatorDepository:   parties.origDep.ID,
+			Receiver:               parties.rec.ID,
+			ReceiverDepository:     parties.recDep.ID,
+			Description:            req.Description,
+			StandardEntryClassCode: strings.ToUpper(req.StandardEntryClassCode),
+			Status:                 transferPending,
+			SameDay:                req.SameDay,
+			Created:                time.Now(),
+			CCDDetail:              req.CCDDetail,
+			IATDetail:              req.IATDetail,
+			TELDetail:              req.TELDetail,
+			WEBDetail:              req.WEBDetail,
+		},
+	}
+
+	s.state.traceNumbers++
+	file, err := buildFile(tr, parties, cents, s.state.traceNumbers)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "problem creating ACH file: %v", err)
+		return
+	}
+	tr.file = file
+	s.postTransferTransaction(tr, parties, cents)
+	s.state.transfers[tr.ID] = tr
+	s.addEvent(r.userID, transferEvent, tr.ID, fmt.Sprintf("%s transfer to %s", tr.TransferType, parties.rec.Email))
+	s.scheduleMerge(tr.ID, s.MergeDelay)
+
+	writeJSON(w, http.StatusOK, tr.Transfer)
+}
+
+// postTransferTransaction records the transfer against each depository's account, if the Accounts service holds them.
+// Pushed funds are debited from the Originator and credited to the Receiver, pulled funds go the other way.
+func (s *Server) postTransferTransaction(tr *transfer, parties *transferParties, cents int) {
+	origAcct := s.findAccount(parties.origDep.RoutingNumber, parties.origDep.AccountNumber)
+	recAcct := s.findAccount(parties.recDep.RoutingNumber, parties.recDep.AccountNumber)
+	if origAcct == nil || recAcct == nil {
+		return
+	}
+	origPurpose, recPurpose := "ACHDebit", "ACHCredit"
+	if strings.EqualFold(tr.TransferType, "pull") {
+		origPurpose, recPurpose = recPurpose, origPurpose
+	}
+	s.postTransaction([]moov.TransactionLine{
+		{AccountID: origAcct.ID, Purpose: origPurpose, Amount: float32(cents)},
+		{AccountID: recAcct.ID, Purpose: recPurpose, Amount: float32(cents)},
+	})
+}
+
+// scheduleMerge merges a transfer once delay has passed, similar to paygate's cutoff times.
+func (s *Server) scheduleMerge(transferID string, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if tr, exists := s.state.transfers[transferID]; exists {
+			if err := s.mergeTransfer(tr); err != nil {
+				log.Printf("mock: problem merging transfer %s: %v", transferID, err)
+			}
+		}
+	})
+}
+
+// mergeTransfer writes a pending transfer's ACH file into mergedDir and marks it processed. s.mu needs to be held.
+func (s *Server) mergeTransfer(tr *transfer) error {
+	if tr.Status != transferPending {
+		return nil
+	}
+	if s.mergedDir != "" {
+		if _, err := writeFile(s.mergedDir, tr, tr.file); err != nil {
+			return err
+		}
+	}
+	tr.Status = transferProcessed
+	s.addEvent(tr.userID, transferEvent, tr.ID, "transfer merged and processed")
+	return nil
+}
+
+func (s *Server) findTransfer(userID, transferID string) *transfer {
+	if tr, exists := s.state.transfers[transferID]; exists && tr.userID == userID {
+		return tr
+	}
+	return nil
+}
+
+func (s *Server) getTransfer(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tr := s.findTransfer(r.userID, r.params["transferID"])
+	if tr == nil {
+		writeError(w, http.StatusNotFound, "transfer not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, tr.Transfer)
+}
+
+// deleteTransfer removes a pending Transfer, merged transfers can't be deleted.
+func (s *Server) deleteTransfer(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tr := s.findTransfer(r.userID, r.params["transferID"])
+	if tr == nil {
+		writeError(w, http.StatusNotFound, "transfer not found")
+		return
+	}
+	if tr.Status != transferPending {
+		writeError(w, http.StatusBadRequest, "transfer %s is %s", tr.ID, tr.Status)
+		return
+	}
+	delete(s.state.transfers, tr.ID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// getTransferEvents returns the events of a transfer, oldest first.
+func (s *Server) getTransferEvents(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tr := s.findTransfer(r.userID, r.params["transferID"])
+	if tr == nil {
+		writeError(w, http.StatusNotFound, "transfer not found")
+		return
+	}
+	events := make([]moov.Event, 0)
+	for _, ev := range s.state.events {
+		if ev.userID == r.userID && ev.Resource == tr.ID {
+			events = append(events, ev.Event)
+		}
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+// getTransferFiles returns the ACH file of a transfer in the JSON format of moov-io/ach.
+func (s *Server) getTransferFiles(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tr := s.findTransfer(r.userID, r.params["transferID"])
+	if tr == nil {
+		writeError(w, http.StatusNotFound, "transfer not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, []*ach.File{tr.file})
+}
+
+// Events
+
+// addEvent records an event about a resource. s.mu needs to be held.
+func (s *Server) addEvent(userID, eventType, resource, topic string) {
+	s.state.events = append(s.state.events, &event{
+		userID: userID,
+		Event: moov.Event{
+			ID:       base.ID(),
+			Topic:    topic,
+			Type:     eventType,
+			Resource: resource,
+			Created:  time.Now(),
+		},
+	})
+}
+
+func (s *Server) getEvents(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]moov.Event, 0)
+	for _, ev := range s.state.events {
+		if ev.userID == r.userID {
+			events = append(events, ev.Event)
+		}
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+func (s *Server) getEvent(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ev := range s.state.events {
+		if ev.userID == r.userID && ev.ID == r.params["eventID"] {
+			writeJSON(w, http.StatusOK, ev.Event)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "event not found")
+}
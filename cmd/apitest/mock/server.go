@@ -0,0 +1,275 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+// Package mock is an in-process fake of the Moov API used by apitest for hermetic runs.
+//
+// It implements the auth, paygate, accounts, customers, fed and watchman routes apitest calls
+// (along with the paygate and customers admin routes) and keeps all state in memory. Transfers
+// are written as ACH files into a directory so apitest can verify them like paygate's merged files.
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+// Server is a fake Moov API. Every route is served from one address, which is used as the API
+// address and the paygate / customers admin addresses.
+type Server struct {
+	// URL is the base address of the Server after Start is called.
+	URL string
+
+	// InboundDir is checked for return and NOC files before each request, which are applied to
+	// transfers and depositories and then removed.
+	InboundDir string
+
+	// TokenExpiration is how long OAuth2 access tokens are valid for, an hour by default.
+	TokenExpiration time.Duration
+
+	// MergeDelay is how long transfers stay pending before they're merged, which writes their ACH file
+	// and marks them processed. One second by default.
+	MergeDelay time.Duration
+
+	mergedDir string
+
+	mu    sync.Mutex
+	rand  *rand.Rand
+	state state
+
+	routes []route
+
+	listener net.Listener
+	server   *http.Server
+}
+
+// state holds every object created against the Server
+type state struct {
+	users    map[string]*userRecord // keyed by userID
+	emails   map[string]string      // email -> userID
+	sessions map[string]string      // moov_auth cookie -> userID
+	clients  map[string]*oauthClient
+	tokens   map[string]*oauthToken
+
+	accounts     map[string]*account
+	transactions []moov.Transaction
+	customers    map[string]*customer
+
+	depositories map[string]*depository
+	originators  map[string]*originator
+	receivers    map[string]*receiver
+	transfers    map[string]*transfer
+	events       []*event
+
+	traceNumbers int // last sequence number used in an entry's trace number
+
+	idempotent map[string]*idempotentResponse // keyed by idempotencyKey(..)
+}
+
+// NewServer returns a Server which writes an ACH file for every transfer into mergedDir once it's merged.
+// No files are written if mergedDir is empty.
+func NewServer(mergedDir string) *Server {
+	s := &Server{
+		TokenExpiration: defaultTokenExpiration,
+		MergeDelay:      defaultMergeDelay,
+		mergedDir:       mergedDir,
+		rand:            rand.New(rand.NewSource(time.Now().UnixNano())),
+		state: state{
+			users:        make(map[string]*userRecord),
+			emails:       make(map[string]string),
+			sessions:     make(map[string]string),
+			clients:      make(map[string]*oauthClient),
+			tokens:       make(map[string]*oauthToken),
+			accounts:     make(map[string]*account),
+			customers:    make(map[string]*customer),
+			depositories: make(map[string]*depository),
+			originators:  make(map[string]*originator),
+			receivers:    make(map[string]*receiver),
+			transfers:    make(map[string]*transfer),
+			idempotent:   make(map[string]*idempotentResponse),
+		},
+	}
+	s.addPingRoutes()
+	s.addAuthRoutes()
+	s.addAccountsRoutes()
+	s.addCustomersRoutes()
+	s.addPaygateRoutes()
+	s.addSearchRoutes()
+	return s
+}
+
+// Start listens on a random local port and serves requests in the background.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("mock: %v", err)
+	}
+	s.listener = ln
+	s.server = &http.Server{Handler: s}
+	s.URL = fmt.Sprintf("http://%s", ln.Addr().String())
+	go s.server.Serve(ln)
+	return nil
+}
+
+// Close stops the Server from accepting requests.
+func (s *Server) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+// request is an incoming HTTP request along with its path parameters and the authenticated user.
+type request struct {
+	*http.Request
+
+	params map[string]string
+	userID string
+}
+
+type handlerFunc func(w http.ResponseWriter, r *request)
+
+type route struct {
+	method   string
+	segments []string
+
+	// authenticated routes require a moov_auth cookie or OAuth2 access token
+	authenticated bool
+
+	handler handlerFunc
+}
+
+// handle registers a route. Path segments in braces (e.g. /v1/ach/transfers/{transferID}) are captured as parameters.
+func (s *Server) handle(method, pattern string, authenticated bool, h handlerFunc) {
+	s.routes = append(s.routes, route{
+		method:        method,
+		segments:      strings.Split(strings.Trim(pattern, "/"), "/"),
+		authenticated: authenticated,
+		handler:       h,
+	})
+}
+
+func (rt route) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(rt.segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i := range rt.segments {
+		if strings.HasPrefix(rt.segments[i], "{") && strings.HasSuffix(rt.segments[i], "}") {
+			params[strings.Trim(rt.segments[i], "{}")] = segments[i]
+			continue
+		}
+		if rt.segments[i] != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The Moov API returns CORS headers on every response
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = "*"
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	if id := r.Header.Get("X-Request-ID"); id != "" {
+		w.Header().Set("X-Request-ID", id)
+	}
+
+	s.mu.Lock()
+	s.processInboundFiles()
+	s.mu.Unlock()
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	found := false
+	for _, rt := range s.routes {
+		params, ok := rt.match(segments)
+		if !ok {
+			continue
+		}
+		found = true
+		if rt.method != r.Method {
+			continue
+		}
+		req := &request{Request: r, params: params}
+		if rt.authenticated {
+			userID, ok := s.authenticate(r)
+			if !ok {
+				writeError(w, http.StatusForbidden, "unauthorized request")
+				return
+			}
+			req.userID = userID
+		}
+		s.serveIdempotent(w, req, rt.handler)
+		return
+	}
+	// Like the Moov API's gateway, every other request needs to be authenticated before it's routed
+	if _, ok := s.authenticate(r); !ok {
+		writeError(w, http.StatusForbidden, "unauthorized request")
+		return
+	}
+	if found {
+		writeError(w, http.StatusMethodNotAllowed, "%s not allowed on %s", r.Method, r.URL.Path)
+		return
+	}
+	writeError(w, http.StatusNotFound, "%s not found", r.URL.Path)
+}
+
+func (s *Server) addPingRoutes() {
+	for _, app := range []string{"ach", "accounts", "auth", "customers", "fed", "paygate", "watchman"} {
+		s.handle("GET", fmt.Sprintf("/v1/%s/ping", app), false, func(w http.ResponseWriter, r *request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("PONG"))
+		})
+	}
+}
+
+// addSearchRoutes adds FED and Watchman search routes, which always return empty results.
+func (s *Server) addSearchRoutes() {
+	s.handle("GET", "/v1/fed/ach/search", true, func(w http.ResponseWriter, r *request) {
+		writeJSON(w, http.StatusOK, moov.AchDictionary{})
+	})
+	s.handle("GET", "/v1/watchman/ofac/search", true, func(w http.ResponseWriter, r *request) {
+		writeJSON(w, http.StatusOK, moov.Search{})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, moov.Error{Error: fmt.Sprintf(format, args...)})
+}
+
+func readJSON(r *request, v interface{}) error {
+	if r.Body == nil {
+		return fmt.Errorf("missing request body")
+	}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("problem reading request: %v", err)
+	}
+	return nil
+}
+
+// randomNumber returns a string of n random digits.
+func (s *Server) randomNumber(n int) string {
+	var buf strings.Builder
+	for i := 0; i < n; i++ {
+		buf.WriteByte(byte('0' + s.rand.Intn(10)))
+	}
+	return buf.String()
+}
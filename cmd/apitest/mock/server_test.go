@@ -0,0 +1,489 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moov-io/ach"
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/antihax/optional"
+)
+
+type testClient struct {
+	*moov.APIClient
+	userID string
+}
+
+func newTestClient(t *testing.T, svc *httptest.Server) *testClient {
+	t.Helper()
+
+	conf := moov.NewConfiguration()
+	conf.BasePath = svc.URL
+	conf.HTTPClient = svc.Client()
+	api := moov.NewAPIClient(conf)
+
+	ctx := context.Background()
+	req := moov.CreateUser{Email: "jane@example.com", Password: "secret", FirstName: "Jane", LastName: "Doe", Phone: "555.555.5555"}
+	if _, _, err := api.UserApi.CreateUser(ctx, req, nil); err != nil {
+		t.Fatal(err)
+	}
+	u, resp, err := api.UserApi.UserLogin(ctx, moov.Login{Email: req.Email, Password: req.Password}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range resp.Cookies() {
+		if c.Name == cookieName {
+			conf.AddDefaultHeader("Cookie", fmt.Sprintf("%s=%s", c.Name, c.Value))
+		}
+	}
+	return &testClient{APIClient: api, userID: u.ID}
+}
+
+// verifiedDepository creates an account and Depository for it, which is then verified with micro-deposits.
+func (c *testClient) verifiedDepository(t *testing.T, name string) (*moov.Account, moov.Depository) {
+	t.Helper()
+	ctx := context.Background()
+
+	acct, _, err := c.AccountsApi.CreateAccount(ctx, c.userID, moov.CreateAccount{CustomerID: c.userID, Name: name, Type: "Savings", Balance: 1000}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep, _, err := c.DepositoriesApi.AddDepository(ctx, c.userID, moov.CreateDepository{
+		BankName:      "Moov Bank",
+		Holder:        "Jane Doe",
+		HolderType:    "Individual",
+		Type:          "Savings",
+		RoutingNumber: acct.RoutingNumber,
+		AccountNumber: acct.AccountNumber,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.DepositoriesApi.InitiateMicroDeposits(ctx, dep.ID, c.userID, nil); err != nil {
+		t.Fatal(err)
+	}
+	transactions, _, err := c.AccountsApi.GetAccountTransactions(ctx, acct.ID, c.userID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 2 {
+		t.Fatalf("got %d micro-deposit transactions", len(transactions))
+	}
+
+	// wrong amounts are rejected
+	if _, err := c.DepositoriesApi.ConfirmMicroDeposits(ctx, dep.ID, c.userID, moov.Amounts{Amounts: []string{"USD 1.00", "USD 2.00"}}, nil); err == nil {
+		t.Fatal("expected error")
+	}
+	var amounts moov.Amounts
+	for i := range transactions {
+		amounts.Amounts = append(amounts.Amounts, fmt.Sprintf("USD %.2f", transactions[i].Lines[0].Amount/100))
+	}
+	if _, err := c.DepositoriesApi.ConfirmMicroDeposits(ctx, dep.ID, c.userID, amounts, nil); err != nil {
+		t.Fatal(err)
+	}
+	return &acct, dep
+}
+
+func TestServer__transfer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mock-merged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := NewServer(dir)
+	srv.MergeDelay = time.Hour // transfers are merged below
+	svc := httptest.NewServer(srv)
+	defer svc.Close()
+
+	c := newTestClient(t, svc)
+	ctx := context.Background()
+
+	// micro-deposit origination account
+	if _, _, err := c.AccountsApi.CreateAccount(ctx, c.userID, moov.CreateAccount{Name: "micro-deposits", Number: microDepositAccountNumber, Type: "Savings", Balance: 1000}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	origAcct, origDep := c.verifiedDepository(t, "from")
+	orig, _, err := c.OriginatorsApi.AddOriginator(ctx, c.userID, moov.CreateOriginator{DefaultDepository: origDep.ID, Identification: "123456789", Metadata: "Jane Corp"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recAcct, recDep := c.verifiedDepository(t, "to")
+	rec, _, err := c.ReceiversApi.AddReceivers(ctx, c.userID, moov.CreateReceiver{Email: "john@example.com", DefaultDepository: recDep.ID, Metadata: "John Doe"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := moov.CreateTransfer{
+		TransferType:           "Push",
+		Amount:                 "USD 12.34",
+		Originator:             orig.ID,
+		Receiver:               rec.ID,
+		Description:            "test",
+		StandardEntryClassCode: "PPD",
+	}
+	if _, _, err := c.TransfersApi.AddTransfer(ctx, c.userID, req, nil); err == nil {
+		t.Fatal("expected error as customers are not approved")
+	}
+	for _, customerID := range []string{orig.CustomerID, rec.CustomerID} {
+		r, _ := http.NewRequest("PUT", fmt.Sprintf("%s/customers/%s/status", svc.URL, customerID), strings.NewReader(`{"status": "OFAC"}`))
+		resp, err := svc.Client().Do(r)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("customer status: %v (%#v)", err, resp)
+		}
+		resp.Body.Close()
+	}
+	tr, _, err := c.TransfersApi.AddTransfer(ctx, c.userID, req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both accounts have the transfer posted
+	for _, acct := range []*moov.Account{origAcct, recAcct} {
+		transactions, _, err := c.AccountsApi.GetAccountTransactions(ctx, acct.ID, c.userID, &moov.GetAccountTransactionsOpts{Limit: optional.NewFloat32(1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transactions) != 1 || len(transactions[0].Lines) != 2 || transactions[0].Lines[0].Amount != 1234 {
+			t.Errorf("unexpected transactions: %#v", transactions)
+		}
+	}
+
+	// Transfers are pending until they're merged
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.ach")); len(matches) != 0 || tr.Status != transferPending {
+		t.Fatalf("found %d files for %s transfer", len(matches), tr.Status)
+	}
+	srv.mu.Lock()
+	err = srv.mergeTransfer(srv.state.transfers[tr.ID])
+	srv.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr, _, err := c.TransfersApi.GetTransferByID(ctx, tr.ID, c.userID, nil); err != nil || tr.Status != transferProcessed {
+		t.Fatalf("transfer is %s: %v", tr.Status, err)
+	}
+
+	// Read the ACH file
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.ach"))
+	if len(matches) != 1 {
+		t.Fatalf("found %d files", len(matches))
+	}
+	fd, err := os.Open(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := ach.NewReader(fd).Read()
+	fd.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Header.ImmediateOrigin != origDep.RoutingNumber || file.Header.ImmediateDestination != recDep.RoutingNumber {
+		t.Errorf("unexpected file header: %#v", file.Header)
+	}
+	entries := file.Batches[0].GetEntries()
+	if len(entries) != 1 || entries[0].Amount != 1234 || entries[0].TransactionCode != ach.SavingsCredit {
+		t.Errorf("unexpected entries: %#v", entries)
+	}
+
+	// The transfer's file and events are served
+	r, _ := http.NewRequest("POST", fmt.Sprintf("%s/v1/ach/transfers/%s/files", svc.URL, tr.ID), nil)
+	r.Header.Set("Cookie", c.GetConfig().DefaultHeader["Cookie"])
+	resp, err := svc.Client().Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&files); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(files) != 1 {
+		t.Fatalf("got %d files", len(files))
+	}
+	if f, err := ach.FileFromJSON(files[0]); err != nil || f.Header.ImmediateDestination != recDep.RoutingNumber {
+		t.Errorf("unexpected file: %v (%#v)", err, f)
+	}
+	events, _, err := c.TransfersApi.GetTransferEventsByID(ctx, tr.ID, c.userID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Resource != tr.ID || events[1].Type != transferEvent {
+		t.Errorf("unexpected events: %#v", events)
+	}
+	if _, _, err := c.EventsApi.GetEventByID(ctx, events[0].ID, c.userID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only pending transfers can be deleted
+	if resp, err := c.TransfersApi.DeleteTransferByID(ctx, tr.ID, c.userID, nil); err == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400: %v", err)
+	}
+	pending, _, err := c.TransfersApi.AddTransfer(ctx, c.userID, req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.TransfersApi.DeleteTransferByID(ctx, pending.ID, c.userID, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServer__mergeDelay(t *testing.T) {
+	srv := NewServer("")
+	tr := &transfer{userID: "user", Transfer: moov.Transfer{ID: "transfer", Status: transferPending}}
+	srv.state.transfers[tr.ID] = tr
+	srv.scheduleMerge(tr.ID, 10*time.Millisecond)
+
+	for i := 0; i < 100; i++ {
+		srv.mu.Lock()
+		status := tr.Status
+		srv.mu.Unlock()
+		if status == transferProcessed {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("transfer wasn't merged")
+}
+
+func TestServer__microDepositAttempts(t *testing.T) {
+	svc := httptest.NewServer(NewServer(""))
+	defer svc.Close()
+
+	c := newTestClient(t, svc)
+	ctx := context.Background()
+
+	if _, _, err := c.AccountsApi.CreateAccount(ctx, c.userID, moov.CreateAccount{Name: "micro-deposits", Number: microDepositAccountNumber, Type: "Savings", Balance: 1000}, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, dep := c.verifiedDepository(t, "verified")
+
+	// verified depositories can't be confirmed or sent micro-deposits again
+	resp, err := c.DepositoriesApi.ConfirmMicroDeposits(ctx, dep.ID, c.userID, moov.Amounts{Amounts: []string{"USD 0.01"}}, nil)
+	if err == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400: %v", err)
+	}
+	resp, err = c.DepositoriesApi.InitiateMicroDeposits(ctx, dep.ID, c.userID, nil)
+	if err == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400: %v", err)
+	}
+
+	// too many incorrect attempts reject the depository
+	dep, _, err = c.DepositoriesApi.AddDepository(ctx, c.userID, moov.CreateDepository{
+		BankName:      "Moov Bank",
+		Holder:        "Jane Doe",
+		HolderType:    "Individual",
+		Type:          "Savings",
+		RoutingNumber: "121042882",
+		AccountNumber: "987654321",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.DepositoriesApi.InitiateMicroDeposits(ctx, dep.ID, c.userID, nil); err != nil {
+		t.Fatal(err)
+	}
+	wrong := moov.Amounts{Amounts: []string{"USD 1.00", "USD 2.00"}}
+	for i := 1; i <= maxMicroDepositAttempts; i++ {
+		if _, err := c.DepositoriesApi.ConfirmMicroDeposits(ctx, dep.ID, c.userID, wrong, nil); err == nil {
+			t.Fatalf("attempt %d: expected error", i)
+		}
+		dep, _, err = c.DepositoriesApi.GetDepositoryByID(ctx, dep.ID, c.userID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < maxMicroDepositAttempts && dep.Status != statusUnverified {
+			t.Errorf("attempt %d: depository is %s", i, dep.Status)
+		}
+	}
+	if dep.Status != statusRejected {
+		t.Errorf("depository is %s", dep.Status)
+	}
+}
+
+func TestServer__oauthTokenExpiration(t *testing.T) {
+	srv := NewServer("")
+	srv.TokenExpiration = 50 * time.Millisecond
+	svc := httptest.NewServer(srv)
+	defer svc.Close()
+
+	c := newTestClient(t, svc)
+	ctx := context.Background()
+
+	clients, _, err := c.OAuth2Api.CreateOAuth2Client(ctx, nil)
+	if err != nil || len(clients) != 1 {
+		t.Fatalf("clients=%#v error=%v", clients, err)
+	}
+	token, _, err := c.OAuth2Api.CreateOAuth2Token(ctx, &moov.CreateOAuth2TokenOpts{
+		GrantType:    optional.NewString("client_credentials"),
+		ClientId:     optional.NewString(clients[0].ClientId),
+		ClientSecret: optional.NewString(clients[0].ClientSecret),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.ExpiresIn != 1 {
+		t.Errorf("expires_in=%d", token.ExpiresIn)
+	}
+	if _, err := c.OAuth2Api.CheckOAuthClientCredentials(ctx, "Bearer "+token.AccessToken, nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	resp, err := c.OAuth2Api.CheckOAuthClientCredentials(ctx, "Bearer "+token.AccessToken, nil)
+	if err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected expired token to be forbidden: %v", err)
+	}
+}
+
+func TestServer__idempotency(t *testing.T) {
+	svc := httptest.NewServer(NewServer(""))
+	defer svc.Close()
+
+	c := newTestClient(t, svc)
+	ctx := context.Background()
+
+	req := moov.CreateDepository{
+		BankName:      "Moov Bank",
+		Holder:        "Jane Doe",
+		HolderType:    "Individual",
+		Type:          "Savings",
+		RoutingNumber: "121042882",
+		AccountNumber: "987654321",
+	}
+	opts := &moov.AddDepositoryOpts{XIdempotencyKey: optional.NewString("key")}
+	first, _, err := c.DepositoriesApi.AddDepository(ctx, c.userID, req, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, resp, err := c.DepositoriesApi.AddDepository(ctx, c.userID, req, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != second.ID || resp.StatusCode != http.StatusOK {
+		t.Errorf("replay returned %s (%s), first request created %s", second.ID, resp.Status, first.ID)
+	}
+	if deps, _, err := c.DepositoriesApi.GetDepositories(ctx, c.userID, nil); err != nil || len(deps) != 1 {
+		t.Errorf("got %d depositories: %v", len(deps), err)
+	}
+
+	// another key creates another depository
+	third, _, err := c.DepositoriesApi.AddDepository(ctx, c.userID, req, &moov.AddDepositoryOpts{XIdempotencyKey: optional.NewString("other")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.ID == first.ID {
+		t.Errorf("different key returned depository %s", first.ID)
+	}
+}
+
+func TestServer__idempotencyKey(t *testing.T) {
+	r := &request{Request: httptest.NewRequest("POST", "/v1/ach/depositories", nil), userID: "jane"}
+	if key := idempotencyKey(r); key != "" {
+		t.Errorf("requests without X-Idempotency-Key aren't saved: %q", key)
+	}
+	r.Header.Set("X-Idempotency-Key", "key")
+	key := idempotencyKey(r)
+	if key == "" {
+		t.Fatal("expected key")
+	}
+
+	// keys are scoped to users and routes
+	other := &request{Request: r.Clone(context.Background()), userID: "john"}
+	if idempotencyKey(other) == key {
+		t.Error("users share X-Idempotency-Key")
+	}
+	other = &request{Request: httptest.NewRequest("POST", "/v1/ach/originators", nil), userID: "jane"}
+	other.Header.Set("X-Idempotency-Key", "key")
+	if idempotencyKey(other) == key {
+		t.Error("routes share X-Idempotency-Key")
+	}
+
+	// reads aren't saved
+	r.Method = "GET"
+	if key := idempotencyKey(r); key != "" {
+		t.Errorf("GET requests aren't saved: %q", key)
+	}
+}
+
+func TestServer__auth(t *testing.T) {
+	svc := httptest.NewServer(NewServer(""))
+	defer svc.Close()
+
+	c := newTestClient(t, svc)
+	ctx := context.Background()
+
+	// OAuth2 access tokens
+	clients, _, err := c.OAuth2Api.CreateOAuth2Client(ctx, nil)
+	if err != nil || len(clients) != 1 {
+		t.Fatalf("clients=%#v error=%v", clients, err)
+	}
+	token, _, err := c.OAuth2Api.CreateOAuth2Token(ctx, &moov.CreateOAuth2TokenOpts{
+		GrantType:    optional.NewString("client_credentials"),
+		ClientId:     optional.NewString(clients[0].ClientId),
+		ClientSecret: optional.NewString(clients[0].ClientSecret),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.OAuth2Api.CheckOAuthClientCredentials(ctx, "Bearer "+token.AccessToken, nil); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.OAuth2Api.CheckOAuthClientCredentials(ctx, "Bearer invalid", nil)
+	if err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected forbidden: %v", err)
+	}
+
+	// Invalid login
+	_, resp, err = c.UserApi.UserLogin(ctx, moov.Login{Email: "jane@example.com", Password: "other"}, nil)
+	if err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected forbidden: %v", err)
+	}
+
+	// X-User-Id alone doesn't authenticate
+	r, _ := http.NewRequest("GET", svc.URL+"/v1/ach/depositories", nil)
+	r.Header.Set("X-User-Id", c.userID)
+	r.Header.Set("X-Request-ID", "request")
+	r.Header.Set("Origin", "https://moov.io")
+	resp, err = svc.Client().Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("got %s", resp.Status)
+	}
+	if v := resp.Header.Get("Access-Control-Allow-Origin"); v != "https://moov.io" {
+		t.Errorf("unexpected CORS header: %q", v)
+	}
+	if v := resp.Header.Get("X-Request-ID"); v != "request" {
+		t.Errorf("X-Request-ID wasn't echoed: %q", v)
+	}
+}
+
+func TestServer__parseAmount(t *testing.T) {
+	if n, err := parseAmount("USD 12.34"); err != nil || n != 1234 {
+		t.Errorf("n=%d error=%v", n, err)
+	}
+	if n, err := parseAmount("USD 0.29"); err != nil || n != 29 {
+		t.Errorf("n=%d error=%v", n, err)
+	}
+	for _, amt := range []string{"12.34", "EUR 1.00", "USD -1.00", "USD abc"} {
+		if _, err := parseAmount(amt); err == nil {
+			t.Errorf("expected error for %q", amt)
+		}
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 
 	moov "github.com/moov-io/go-client/client"
@@ -17,16 +16,38 @@ import (
 	"github.com/antihax/optional"
 )
 
-func setMoovOAuthToken(conf *moov.Configuration, oauthToken *moov.OAuth2Token) {
+func setMoovOAuthToken(conf *moov.Configuration, oauthToken *moov.OAuth2Token) error {
 	if oauthToken == nil || oauthToken.AccessToken == "" {
-		log.Fatal("FAILURE: No OAuth token provided")
-	} else {
-		conf.AddDefaultHeader("Authorization", fmt.Sprintf("Bearer %s", oauthToken.AccessToken))
+		return errors.New("no OAuth token provided")
 	}
+	conf.AddDefaultHeader("Authorization", fmt.Sprintf("Bearer %s", oauthToken.AccessToken))
+	return nil
+}
+
+func createOAuthToken(ctx context.Context, api *moov.APIClient, u *user) (*moov.OAuth2Client, *moov.OAuth2Token, error) {
+	client, err := createOAuthClient(ctx, api)
+	if err != nil {
+		return nil, nil, err
+	}
+	token, err := createOAuthClientToken(ctx, api, client)
+	if err != nil {
+		return client, nil, err
+	}
+
+	// Verify OAuth access token works
+	accessToken := fmt.Sprintf("Bearer %s", token.AccessToken)
+	resp, err := api.OAuth2Api.CheckOAuthClientCredentials(ctx, accessToken, &moov.CheckOAuthClientCredentialsOpts{})
+	if resp != nil {
+		resp.Body.Close()
+		if err := checkCORSHeaders(resp); err != nil {
+			return client, nil, fmt.Errorf("check oauth credentials: %v", err)
+		}
+	}
+	return client, token, err
 }
 
-func createOAuthToken(ctx context.Context, api *moov.APIClient, u *user) (*moov.OAuth2Token, error) {
-	// Create OAuth client credentials
+// createOAuthClient creates OAuth client credentials for the user api is authenticated as.
+func createOAuthClient(ctx context.Context, api *moov.APIClient) (*moov.OAuth2Client, error) {
 	clients, resp, err := api.OAuth2Api.CreateOAuth2Client(ctx, &moov.CreateOAuth2ClientOpts{
 		XIdempotencyKey: optional.NewString(generateID()),
 	})
@@ -37,15 +58,17 @@ func createOAuthToken(ctx context.Context, api *moov.APIClient, u *user) (*moov.
 		}
 	}
 	if err != nil {
-		return nil, fmt.Errorf("problem creating user: %v", err)
+		return nil, fmt.Errorf("problem creating oauth client: %v", err)
 	}
 
 	if len(clients) == 0 {
 		return nil, errors.New("no OAuth2 clients created")
 	}
-	client := clients[0]
+	return &clients[0], nil
+}
 
-	// Generate OAuth2 Token
+// createOAuthClientToken generates an OAuth2 access token from client's credentials.
+func createOAuthClientToken(ctx context.Context, api *moov.APIClient, client *moov.OAuth2Client) (*moov.OAuth2Token, error) {
 	token, resp, err := api.OAuth2Api.CreateOAuth2Token(ctx, &moov.CreateOAuth2TokenOpts{
 		XIdempotencyKey: optional.NewString(generateID()),
 		GrantType:       optional.NewString("client_credentials"),
@@ -59,22 +82,12 @@ func createOAuthToken(ctx context.Context, api *moov.APIClient, u *user) (*moov.
 		}
 	}
 	if err != nil {
-		return nil, fmt.Errorf("problem creating user: %v", err)
+		return nil, fmt.Errorf("problem creating oauth token: %v", err)
 	}
 	if token.AccessToken == "" {
 		return nil, errors.New("no OAuth2 access token created")
 	}
-
-	// Verify OAuth access token works
-	accessToken := fmt.Sprintf("Bearer %s", token.AccessToken)
-	resp, err = api.OAuth2Api.CheckOAuthClientCredentials(ctx, accessToken, &moov.CheckOAuthClientCredentialsOpts{})
-	if resp != nil {
-		resp.Body.Close()
-		if err := checkCORSHeaders(resp); err != nil {
-			return nil, fmt.Errorf("check oauth credentials: %v", err)
-		}
-	}
-	return &token, err
+	return &token, nil
 }
 
 // attemptFailedOAuth2Login will try with a OAuth2 access token to ensure failed credentials don't authenticate a request.
@@ -0,0 +1,123 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+// oauthRefreshMargin is the most time before an access token expires that it's re-issued. Shorter lived
+// tokens are re-issued once 90% of their lifetime has passed.
+const oauthRefreshMargin = time.Minute
+
+// oauthTokenSource hands out an access token from OAuth2 client credentials and re-issues it before
+// it expires, so long running modes (like -fake-data, -load and -daemon) keep working with -oauth.
+type oauthTokenSource struct {
+	// api is used to generate tokens, it must not send requests through the source's own transport
+	api    *moov.APIClient
+	client moov.OAuth2Client
+	logf   func(tpl string, args ...interface{})
+
+	now func() time.Time
+
+	mu        sync.Mutex
+	token     *moov.OAuth2Token
+	refreshAt time.Time
+}
+
+// newOAuthTokenSource returns a source which starts out with token, issued from client just now.
+func newOAuthTokenSource(api *moov.APIClient, client moov.OAuth2Client, token *moov.OAuth2Token, logf func(string, ...interface{})) *oauthTokenSource {
+	src := &oauthTokenSource{
+		api:    api,
+		client: client,
+		logf:   logf,
+		now:    time.Now,
+	}
+	src.set(token)
+	return src
+}
+
+// set saves token and when it needs to be re-issued, callers must hold s.mu (or not have shared s yet).
+// Tokens without an expires_in are never re-issued.
+func (s *oauthTokenSource) set(token *moov.OAuth2Token) {
+	s.token = token
+	s.refreshAt = time.Time{}
+	if token.ExpiresIn <= 0 {
+		return
+	}
+	lifetime := time.Duration(token.ExpiresIn) * time.Second
+	margin := lifetime / 10
+	if margin > oauthRefreshMargin {
+		margin = oauthRefreshMargin
+	}
+	s.refreshAt = s.now().Add(lifetime - margin)
+}
+
+// Token returns the current access token, re-issuing it first when it's about to expire.
+func (s *oauthTokenSource) Token(ctx context.Context) (*moov.OAuth2Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != nil && (s.refreshAt.IsZero() || s.now().Before(s.refreshAt)) {
+		return s.token, nil
+	}
+	token, err := createOAuthClientToken(ctx, s.api, &s.client)
+	if err != nil {
+		return nil, fmt.Errorf("problem refreshing oauth token: %v", err)
+	}
+	s.set(token)
+	if s.logf != nil {
+		s.logf("INFO: Refreshed OAuth access token, expires in %v", time.Duration(token.ExpiresIn)*time.Second)
+	}
+	return token, nil
+}
+
+// useOAuthTokenSource sends each of iter's requests with an access token from client, starting with token.
+func useOAuthTokenSource(iter *iteration, client *moov.OAuth2Client, token *moov.OAuth2Token) {
+	// Tokens are re-issued with their own API client so those requests don't need a token themselves
+	conf := makeConfiguration()
+	conf.AddDefaultHeader("X-Request-ID", iter.requestID)
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+
+	source := newOAuthTokenSource(moov.NewAPIClient(conf), *client, token, iter.logf)
+	iter.conf.HTTPClient.Transport = source.wrap(iter.conf.HTTPClient.Transport)
+}
+
+// wrap returns a transport which sends the current access token on every request that doesn't already
+// have an Authorization header, so steps can still check how other credentials are handled.
+func (s *oauthTokenSource) wrap(underlying http.RoundTripper) http.RoundTripper {
+	if underlying == nil {
+		underlying = http.DefaultTransport
+	}
+	return &oauthTransport{
+		underlying: underlying,
+		source:     s,
+	}
+}
+
+type oauthTransport struct {
+	underlying http.RoundTripper
+	source     *oauthTokenSource
+}
+
+func (t *oauthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, exists := req.Header["Authorization"]; exists {
+		return t.underlying.RoundTrip(req)
+	}
+	token, err := t.source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	// http.RoundTripper implementations shouldn't modify the request they're given
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.AccessToken))
+	return t.underlying.RoundTrip(req)
+}
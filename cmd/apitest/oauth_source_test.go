@@ -0,0 +1,111 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+func TestOAuthTokenSource(t *testing.T) {
+	issued := 0
+	var authorizations []string
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		switch r.URL.Path {
+		case "/v1/oauth2/token":
+			if id := r.URL.Query().Get("client_id"); id != "client" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			issued++
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(moov.OAuth2Token{
+				AccessToken: fmt.Sprintf("token%d", issued),
+				ExpiresIn:   600,
+			})
+		default:
+			authorizations = append(authorizations, r.Header.Get("Authorization"))
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer svc.Close()
+
+	conf := moov.NewConfiguration()
+	conf.BasePath = svc.URL
+	client := moov.OAuth2Client{ClientId: "client", ClientSecret: "secret"}
+
+	now := time.Now()
+	source := newOAuthTokenSource(moov.NewAPIClient(conf), client, &moov.OAuth2Token{AccessToken: "token0", ExpiresIn: 600}, nil)
+	source.now = func() time.Time { return now }
+	source.set(source.token) // from our clock
+
+	httpClient := &http.Client{Transport: source.wrap(nil)}
+	send := func() {
+		t.Helper()
+		resp, err := httpClient.Get(svc.URL + "/v1/oauth2/authorize")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	// tokens are re-issued one minute before they expire
+	send()
+	now = now.Add(8 * time.Minute)
+	send()
+	now = now.Add(time.Minute)
+	send()
+	send()
+
+	expected := []string{"Bearer token0", "Bearer token0", "Bearer token1", "Bearer token1"}
+	if fmt.Sprintf("%v", authorizations) != fmt.Sprintf("%v", expected) {
+		t.Errorf("got %v, expected %v", authorizations, expected)
+	}
+	if issued != 1 {
+		t.Errorf("issued %d tokens", issued)
+	}
+
+	// requests with their own credentials are left alone
+	req, _ := http.NewRequest("GET", svc.URL+"/v1/oauth2/authorize", nil)
+	req.Header.Set("Authorization", "Bearer other")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if auth := authorizations[len(authorizations)-1]; auth != "Bearer other" {
+		t.Errorf("sent Authorization: %s", auth)
+	}
+
+	// short lived tokens are re-issued after 90% of their lifetime
+	source.set(&moov.OAuth2Token{AccessToken: "token", ExpiresIn: 10})
+	if d := source.refreshAt.Sub(now); d != 9*time.Second {
+		t.Errorf("refreshing after %v", d)
+	}
+
+	// tokens without an expiry are kept
+	source.set(&moov.OAuth2Token{AccessToken: "token", ExpiresIn: 0})
+	now = now.Add(24 * time.Hour)
+	if token, err := source.Token(context.Background()); err != nil || token.AccessToken != "token" {
+		t.Errorf("token=%#v error=%v", token, err)
+	}
+
+	// problems re-issuing tokens are returned
+	source.client.ClientId = "other"
+	source.set(&moov.OAuth2Token{AccessToken: "token", ExpiresIn: 1})
+	now = now.Add(time.Second)
+	if _, err := source.Token(context.Background()); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/antihax/optional"
+)
+
+var (
+	flagOAuthTokenExpiry = flag.Duration("oauth.token-expiry", 0, "Longest OAuth2 access tokens may be valid for, the oauth-tokens scenario waits for one to expire when set (the mock issues tokens which expire after it)")
+)
+
+// oauthTokenCount is how many access tokens are generated from one OAuth2 client.
+const oauthTokenCount = 3
+
+func init() {
+	registerScenario(&scenario{
+		name: "oauth-tokens",
+		steps: []*step{
+			featuresStep,
+			userStep,
+			oauthStep,
+			oauthClientsStep,
+			oauthMultipleTokensStep,
+			oauthMalformedAuthorizationStep,
+			oauthTokenExpiryStep,
+		},
+	})
+}
+
+var (
+	// oauthClientsStep creates another OAuth2 client and checks it's listed for the user.
+	oauthClientsStep = &step{
+		name:      "oauth-clients",
+		dependsOn: []string{"oauth"},
+		run: func(ctx context.Context, iter *iteration) error {
+			before, err := listOAuthClients(ctx, iter.api)
+			if err != nil {
+				return err
+			}
+			client, err := createOAuthClient(ctx, iter.api)
+			if err != nil {
+				return err
+			}
+			iter.track("oauth-client", client.ClientId, nil)
+			if client.ClientSecret == "" {
+				return fmt.Errorf("OAuth2 client %s has no secret", client.ClientId)
+			}
+
+			after, err := listOAuthClients(ctx, iter.api)
+			if err != nil {
+				return err
+			}
+			if len(after) != len(before)+1 {
+				return fmt.Errorf("listed %d OAuth2 clients after creating one, expected %d", len(after), len(before)+1)
+			}
+			for i := range after {
+				if after[i].ClientId == client.ClientId {
+					iter.logf("SUCCESS: Listed %d OAuth2 clients for user", len(after))
+					return nil
+				}
+			}
+			return fmt.Errorf("OAuth2 client %s wasn't listed", client.ClientId)
+		},
+	}
+
+	// oauthMultipleTokensStep generates several access tokens from one client, each of which must stay
+	// valid after newer ones are generated. Tokens can't be generated with the wrong secret.
+	oauthMultipleTokensStep = &step{
+		name:      "oauth-multiple-tokens",
+		dependsOn: []string{"oauth"},
+		run: func(ctx context.Context, iter *iteration) error {
+			client, err := createOAuthClient(ctx, iter.api)
+			if err != nil {
+				return err
+			}
+			iter.track("oauth-client", client.ClientId, nil)
+
+			var tokens []*moov.OAuth2Token
+			for i := 0; i < oauthTokenCount; i++ {
+				token, err := createOAuthClientToken(ctx, iter.api, client)
+				if err != nil {
+					return fmt.Errorf("token %d: %v", i+1, err)
+				}
+				if token.ExpiresIn <= 0 {
+					return fmt.Errorf("token %d: expires_in is %d", i+1, token.ExpiresIn)
+				}
+				for j := range tokens {
+					if tokens[j].AccessToken == token.AccessToken {
+						return fmt.Errorf("token %d: same access token as token %d", i+1, j+1)
+					}
+				}
+				tokens = append(tokens, token)
+			}
+			for i := range tokens {
+				resp, err := checkOAuthAuthorization(ctx, iter.api, "Bearer "+tokens[i].AccessToken)
+				if err != nil {
+					return fmt.Errorf("token %d stopped working after %d were generated: %v", i+1, len(tokens), err)
+				}
+				resp.Body.Close()
+			}
+			iter.logf("SUCCESS: Generated %d OAuth access tokens from one client, all are valid", len(tokens))
+
+			_, resp, err := iter.api.OAuth2Api.CreateOAuth2Token(ctx, &moov.CreateOAuth2TokenOpts{
+				XIdempotencyKey: optional.NewString(generateID()),
+				GrantType:       optional.NewString("client_credentials"),
+				ClientId:        optional.NewString(client.ClientId),
+				ClientSecret:    optional.NewString(generateID()),
+			})
+			if err := expectOAuthRejected(resp, err, http.StatusBadRequest); err != nil {
+				return fmt.Errorf("token from the wrong client secret: %v", err)
+			}
+			iter.logf("SUCCESS: OAuth access token wasn't generated with the wrong client secret")
+			return nil
+		},
+	}
+
+	// oauthMalformedAuthorizationStep sends broken Authorization headers, built from a valid token, which
+	// must all be rejected.
+	oauthMalformedAuthorizationStep = &step{
+		name:      "oauth-malformed-authorization",
+		dependsOn: []string{"oauth"},
+		run: func(ctx context.Context, iter *iteration) error {
+			var failures []string
+			for _, auth := range malformedAuthorizations(iter.oauthToken.AccessToken) {
+				resp, err := checkOAuthAuthorization(ctx, iter.api, auth.header)
+				if err := expectOAuthRejected(resp, err); err != nil {
+					failures = append(failures, fmt.Sprintf("%s: %v", auth.name, err))
+				}
+			}
+			if len(failures) > 0 {
+				return fmt.Errorf("%d malformed Authorization headers weren't rejected:\n  %s", len(failures), strings.Join(failures, "\n  "))
+			}
+
+			// the token itself still works
+			resp, err := checkOAuthAuthorization(ctx, iter.api, "Bearer "+iter.oauthToken.AccessToken)
+			if err != nil {
+				return fmt.Errorf("valid OAuth access token was rejected: %v", err)
+			}
+			resp.Body.Close()
+			iter.logf("SUCCESS: malformed Authorization headers were rejected")
+			return nil
+		},
+	}
+
+	// oauthTokenExpiryStep waits for a new access token to expire, as given by its expires_in, and checks it's
+	// rejected. Tokens must not be valid for longer than -oauth.token-expiry.
+	oauthTokenExpiryStep = &step{
+		name:      "oauth-token-expiry",
+		dependsOn: []string{"oauth"},
+		run: func(ctx context.Context, iter *iteration) error {
+			if *flagOAuthTokenExpiry <= 0 {
+				iter.logf("INFO: not waiting for an OAuth access token to expire, set -oauth.token-expiry")
+				return nil
+			}
+			client, err := createOAuthClient(ctx, iter.api)
+			if err != nil {
+				return err
+			}
+			iter.track("oauth-client", client.ClientId, nil)
+			token, err := createOAuthClientToken(ctx, iter.api, client)
+			if err != nil {
+				return err
+			}
+			resp, err := checkOAuthAuthorization(ctx, iter.api, "Bearer "+token.AccessToken)
+			if err != nil {
+				return fmt.Errorf("new OAuth access token was rejected: %v", err)
+			}
+			resp.Body.Close()
+
+			wait, err := oauthTokenExpiryWait(token, *flagOAuthTokenExpiry)
+			if err != nil {
+				return err
+			}
+			iter.logf("INFO: waiting %v for OAuth access token to expire (expires_in=%d)", wait, token.ExpiresIn)
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			resp, err = checkOAuthAuthorization(ctx, iter.api, "Bearer "+token.AccessToken)
+			if err := expectOAuthRejected(resp, err); err != nil {
+				return fmt.Errorf("expired OAuth access token: %v", err)
+			}
+			iter.logf("SUCCESS: expired OAuth access token was rejected")
+			return nil
+		},
+	}
+)
+
+// oauthTokenExpiryWait returns how long to wait for token to expire, which must be within limit.
+func oauthTokenExpiryWait(token *moov.OAuth2Token, limit time.Duration) (time.Duration, error) {
+	if token.ExpiresIn <= 0 {
+		return 0, fmt.Errorf("OAuth access token has expires_in=%d", token.ExpiresIn)
+	}
+	expiresIn := time.Duration(token.ExpiresIn) * time.Second
+	limit = (limit + time.Second - 1).Truncate(time.Second) // expires_in is in whole seconds
+	if expiresIn > limit {
+		return 0, fmt.Errorf("OAuth access token expires in %v, longer than -oauth.token-expiry=%v", expiresIn, limit)
+	}
+	return expiresIn + time.Second, nil // allow for clock drift
+}
+
+func listOAuthClients(ctx context.Context, api *moov.APIClient) ([]moov.OAuth2Client, error) {
+	clients, resp, err := api.OAuth2Api.GetClientsForUserId(ctx, &moov.GetClientsForUserIdOpts{})
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("problem listing oauth clients: %v", err)
+	}
+	return clients, nil
+}
+
+// checkOAuthAuthorization asks the Moov API whether an Authorization header is valid.
+func checkOAuthAuthorization(ctx context.Context, api *moov.APIClient, authorization string) (*http.Response, error) {
+	return api.OAuth2Api.CheckOAuthClientCredentials(ctx, authorization, &moov.CheckOAuthClientCredentialsOpts{})
+}
+
+// expectOAuthRejected accepts a 401 or 403 response, along with any other status codes given.
+func expectOAuthRejected(resp *http.Response, err error, statusCodes ...int) error {
+	if resp == nil {
+		if err == nil {
+			err = errors.New("no response")
+		}
+		return err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil
+	}
+	for _, code := range statusCodes {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	return fmt.Errorf("got HTTP status %s", resp.Status)
+}
+
+type malformedAuthorization struct {
+	name   string
+	header string
+}
+
+// malformedAuthorizations returns Authorization headers which are close to, but aren't, a valid
+// bearer token header for accessToken.
+func malformedAuthorizations(accessToken string) []malformedAuthorization {
+	tampered := []byte(accessToken)
+	if len(tampered) > 0 {
+		tampered[len(tampered)-1] ^= 1
+	}
+	return []malformedAuthorization{
+		{"empty", ""},
+		{"scheme only", "Bearer"},
+		{"empty token", "Bearer "},
+		{"no scheme", accessToken},
+		{"basic scheme", "Basic " + accessToken},
+		{"tampered token", "Bearer " + string(tampered)},
+		{"truncated token", "Bearer " + accessToken[:len(accessToken)/2]},
+		{"extra value", fmt.Sprintf("Bearer %s %s", accessToken, accessToken)},
+	}
+}
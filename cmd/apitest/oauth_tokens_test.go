@@ -0,0 +1,80 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+func TestOAuthTokens__malformedAuthorizations(t *testing.T) {
+	token := "5cf7756cdccdc6c23aa1a9b4eef4047cea572906"
+	valid := "Bearer " + token
+
+	seen := make(map[string]bool)
+	for _, auth := range malformedAuthorizations(token) {
+		if auth.header == valid {
+			t.Errorf("%s: is the valid header", auth.name)
+		}
+		if seen[auth.header] {
+			t.Errorf("%s: duplicate header %q", auth.name, auth.header)
+		}
+		seen[auth.header] = true
+	}
+	if len(seen) < 5 {
+		t.Errorf("only %d malformed headers", len(seen))
+	}
+}
+
+func TestOAuthTokens__expectOAuthRejected(t *testing.T) {
+	response := func(code int) *http.Response {
+		return &http.Response{StatusCode: code, Status: http.StatusText(code), Body: http.NoBody}
+	}
+	if err := expectOAuthRejected(response(http.StatusForbidden), errors.New("403")); err != nil {
+		t.Error(err)
+	}
+	if err := expectOAuthRejected(response(http.StatusUnauthorized), errors.New("401")); err != nil {
+		t.Error(err)
+	}
+	if err := expectOAuthRejected(response(http.StatusOK), nil); err == nil || !strings.Contains(err.Error(), "got HTTP status OK") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := expectOAuthRejected(response(http.StatusBadRequest), errors.New("400")); err == nil {
+		t.Error("expected error")
+	}
+	if err := expectOAuthRejected(response(http.StatusBadRequest), errors.New("400"), http.StatusBadRequest); err != nil {
+		t.Error(err)
+	}
+	if err := expectOAuthRejected(nil, errors.New("connection refused")); err == nil || err.Error() != "connection refused" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestOAuthTokens__oauthTokenExpiryWait(t *testing.T) {
+	// we wait on the token's expires_in, plus a second of clock drift
+	wait, err := oauthTokenExpiryWait(&moov.OAuth2Token{ExpiresIn: 2}, time.Hour)
+	if err != nil || wait != 3*time.Second {
+		t.Errorf("wait=%v error=%v", wait, err)
+	}
+
+	// -oauth.token-expiry is rounded up to whole seconds, like expires_in
+	wait, err = oauthTokenExpiryWait(&moov.OAuth2Token{ExpiresIn: 2}, 1500*time.Millisecond)
+	if err != nil || wait != 3*time.Second {
+		t.Errorf("wait=%v error=%v", wait, err)
+	}
+
+	// tokens can't outlive -oauth.token-expiry
+	if _, err := oauthTokenExpiryWait(&moov.OAuth2Token{ExpiresIn: 3600}, time.Minute); err == nil || !strings.Contains(err.Error(), "expires in 1h0m0s, longer than -oauth.token-expiry=1m0s") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := oauthTokenExpiryWait(&moov.OAuth2Token{}, time.Minute); err == nil || !strings.Contains(err.Error(), "expires_in=0") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
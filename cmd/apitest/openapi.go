@@ -0,0 +1,455 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	flagOpenAPISpec = flag.String("openapi.spec", "", "Filepath or URL of openapi.yaml (written by cmd/writeVersions) to validate every request and response against")
+
+	// openapi validates requests and responses against -openapi.spec, it's nil unless the flag is set.
+	openapi *openapiValidator
+)
+
+// openapiDocument is a YAML (or JSON) file which is either the spec or referenced by it.
+type openapiDocument struct {
+	// location is a filepath or URL, relative $ref's are resolved against it
+	location string
+	root     interface{}
+}
+
+// specNode is a value from the spec along with the document it was read from.
+type specNode struct {
+	doc   *openapiDocument
+	value interface{}
+}
+
+func (n specNode) isNull() bool {
+	return n.value == nil
+}
+
+func (n specNode) object() map[string]interface{} {
+	m, _ := n.value.(map[string]interface{})
+	return m
+}
+
+func (n specNode) list() []interface{} {
+	l, _ := n.value.([]interface{})
+	return l
+}
+
+func (n specNode) str(key string) string {
+	s, _ := n.object()[key].(string)
+	return s
+}
+
+func (n specNode) boolean(key string) bool {
+	b, _ := n.object()[key].(bool)
+	return b
+}
+
+// openapiSpec is an OpenAPI 3 spec whose $ref's (including the remote ones openapi.yaml uses for
+// each application's routes) are loaded as they're needed.
+type openapiSpec struct {
+	client *http.Client
+	root   *openapiDocument
+
+	mu   sync.Mutex
+	docs map[string]*openapiDocument
+	errs map[string]error // documents which failed to load aren't retried
+}
+
+func loadOpenAPISpec(location string, client *http.Client) (*openapiSpec, error) {
+	spec := &openapiSpec{
+		client: client,
+		docs:   make(map[string]*openapiDocument),
+		errs:   make(map[string]error),
+	}
+	doc, err := spec.load(location)
+	if err != nil {
+		return nil, err
+	}
+	spec.root = doc
+	if spec.paths().object() == nil {
+		return nil, fmt.Errorf("no paths found in %s", location)
+	}
+	return spec, nil
+}
+
+func (s *openapiSpec) load(location string) (*openapiDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if doc, exists := s.docs[location]; exists {
+		return doc, nil
+	}
+	if err, exists := s.errs[location]; exists {
+		return nil, err
+	}
+	doc, err := s.read(location)
+	if err != nil {
+		err = fmt.Errorf("problem loading %s: %v", location, err)
+		s.errs[location] = err
+		return nil, err
+	}
+	s.docs[location] = doc
+	return doc, nil
+}
+
+func (s *openapiSpec) read(location string) (*openapiDocument, error) {
+	var bs []byte
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		resp, err := s.client.Get(location)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+		}
+		if bs, err = ioutil.ReadAll(resp.Body); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if bs, err = ioutil.ReadFile(location); err != nil {
+			return nil, err
+		}
+	}
+	var root interface{}
+	if err := yaml.Unmarshal(bs, &root); err != nil {
+		return nil, err
+	}
+	return &openapiDocument{location: location, root: normalizeYAML(root)}, nil
+}
+
+// resolve follows n's $ref's until a value without one is found.
+func (s *openapiSpec) resolve(n specNode) (specNode, error) {
+	for i := 0; i < 25; i++ {
+		ref := n.str("$ref")
+		if ref == "" {
+			return n, nil
+		}
+		location, pointer := ref, ""
+		if idx := strings.Index(ref, "#"); idx >= 0 {
+			location, pointer = ref[:idx], ref[idx+1:]
+		}
+		doc := n.doc
+		if location != "" {
+			var err error
+			if doc, err = s.load(relativeLocation(n.doc.location, location)); err != nil {
+				return n, err
+			}
+		}
+		value, err := followPointer(doc.root, pointer)
+		if err != nil {
+			return n, fmt.Errorf("$ref %s: %v", ref, err)
+		}
+		n = specNode{doc: doc, value: value}
+	}
+	return n, fmt.Errorf("too many nested $ref's")
+}
+
+// field returns the resolved child of a resolved node, which is null when it doesn't exist.
+func (s *openapiSpec) field(n specNode, key string) (specNode, error) {
+	return s.resolve(specNode{doc: n.doc, value: n.object()[key]})
+}
+
+func (s *openapiSpec) paths() specNode {
+	paths, _ := s.field(specNode{doc: s.root, value: s.root.root}, "paths")
+	return paths
+}
+
+// relativeLocation resolves a $ref's document against the filepath or URL of the document it's in.
+func relativeLocation(base, ref string) string {
+	if u, err := url.Parse(ref); err == nil && u.IsAbs() {
+		return ref
+	}
+	if b, err := url.Parse(base); err == nil && b.IsAbs() {
+		if u, err := b.Parse(ref); err == nil {
+			return u.String()
+		}
+	}
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	return filepath.Join(filepath.Dir(base), ref)
+}
+
+// followPointer returns the value at a JSON pointer (e.g. /paths/~1users~1create) in doc.
+func followPointer(doc interface{}, pointer string) (interface{}, error) {
+	pointer, err := url.PathUnescape(pointer)
+	if err != nil {
+		return nil, err
+	}
+	current := doc
+	for _, part := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+		switch v := current.(type) {
+		case map[string]interface{}:
+			next, exists := v[part]
+			if !exists {
+				return nil, fmt.Errorf("%s not found", part)
+			}
+			current = next
+		case []interface{}:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return nil, fmt.Errorf("invalid index %q", part)
+			}
+			current = v[idx]
+		default:
+			return nil, fmt.Errorf("%s not found", part)
+		}
+	}
+	return current, nil
+}
+
+// specOperation is the spec of one method on a path.
+type specOperation struct {
+	path     specNode
+	node     specNode
+	template string
+}
+
+// findOperation returns the operation documented for a request.
+func (s *openapiSpec) findOperation(method, path string) (*specOperation, error) {
+	paths := s.paths()
+	var templates []string
+	for template := range paths.object() {
+		templates = append(templates, template)
+	}
+	sort.Strings(templates)
+
+	template := findRoute(templates, path)
+	if template == "" {
+		return nil, errors.New("undocumented path") // endpoints are named after their path already
+	}
+	item, err := s.field(paths, template)
+	if err != nil {
+		return nil, err
+	}
+	op, err := s.field(item, strings.ToLower(method))
+	if err != nil {
+		return nil, err
+	}
+	if op.isNull() {
+		return nil, fmt.Errorf("undocumented method %s on %s", method, template)
+	}
+	return &specOperation{path: item, node: op, template: template}, nil
+}
+
+// validateRequest returns how req differs from its documented operation, which is nil when the
+// request itself is undocumented.
+func (s *openapiSpec) validateRequest(req *http.Request) (*specOperation, []string) {
+	op, err := s.findOperation(req.Method, req.URL.Path)
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+	var violations []string
+
+	// required parameters, from the operation and its path
+	for _, parent := range []specNode{op.path, op.node} {
+		params, err := s.field(parent, "parameters")
+		if err != nil {
+			return op, append(violations, err.Error())
+		}
+		for i := range params.list() {
+			param, err := s.resolve(specNode{doc: params.doc, value: params.list()[i]})
+			if err != nil {
+				return op, append(violations, err.Error())
+			}
+			if !param.boolean("required") {
+				continue
+			}
+			name := param.str("name")
+			switch param.str("in") {
+			case "query":
+				if req.URL.Query().Get(name) == "" {
+					violations = append(violations, fmt.Sprintf("request is missing required query parameter %s", name))
+				}
+			case "header":
+				if req.Header.Get(name) == "" {
+					violations = append(violations, fmt.Sprintf("request is missing required header %s", name))
+				}
+			}
+		}
+	}
+
+	// request body
+	body, err := s.field(op.node, "requestBody")
+	if err != nil || body.isNull() {
+		return op, appendError(violations, err)
+	}
+	schema, err := s.jsonSchema(body)
+	if err != nil || schema.isNull() || req.GetBody == nil {
+		return op, appendError(violations, err)
+	}
+	rc, err := req.GetBody()
+	if err != nil {
+		return op, append(violations, fmt.Sprintf("problem reading request body: %v", err))
+	}
+	defer rc.Close()
+	bs, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return op, append(violations, fmt.Sprintf("problem reading request body: %v", err))
+	}
+	if len(bs) == 0 {
+		if body.boolean("required") {
+			violations = append(violations, "request is missing its required body")
+		}
+		return op, violations
+	}
+	return op, append(violations, s.validateJSON(schema, bs, "request body")...)
+}
+
+// validateResponse returns how resp differs from op's documented responses. The body of JSON
+// responses is read and then replaced so callers can still decode it.
+func (s *openapiSpec) validateResponse(op *specOperation, resp *http.Response) ([]string, error) {
+	responses, err := s.field(op.node, "responses")
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+	var documented specNode
+	for _, code := range []string{strconv.Itoa(resp.StatusCode), fmt.Sprintf("%dXX", resp.StatusCode/100), "default"} {
+		if documented, err = s.field(responses, code); err != nil {
+			return []string{err.Error()}, nil
+		}
+		if !documented.isNull() {
+			break
+		}
+	}
+	if documented.isNull() {
+		return []string{fmt.Sprintf("undocumented HTTP status %d", resp.StatusCode)}, nil
+	}
+
+	schema, err := s.jsonSchema(documented)
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+	if schema.isNull() || !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return nil, nil
+	}
+	bs, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("problem reading %s response: %v", resp.Status, err)
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(bs))
+
+	return s.validateJSON(schema, bs, fmt.Sprintf("HTTP %d response", resp.StatusCode)), nil
+}
+
+// jsonSchema returns the schema of a request body or response's JSON content, if it has any.
+func (s *openapiSpec) jsonSchema(n specNode) (specNode, error) {
+	content, err := s.field(n, "content")
+	if err != nil {
+		return specNode{}, err
+	}
+	var types []string
+	for contentType := range content.object() {
+		types = append(types, contentType)
+	}
+	sort.Strings(types)
+	for _, contentType := range types {
+		if strings.Contains(contentType, "json") {
+			media, err := s.field(content, contentType)
+			if err != nil {
+				return specNode{}, err
+			}
+			return s.field(media, "schema")
+		}
+	}
+	return specNode{}, nil
+}
+
+func (s *openapiSpec) validateJSON(schema specNode, bs []byte, what string) []string {
+	var value interface{}
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return []string{fmt.Sprintf("%s isn't JSON: %v", what, err)}
+	}
+	return s.validateSchema(schema, value, what)
+}
+
+func appendError(violations []string, err error) []string {
+	if err != nil {
+		return append(violations, err.Error())
+	}
+	return violations
+}
+
+// openapiValidator checks every request apitest makes, and its response, against the spec.
+type openapiValidator struct {
+	spec    *openapiSpec
+	checker *conformanceChecker
+}
+
+func newOpenAPIValidator(spec *openapiSpec) *openapiValidator {
+	return &openapiValidator{
+		spec:    spec,
+		checker: newConformanceChecker("openapi", "the OpenAPI spec"),
+	}
+}
+
+func (v *openapiValidator) report(requestID string) error {
+	return v.checker.report(requestID)
+}
+
+// wrap returns a transport which validates requests and responses passing through underlying.
+func (v *openapiValidator) wrap(underlying http.RoundTripper) http.RoundTripper {
+	if underlying == nil {
+		underlying = http.DefaultTransport
+	}
+	return &openapiTransport{
+		underlying: underlying,
+		validator:  v,
+	}
+}
+
+type openapiTransport struct {
+	underlying http.RoundTripper
+	validator  *openapiValidator
+}
+
+func (t *openapiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// -local rewrites the request's path
+	endpoint := endpointName(req.Method, req.URL.Path)
+	op, violations := t.validator.spec.validateRequest(req)
+
+	resp, err := t.underlying.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if op != nil {
+		more, err := t.validator.spec.validateResponse(op, resp)
+		if err != nil {
+			return resp, err
+		}
+		violations = append(violations, more...)
+	}
+	t.validator.checker.add(endpoint, violations)
+	return resp, nil
+}
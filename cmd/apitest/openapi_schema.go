@@ -0,0 +1,216 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// validateSchema returns every way value (decoded with json.Decoder.UseNumber) doesn't match schema.
+// Only the parts of JSON Schema the Moov API uses are supported: type, nullable, enum, required,
+// properties, additionalProperties, items, allOf, oneOf and anyOf.
+func (s *openapiSpec) validateSchema(schema specNode, value interface{}, path string) []string {
+	return s.validateSchemaFields(schema, value, path, true)
+}
+
+// validateSchemaFields checks value against schema, extra fields are only reported when checkExtra
+// is set as allOf subschemas only document some of an object's fields.
+func (s *openapiSpec) validateSchemaFields(schema specNode, value interface{}, path string, checkExtra bool) []string {
+	schema, err := s.resolve(schema)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", path, err)}
+	}
+	if schema.object() == nil {
+		return nil // an empty schema accepts anything
+	}
+
+	if value == nil {
+		if schema.boolean("nullable") || schema.str("type") == "" {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s is null, expected %s", path, schema.str("type"))}
+	}
+
+	var violations []string
+
+	// composition
+	allOf, err := s.field(schema, "allOf")
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", path, err)}
+	}
+	for i := range allOf.list() {
+		sub := specNode{doc: allOf.doc, value: allOf.list()[i]}
+		violations = append(violations, s.validateSchemaFields(sub, value, path, false)...)
+	}
+	for _, keyword := range []string{"oneOf", "anyOf"} {
+		options, err := s.field(schema, keyword)
+		if err != nil {
+			return []string{fmt.Sprintf("%s: %v", path, err)}
+		}
+		if len(options.list()) == 0 {
+			continue
+		}
+		matched := false
+		for i := range options.list() {
+			sub := specNode{doc: options.doc, value: options.list()[i]}
+			if len(s.validateSchemaFields(sub, value, path, checkExtra)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			violations = append(violations, fmt.Sprintf("%s doesn't match any %s schema", path, keyword))
+		}
+	}
+
+	if typ := schema.str("type"); typ != "" && !hasJSONType(value, typ) {
+		return append(violations, fmt.Sprintf("%s is %s, expected %s", path, jsonType(value), typ))
+	}
+	if enum := schema.object()["enum"]; enum != nil {
+		if !inEnum(enum, value) {
+			violations = append(violations, fmt.Sprintf("%s is %v, expected one of %v", path, value, enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		violations = append(violations, s.validateObject(schema, v, path, checkExtra)...)
+
+	case []interface{}:
+		items, err := s.field(schema, "items")
+		if err != nil {
+			return append(violations, fmt.Sprintf("%s: %v", path, err))
+		}
+		if items.isNull() {
+			break
+		}
+		for i := range v {
+			violations = append(violations, s.validateSchema(items, v[i], fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return violations
+}
+
+func (s *openapiSpec) validateObject(schema specNode, value map[string]interface{}, path string, checkExtra bool) []string {
+	var violations []string
+
+	required, _ := schema.object()["required"].([]interface{})
+	for i := range required {
+		name := fmt.Sprintf("%v", required[i])
+		if _, exists := value[name]; !exists {
+			violations = append(violations, fmt.Sprintf("%s is missing required field %s", path, name))
+		}
+	}
+
+	properties, err := s.field(schema, "properties")
+	if err != nil {
+		return append(violations, fmt.Sprintf("%s: %v", path, err))
+	}
+	known, err := s.schemaProperties(schema)
+	if err != nil {
+		return append(violations, fmt.Sprintf("%s: %v", path, err))
+	}
+	additional, err := s.field(schema, "additionalProperties")
+	if err != nil {
+		return append(violations, fmt.Sprintf("%s: %v", path, err))
+	}
+
+	var names []string
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fieldPath := fmt.Sprintf("%s.%s", path, name)
+		if prop, exists := properties.object()[name]; exists {
+			violations = append(violations, s.validateSchema(specNode{doc: properties.doc, value: prop}, value[name], fieldPath)...)
+			continue
+		}
+		switch {
+		case additional.object() != nil:
+			violations = append(violations, s.validateSchema(additional, value[name], fieldPath)...)
+		case additional.value == true:
+			// any field is allowed
+		case checkExtra && len(known) > 0 && !known[name]:
+			violations = append(violations, fmt.Sprintf("%s is an undocumented field", fieldPath))
+		}
+	}
+	return violations
+}
+
+// schemaProperties returns the names of every property an object schema documents, including those of its allOf subschemas.
+func (s *openapiSpec) schemaProperties(schema specNode) (map[string]bool, error) {
+	schema, err := s.resolve(schema)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]bool)
+	properties, err := s.field(schema, "properties")
+	if err != nil {
+		return nil, err
+	}
+	for name := range properties.object() {
+		out[name] = true
+	}
+	allOf, err := s.field(schema, "allOf")
+	if err != nil {
+		return nil, err
+	}
+	for i := range allOf.list() {
+		sub, err := s.schemaProperties(specNode{doc: allOf.doc, value: allOf.list()[i]})
+		if err != nil {
+			return nil, err
+		}
+		for name := range sub {
+			out[name] = true
+		}
+	}
+	return out, nil
+}
+
+func hasJSONType(value interface{}, typ string) bool {
+	switch typ {
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	case "number":
+		return jsonType(value) == "number"
+	}
+	return jsonType(value) == typ
+}
+
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number, float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func inEnum(enum interface{}, value interface{}) bool {
+	values, _ := enum.([]interface{})
+	for i := range values {
+		if fmt.Sprintf("%v", values[i]) == fmt.Sprintf("%v", value) {
+			return true
+		}
+	}
+	return false
+}
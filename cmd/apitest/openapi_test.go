@@ -0,0 +1,242 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// paygateSpec is referenced by the test spec like each application's openapi.yaml is by ours.
+const paygateSpec = `
+openapi: "3.0.2"
+paths:
+  /depositories/{depositoryID}:
+    get:
+      parameters:
+        - $ref: '#/components/parameters/userID'
+      responses:
+        200:
+          description: A depository
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Depository'
+        404:
+          description: Not found
+    patch:
+      parameters:
+        - $ref: '#/components/parameters/userID'
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Depository'
+      responses:
+        '200':
+          description: Updated
+components:
+  parameters:
+    userID:
+      in: header
+      name: X-User-ID
+      required: true
+      schema:
+        type: string
+  schemas:
+    Depository:
+      type: object
+      required: [id, status]
+      properties:
+        id:
+          type: string
+        status:
+          type: string
+          enum: [unverified, verified]
+        attempts:
+          type: integer
+`
+
+func writeTestSpec(t *testing.T, dir, paygateURL string) string {
+	t.Helper()
+	spec := fmt.Sprintf(`
+openapi: "3.0.2"
+paths:
+  /v1/ach/depositories/{depositoryID}:
+    $ref: '%s/openapi.yaml#/paths/~1depositories~1%%7BdepositoryID%%7D'
+  /v1/ach/ping:
+    get:
+      responses:
+        '200':
+          description: PONG
+`, paygateURL)
+	path := filepath.Join(dir, "openapi.yaml")
+	if err := ioutil.WriteFile(path, []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenAPI__validator(t *testing.T) {
+	paygate := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(paygateSpec))
+	}))
+	defer paygate.Close()
+
+	dir, err := ioutil.TempDir("", "openapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spec, err := loadOpenAPISpec(writeTestSpec(t, dir, paygate.URL), paygate.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	op, err := spec.findOperation("GET", "/v1/ach/depositories/abc")
+	if err != nil || op.template != "/v1/ach/depositories/{depositoryID}" {
+		t.Fatalf("op=%#v error=%v", op, err)
+	}
+	if _, err := spec.findOperation("DELETE", "/v1/ach/depositories/abc"); err == nil || !strings.Contains(err.Error(), "undocumented method DELETE") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/ach/depositories/good":
+			w.Write([]byte(`{"id": "good", "status": "verified", "attempts": 2}`))
+		case "/v1/ach/depositories/bad":
+			w.Write([]byte(`{"id": 1, "status": "pending", "attempts": 1.5, "color": "blue"}`))
+		case "/v1/ach/depositories/missing":
+			w.Write([]byte(`{"id": "missing"}`))
+		case "/v1/ach/depositories/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/v1/ach/ping":
+			w.Write([]byte("PONG"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer api.Close()
+
+	validator := newOpenAPIValidator(spec)
+	client := &http.Client{Transport: validator.wrap(nil)}
+	send := func(method, path, body string) {
+		t.Helper()
+		var req *http.Request
+		if body != "" {
+			req, _ = http.NewRequest(method, api.URL+path, strings.NewReader(body))
+		} else {
+			req, _ = http.NewRequest(method, api.URL+path, nil)
+		}
+		if path != "/v1/ach/depositories/nouser" {
+			req.Header.Set("X-User-ID", "user")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// validated bodies can still be read by the caller
+		if bs, _ := ioutil.ReadAll(resp.Body); resp.StatusCode == http.StatusOK && len(bs) == 0 {
+			t.Errorf("%s %s: empty body", method, path)
+		}
+		resp.Body.Close()
+	}
+	send("GET", "/v1/ach/depositories/good", "")
+	send("GET", "/v1/ach/ping", "")
+	if err := validator.report("request"); err != nil {
+		t.Fatal(err)
+	}
+
+	send("GET", "/v1/ach/depositories/bad", "")
+	send("GET", "/v1/ach/depositories/missing", "")
+	send("GET", "/v1/ach/depositories/error", "")
+	send("GET", "/v1/ach/depositories/nouser", "")
+	send("PATCH", "/v1/ach/depositories/good", `{"id": "good", "status": true}`)
+	send("GET", "/v1/ach/other", "")
+	err = validator.report("request")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, expected := range []string{
+		"HTTP 200 response.id is number, expected string",
+		"HTTP 200 response.status is pending, expected one of [unverified verified]",
+		"HTTP 200 response.attempts is number, expected integer",
+		"HTTP 200 response.color is an undocumented field",
+		"HTTP 200 response is missing required field status",
+		"undocumented HTTP status 500",
+		"request is missing required header X-User-ID",
+		"request body.status is boolean, expected string",
+		"GET /v1/ach/other: 1 of 1 responses: undocumented path",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("missing %q: %v", expected, err)
+		}
+	}
+}
+
+func TestOpenAPI__validateSchema(t *testing.T) {
+	doc := &openapiDocument{root: normalizeYAML(map[interface{}]interface{}{})}
+	spec := &openapiSpec{docs: make(map[string]*openapiDocument), errs: make(map[string]error)}
+
+	schema := func(v map[string]interface{}) specNode {
+		return specNode{doc: doc, value: v}
+	}
+	object := map[string]interface{}{
+		"allOf": []interface{}{
+			map[string]interface{}{"type": "object", "properties": map[string]interface{}{"id": map[string]interface{}{"type": "string"}}},
+			map[string]interface{}{"type": "object", "properties": map[string]interface{}{"note": map[string]interface{}{"type": "string", "nullable": true}}},
+		},
+	}
+
+	// fields from every allOf subschema are documented
+	if v := spec.validateSchema(schema(object), map[string]interface{}{"id": "a", "note": nil}, "body"); len(v) != 0 {
+		t.Errorf("unexpected violations: %v", v)
+	}
+	if v := spec.validateSchema(schema(object), map[string]interface{}{"id": "a", "other": 1}, "body"); len(v) != 1 || v[0] != "body.other is an undocumented field" {
+		t.Errorf("unexpected violations: %v", v)
+	}
+
+	oneOf := map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+	}
+	if v := spec.validateSchema(schema(oneOf), []interface{}{"a", "b"}, "body"); len(v) != 0 {
+		t.Errorf("unexpected violations: %v", v)
+	}
+	if v := spec.validateSchema(schema(oneOf), []interface{}{"a", true}, "body"); len(v) != 1 || v[0] != "body doesn't match any oneOf schema" {
+		t.Errorf("unexpected violations: %v", v)
+	}
+
+	// additionalProperties allows any (or typed) fields
+	dict := map[string]interface{}{"type": "object", "properties": map[string]interface{}{}, "additionalProperties": map[string]interface{}{"type": "string"}}
+	if v := spec.validateSchema(schema(dict), map[string]interface{}{"a": "b", "c": false}, "body"); len(v) != 1 || v[0] != "body.c is boolean, expected string" {
+		t.Errorf("unexpected violations: %v", v)
+	}
+}
+
+func TestOpenAPI__relativeLocation(t *testing.T) {
+	cases := []struct{ base, ref, expected string }{
+		{"openapi.yaml", "https://example.com/openapi.yaml", "https://example.com/openapi.yaml"},
+		{"https://example.com/app/openapi.yaml", "common.yaml", "https://example.com/app/common.yaml"},
+		{"https://example.com/app/openapi.yaml", "../base/common.yaml", "https://example.com/base/common.yaml"},
+		{filepath.Join("specs", "openapi.yaml"), "common.yaml", filepath.Join("specs", "common.yaml")},
+	}
+	for _, tc := range cases {
+		if got := relativeLocation(tc.base, tc.ref); got != tc.expected {
+			t.Errorf("%s + %s: got %s, expected %s", tc.base, tc.ref, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+)
+
+// operation is a Moov API call, named after its go-client method.
+type operation struct {
+	service string
+	name    string
+
+	method   string
+	segments []string
+}
+
+func op(service, name, method, path string) operation {
+	return operation{
+		service:  service,
+		name:     name,
+		method:   method,
+		segments: strings.Split(strings.Trim(path, "/"), "/"),
+	}
+}
+
+var operations = []operation{
+	// accounts
+	op("accounts", "PingAccounts", "GET", "/v1/accounts/ping"),
+	op("accounts", "CreateAccount", "POST", "/v1/accounts"),
+	op("accounts", "SearchAccounts", "GET", "/v1/accounts/search"),
+	op("accounts", "CreateTransaction", "POST", "/v1/accounts/transactions"),
+	op("accounts", "GetAccountTransactions", "GET", "/v1/accounts/{accountID}/transactions"),
+
+	// ach
+	op("ach", "PingACH", "GET", "/v1/ach/ping"),
+
+	// auth
+	op("auth", "PingAuth", "GET", "/v1/auth/ping"),
+	op("auth", "CreateUser", "POST", "/v1/users/create"),
+	op("auth", "UserLogin", "POST", "/v1/users/login"),
+	op("auth", "CheckUserLogin", "GET", "/v1/users/login"),
+	op("auth", "UserLogout", "DELETE", "/v1/users/login"),
+	op("auth", "UpdateUserProfile", "PATCH", "/v1/users/{userID}"),
+	op("auth", "CreateOAuth2Client", "POST", "/v1/oauth2/client"),
+	op("auth", "GetClientsForUserId", "GET", "/v1/oauth2/clients"),
+	op("auth", "CreateOAuth2Token", "POST", "/v1/oauth2/token"),
+	op("auth", "CheckOAuthClientCredentials", "GET", "/v1/oauth2/authorize"),
+
+	// customers
+	op("customers", "PingCustomers", "GET", "/v1/customers/ping"),
+	op("customers", "CreateCustomer", "POST", "/v1/customers"),
+	op("customers", "GetCustomer", "GET", "/v1/customers/{customerID}"),
+
+	// fed
+	op("fed", "PingFED", "GET", "/v1/fed/ping"),
+	op("fed", "SearchFEDACH", "GET", "/v1/fed/ach/search"),
+
+	// paygate
+	op("paygate", "PingPaygate", "GET", "/v1/paygate/ping"),
+	op("paygate", "GetDepositories", "GET", "/v1/ach/depositories"),
+	op("paygate", "AddDepository", "POST", "/v1/ach/depositories"),
+	op("paygate", "GetDepositoryByID", "GET", "/v1/ach/depositories/{depositoryID}"),
+	op("paygate", "UpdateDepository", "PATCH", "/v1/ach/depositories/{depositoryID}"),
+	op("paygate", "DeleteDepository", "DELETE", "/v1/ach/depositories/{depositoryID}"),
+	op("paygate", "InitiateMicroDeposits", "POST", "/v1/ach/depositories/{depositoryID}/micro-deposits"),
+	op("paygate", "ConfirmMicroDeposits", "POST", "/v1/ach/depositories/{depositoryID}/micro-deposits/confirm"),
+	op("paygate", "GetEvents", "GET", "/v1/ach/events"),
+	op("paygate", "GetEventByID", "GET", "/v1/ach/events/{eventID}"),
+	op("paygate", "GetOriginators", "GET", "/v1/ach/originators"),
+	op("paygate", "AddOriginator", "POST", "/v1/ach/originators"),
+	op("paygate", "GetOriginatorByID", "GET", "/v1/ach/originators/{originatorID}"),
+	op("paygate", "UpdateOriginator", "PATCH", "/v1/ach/originators/{originatorID}"),
+	op("paygate", "DeleteOriginator", "DELETE", "/v1/ach/originators/{originatorID}"),
+	op("paygate", "GetReceivers", "GET", "/v1/ach/receivers"),
+	op("paygate", "AddReceivers", "POST", "/v1/ach/receivers"),
+	op("paygate", "GetReceiverByID", "GET", "/v1/ach/receivers/{receiverID}"),
+	op("paygate", "UpdateReceiver", "PATCH", "/v1/ach/receivers/{receiverID}"),
+	op("paygate", "DeleteReceiver", "DELETE", "/v1/ach/receivers/{receiverID}"),
+	op("paygate", "GetTransfers", "GET", "/v1/ach/transfers"),
+	op("paygate", "AddTransfer", "POST", "/v1/ach/transfers"),
+	op("paygate", "AddTransfers", "POST", "/v1/ach/transfers/batch"),
+	op("paygate", "GetTransferByID", "GET", "/v1/ach/transfers/{transferID}"),
+	op("paygate", "DeleteTransferByID", "DELETE", "/v1/ach/transfers/{transferID}"),
+	op("paygate", "GetTransferEventsByID", "GET", "/v1/ach/transfers/{transferID}/events"),
+	op("paygate", "GetTransferFiles", "POST", "/v1/ach/transfers/{transferID}/files"),
+	op("paygate", "GetTransferNachaCode", "POST", "/v1/ach/transfers/{transferID}/failed"),
+
+	// watchman
+	op("watchman", "PingWatchman", "GET", "/v1/watchman/ping"),
+	op("watchman", "Search", "GET", "/v1/watchman/ofac/search"),
+	op("watchman", "GetLatestDownloads", "GET", "/v1/watchman/ofac/downloads"),
+}
+
+func (o operation) matches(method string, segments []string) bool {
+	if o.method != method || len(o.segments) != len(segments) {
+		return false
+	}
+	for i := range o.segments {
+		if strings.HasPrefix(o.segments[i], "{") {
+			continue
+		}
+		if o.segments[i] != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// findOperation returns the service and operation name for an HTTP request against the Moov API.
+// Unknown requests are grouped together so the number of distinct names stays small.
+func findOperation(method, path string) (string, string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := range operations {
+		if operations[i].matches(method, segments) {
+			return operations[i].service, operations[i].name
+		}
+	}
+	return "unknown", "unknown"
+}
@@ -0,0 +1,32 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestOperations__find(t *testing.T) {
+	cases := []struct {
+		method, path  string
+		service, name string
+	}{
+		{"GET", "/v1/ach/ping", "ach", "PingACH"},
+		{"POST", "/v1/ach/depositories/abc/micro-deposits", "paygate", "InitiateMicroDeposits"},
+		{"POST", "/v1/ach/depositories/abc/micro-deposits/confirm", "paygate", "ConfirmMicroDeposits"},
+		{"GET", "/v1/accounts/search", "accounts", "SearchAccounts"},
+		{"GET", "/v1/accounts/abc/transactions", "accounts", "GetAccountTransactions"},
+		{"DELETE", "/v1/users/login", "auth", "UserLogout"},
+		{"GET", "/v1/customers/abc", "customers", "GetCustomer"},
+		{"PUT", "/v1/customers/abc", "unknown", "unknown"},
+		{"GET", "/v1/other", "unknown", "unknown"},
+	}
+	for _, tc := range cases {
+		service, name := findOperation(tc.method, tc.path)
+		if service != tc.service || name != tc.name {
+			t.Errorf("%s %s: got %s.%s", tc.method, tc.path, service, name)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	flagReportFormat = flag.String("report.format", "", "Write a report of every step ran. Options: junit, json")
+	flagReportFile   = flag.String("report.file", "", "Filepath to write the report into, stdout is used if empty")
+
+	// testReport collects the result of every step apitest runs.
+	testReport = newReport()
+)
+
+// report is a collection of test cases (steps) and their outcome, which can
+// be written in a machine-readable format for CI systems.
+type report struct {
+	mu      sync.Mutex
+	started time.Time
+	cases   []testCase
+}
+
+type testCase struct {
+	Suite     string        `json:"suite"`
+	Name      string        `json:"name"`
+	RequestID string        `json:"requestID,omitempty"`
+	Started   time.Time     `json:"started"`
+	Duration  time.Duration `json:"duration"`
+	Skipped   bool          `json:"skipped,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+func (tc testCase) failed() bool {
+	return !tc.Skipped && tc.Error != ""
+}
+
+func newReport() *report {
+	return &report{started: time.Now()}
+}
+
+// reset drops every test case so far, -daemon starts each scheduled run with an empty report.
+func (r *report) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started = time.Now()
+	r.cases = nil
+}
+
+func (r *report) add(tc testCase) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cases = append(r.cases, tc)
+}
+
+// record runs f and adds its outcome as a test case.
+func (r *report) record(suite, name, requestID string, f func() error) error {
+	start := time.Now()
+	err := f()
+	tc := testCase{
+		Suite:     suite,
+		Name:      name,
+		RequestID: requestID,
+		Started:   start,
+		Duration:  time.Since(start),
+	}
+	if err != nil {
+		tc.Error = err.Error()
+	}
+	r.add(tc)
+	return err
+}
+
+// addResults records each step result from a scenario run.
+func (r *report) addResults(suite, requestID string, started time.Time, results []stepResult) {
+	for _, result := range results {
+		tc := testCase{
+			Suite:     suite,
+			Name:      result.name,
+			RequestID: requestID,
+			Started:   started,
+			Duration:  result.duration,
+			Skipped:   result.skipped,
+		}
+		if result.err != nil {
+			tc.Error = result.err.Error()
+		}
+		r.add(tc)
+		started = started.Add(result.duration)
+	}
+}
+
+func (r *report) write(format string, w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch strings.ToLower(format) {
+	case "json":
+		return r.writeJSON(w)
+	case "junit":
+		return r.writeJUnit(w)
+	}
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+func (r *report) writeJSON(w io.Writer) error {
+	out := struct {
+		Started  time.Time     `json:"started"`
+		Duration time.Duration `json:"duration"`
+		Cases    []testCase    `json:"cases"`
+	}{
+		Started:  r.started,
+		Duration: time.Since(r.started),
+		Cases:    r.cases,
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func (r *report) writeJUnit(w io.Writer) error {
+	out := junitTestSuites{
+		Name: "apitest",
+		Time: junitSeconds(time.Since(r.started)),
+	}
+	suites := make(map[string]int) // suite name -> index in out.Suites
+	for _, tc := range r.cases {
+		idx, exists := suites[tc.Suite]
+		if !exists {
+			idx = len(out.Suites)
+			suites[tc.Suite] = idx
+			out.Suites = append(out.Suites, junitTestSuite{
+				Name:      tc.Suite,
+				Timestamp: tc.Started.UTC().Format("2006-01-02T15:04:05"),
+			})
+		}
+		suite := &out.Suites[idx]
+
+		c := junitTestCase{
+			Name:      tc.Name,
+			Classname: tc.Suite,
+			Time:      junitSeconds(tc.Duration),
+		}
+		if tc.RequestID != "" {
+			c.SystemOut = fmt.Sprintf("X-Request-ID: %s", tc.RequestID)
+		}
+		switch {
+		case tc.Skipped:
+			c.Skipped = &junitMessage{Message: tc.Error}
+			suite.Skipped++
+		case tc.failed():
+			c.Failure = &junitMessage{Message: tc.Error, Body: tc.Error}
+			suite.Failures++
+			out.Failures++
+		}
+		suite.Tests++
+		out.Tests++
+		suite.Cases = append(suite.Cases, c)
+	}
+	for i := range out.Suites {
+		var total time.Duration
+		for _, tc := range r.cases {
+			if tc.Suite == out.Suites[i].Name {
+				total += tc.Duration
+			}
+		}
+		out.Suites[i].Time = junitSeconds(total)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeReport saves testReport according to the -report.* flags.
+func writeReport() error {
+	if *flagReportFormat == "" {
+		return nil
+	}
+	if *flagReportFile == "" {
+		return testReport.write(*flagReportFormat, os.Stdout)
+	}
+	fd, err := os.Create(*flagReportFile)
+	if err != nil {
+		return fmt.Errorf("report: %v", err)
+	}
+	if err := testReport.write(*flagReportFormat, fd); err != nil {
+		fd.Close()
+		return fmt.Errorf("report: %v", err)
+	}
+	if err := fd.Close(); err != nil {
+		return fmt.Errorf("report: %v", err)
+	}
+	log.Printf("INFO: wrote %s report to %s", *flagReportFormat, *flagReportFile)
+	return nil
+}
+
+// fatalf logs a failure, writes our report and then exits. It should be used instead
+// of log.Fatalf so every step ran is included in the report.
+func fatalf(format string, args ...interface{}) {
+	log.Output(2, fmt.Sprintf(format, args...))
+	if err := writeReport(); err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testingReport() *report {
+	r := newReport()
+	r.record("ping", "ACH", "reqID", func() error { return nil })
+	r.record("ping", "auth", "reqID", func() error { return errors.New("connection refused") })
+	r.addResults("push", "reqID", time.Now(), []stepResult{
+		{name: "user", duration: time.Second},
+		{name: "oauth", err: errors.New("bad <token>"), duration: 2 * time.Second},
+		{name: "transfer", err: errors.New("dependency oauth did not pass"), skipped: true},
+	})
+	return r
+}
+
+func TestReport__JSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testingReport().write("json", &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var out struct {
+		Cases []testCase `json:"cases"`
+	}
+	if err := json.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Cases) != 5 {
+		t.Fatalf("got %d cases", len(out.Cases))
+	}
+	if tc := out.Cases[1]; tc.Suite != "ping" || tc.Name != "auth" || tc.Error != "connection refused" || tc.RequestID != "reqID" {
+		t.Errorf("unexpected test case: %#v", tc)
+	}
+	if tc := out.Cases[3]; tc.Duration != 2*time.Second || !tc.failed() {
+		t.Errorf("unexpected test case: %#v", tc)
+	}
+	if tc := out.Cases[4]; !tc.Skipped || tc.failed() {
+		t.Errorf("unexpected test case: %#v", tc)
+	}
+}
+
+func TestReport__JUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testingReport().write("junit", &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var out junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Tests != 5 || out.Failures != 2 || len(out.Suites) != 2 {
+		t.Fatalf("unexpected testsuites: %#v", out)
+	}
+	push := out.Suites[1]
+	if push.Name != "push" || push.Tests != 3 || push.Failures != 1 || push.Skipped != 1 || push.Time != "3.000" {
+		t.Errorf("unexpected testsuite: %#v", push)
+	}
+	if c := push.Cases[1]; c.Failure == nil || c.Failure.Message != "bad <token>" {
+		t.Errorf("unexpected testcase: %#v", c)
+	}
+	if c := push.Cases[2]; c.Skipped == nil {
+		t.Errorf("unexpected testcase: %#v", c)
+	}
+}
+
+func TestReport__reset(t *testing.T) {
+	r := testingReport()
+	started := r.started
+	r.reset()
+	if len(r.cases) != 0 || r.started.Before(started) {
+		t.Errorf("cases=%d started=%v", len(r.cases), r.started)
+	}
+
+	r.record("ping", "ACH", "reqID2", func() error { return nil })
+	var buf bytes.Buffer
+	if err := r.write("json", &buf); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Cases []testCase `json:"cases"`
+	}
+	if err := json.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Cases) != 1 || out.Cases[0].RequestID != "reqID2" {
+		t.Errorf("unexpected cases: %#v", out.Cases)
+	}
+}
+
+func TestReport__unknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testingReport().write("other", &buf); err == nil {
+		t.Error("expected error")
+	}
+}
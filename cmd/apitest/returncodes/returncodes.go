@@ -0,0 +1,20 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+// Package returncodes holds the ACH return code behavior shared by apitest and its mock.
+package returncodes
+
+// Rejecting are the return codes paygate marks the Receiver's Depository as rejected for, as
+// the account can't accept any more entries. apitest expects the same from paygate.
+var Rejecting = map[string]bool{
+	"R02": true, // Account Closed
+	"R03": true, // No Account/Unable to Locate Account
+	"R04": true, // Invalid Account Number
+	"R07": true, // Authorization Revoked by Customer
+	"R10": true, // Customer Advises Not Authorized
+	"R14": true, // Representative Payee Deceased
+	"R15": true, // Beneficiary or Account Holder Deceased
+	"R16": true, // Account Frozen
+	"R20": true, // Non-Transaction Account
+}
@@ -0,0 +1,374 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/moov-io/ach"
+	"github.com/moov-io/api/cmd/apitest/returncodes"
+	moov "github.com/moov-io/go-client/client"
+)
+
+var (
+	flagInboundDir   = flag.String("inbound.dir", "", "Directory paygate reads inbound return and NOC files from, used by the returns scenario")
+	flagInboundCodes = flag.String("inbound.codes", "R01,R03,C01,C02", "Comma separated return and NOC codes the returns scenario simulates, one per iteration in turn")
+
+	// inboundIterations picks which of -inbound.codes the next returns iteration simulates
+	inboundIterations uint64
+)
+
+func init() {
+	registerScenario(&scenario{
+		name: "returns",
+		steps: []*step{
+			featuresStep,
+			userStep,
+			oauthStep,
+			microDepositAccountStep,
+			originatorStep,
+			receiverStep,
+			transferStep,
+			returnStep,
+		},
+	})
+}
+
+// supportedChangeCodes are the NOC codes paygate corrects the Receiver's Depository for.
+var supportedChangeCodes = map[string]string{
+	"C01": "accountNumber",
+	"C02": "routingNumber",
+}
+
+func inboundCodes() []string {
+	var codes []string
+	for _, code := range strings.Split(*flagInboundCodes, ",") {
+		if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// validateInboundFlags checks the returns scenario can run, which needs the inbound directory and known codes.
+func validateInboundFlags(selected []*scenario) error {
+	needed := false
+	for _, sc := range selected {
+		for _, st := range sc.steps {
+			needed = needed || st == returnStep
+		}
+	}
+	if !needed {
+		return nil
+	}
+	if *flagInboundDir == "" {
+		return errors.New("the returns scenario requires -inbound.dir")
+	}
+	if strings.EqualFold(*flagACHType, ach.IAT) {
+		return errors.New("the returns scenario doesn't support -ach.type=IAT")
+	}
+	codes := inboundCodes()
+	if len(codes) == 0 {
+		return errors.New("no -inbound.codes given")
+	}
+	for _, code := range codes {
+		if strings.HasPrefix(code, "C") {
+			if _, ok := supportedChangeCodes[code]; !ok {
+				return fmt.Errorf("unsupported NOC code %s in -inbound.codes, options: C01, C02", code)
+			}
+			continue
+		}
+		if ach.LookupReturnCode(code) == nil {
+			return fmt.Errorf("unknown return code %s in -inbound.codes", code)
+		}
+	}
+	return nil
+}
+
+var returnStep = &step{
+	name:      "return",
+	dependsOn: []string{"transfer"},
+	run: func(ctx context.Context, iter *iteration) error {
+		codes := inboundCodes()
+		code := codes[int(atomic.AddUint64(&inboundIterations, 1)-1)%len(codes)]
+
+		entry, err := findTransferEntry(ctx, iter)
+		if err != nil {
+			return err
+		}
+		dep, err := getDepository(ctx, iter, iter.receiverDepository.ID)
+		if err != nil {
+			return err
+		}
+		file, expected, err := buildInboundFile(iter, dep, entry, code)
+		if err != nil {
+			return fmt.Errorf("problem creating %s file: %v", code, err)
+		}
+		path, err := writeInboundFile(*flagInboundDir, fmt.Sprintf("%s-%s.ach", iter.transfer.ID, code), file)
+		if err != nil {
+			return err
+		}
+		iter.logf("INFO: wrote %s file for trace number %s to %s", code, entry.traceNumber(), path)
+
+		if err := waitForInboundFile(ctx, iter, expected); err != nil {
+			return fmt.Errorf("%s: %v", code, err)
+		}
+		iter.logf("SUCCESS: paygate processed %s for transfer %s", code, iter.transfer.ID)
+		return nil
+	},
+}
+
+// findTransferEntry waits for the transfer to be merged and returns its entry. Merged files are read from
+// -verify-transfers.dir when given, otherwise from paygate's transfer files endpoint.
+func findTransferEntry(ctx context.Context, iter *iteration) (*mergedEntry, error) {
+	deadline := time.Now().Add(*flagVerifyTimeout)
+	for {
+		var entries []*mergedEntry
+		if *flagVerifyTransfers != "" {
+			w := newMergedFileWatcher(localDir(*flagVerifyTransfers))
+			if err := w.refresh(); err != nil {
+				return nil, err
+			}
+			entries = w.entries()
+		} else {
+			files, err := getTransferFiles(ctx, iter)
+			if err != nil {
+				return nil, err
+			}
+			for i := range files {
+				entries = append(entries, fileEntries(files[i].ID, files[i])...)
+			}
+		}
+		if matched, _ := matchTransfers(entries, []*iteration{iter}); len(matched) > 0 {
+			for _, entry := range entries {
+				if entry.matched {
+					return entry, nil
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("transfer %s was not merged after %v", iter.transfer.ID, *flagVerifyTimeout)
+		}
+		select {
+		case <-time.After(*flagVerifyPollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// inboundExpectation is how paygate should update the transfer and Receiver's Depository after
+// processing an inbound file.
+type inboundExpectation struct {
+	transferStatus string
+	returnCode     string
+
+	depositoryStatus string
+	accountNumber    string
+	routingNumber    string
+}
+
+// buildInboundFile creates the return or NOC file the RDFI would send back for a merged entry. dep is the
+// Receiver's Depository as it was before the file is processed.
+func buildInboundFile(iter *iteration, dep moov.Depository, merged *mergedEntry, code string) (*ach.File, *inboundExpectation, error) {
+	if merged.entry == nil {
+		return nil, nil, errors.New("only non-IAT entries can be returned")
+	}
+	orig := merged.entry
+	rdfi := dep.RoutingNumber
+	expected := &inboundExpectation{
+		depositoryStatus: dep.Status,
+		accountNumber:    dep.AccountNumber,
+		routingNumber:    dep.RoutingNumber,
+	}
+
+	file := ach.NewFile()
+	file.Header = ach.NewFileHeader()
+	file.Header.ImmediateOrigin = merged.header.ImmediateDestination
+	file.Header.ImmediateOriginName = merged.header.ImmediateDestinationName
+	file.Header.ImmediateDestination = merged.header.ImmediateOrigin
+	file.Header.ImmediateDestinationName = merged.header.ImmediateOriginName
+	file.Header.FileCreationDate = time.Now().Format("060102")
+	file.Header.FileCreationTime = time.Now().Format("1504")
+
+	bh := ach.NewBatchHeader()
+	bh.ServiceClassCode = merged.batch.ServiceClassCode
+	bh.CompanyName = merged.batch.CompanyName
+	bh.CompanyIdentification = merged.batch.CompanyIdentification
+	bh.StandardEntryClassCode = merged.batch.StandardEntryClassCode
+	bh.CompanyEntryDescription = merged.batch.CompanyEntryDescription
+	bh.EffectiveEntryDate = time.Now().Format("060102")
+	bh.ODFIIdentification = aba8(rdfi)
+
+	ed := ach.NewEntryDetail()
+	ed.TransactionCode = returnTransactionCode(orig.TransactionCode)
+	ed.SetRDFI(iter.originatorDepository.RoutingNumber)
+	ed.DFIAccountNumber = strings.TrimSpace(orig.DFIAccountNumber)
+	ed.Amount = orig.Amount
+	ed.IdentificationNumber = orig.IdentificationNumber
+	ed.IndividualName = strings.TrimSpace(orig.IndividualName)
+	ed.DiscretionaryData = orig.DiscretionaryData
+	ed.SetTraceNumber(bh.ODFIIdentification, 1)
+	ed.AddendaRecordIndicator = 1
+
+	if change, ok := supportedChangeCodes[code]; ok {
+		addenda98 := ach.NewAddenda98()
+		addenda98.ChangeCode = code
+		addenda98.OriginalTrace = orig.TraceNumber
+		addenda98.OriginalDFI = orig.RDFIIdentification
+		addenda98.TraceNumber = ed.TraceNumber
+		switch change {
+		case "accountNumber":
+			expected.accountNumber = fmt.Sprintf("%d", randSource.Int63()%1e10)
+			addenda98.CorrectedData = expected.accountNumber
+		case "routingNumber":
+			expected.routingNumber = "121042882" // Wells Fargo
+			if rdfi == expected.routingNumber {
+				expected.routingNumber = "231380104" // Citadel
+			}
+			addenda98.CorrectedData = expected.routingNumber
+		}
+		bh.StandardEntryClassCode = ach.COR
+		bh.CompanyEntryDescription = "NOC"
+		ed.Amount = 0
+		ed.Category = ach.CategoryNOC
+		ed.Addenda98 = addenda98
+	} else {
+		addenda99 := ach.NewAddenda99()
+		addenda99.ReturnCode = code
+		addenda99.OriginalTrace = orig.TraceNumber
+		addenda99.OriginalDFI = orig.RDFIIdentification
+		addenda99.TraceNumber = ed.TraceNumber
+		ed.Category = ach.CategoryReturn
+		ed.Addenda99 = addenda99
+
+		expected.transferStatus = "reclaimed"
+		expected.returnCode = code
+		if returncodes.Rejecting[code] {
+			expected.depositoryStatus = "rejected"
+		}
+	}
+
+	batch, err := ach.NewBatch(bh)
+	if err != nil {
+		return nil, nil, err
+	}
+	batch.AddEntry(ed)
+	if err := batch.Create(); err != nil {
+		return nil, nil, err
+	}
+	file.AddBatch(batch)
+	if err := file.Create(); err != nil {
+		return nil, nil, err
+	}
+	return file, expected, nil
+}
+
+// returnTransactionCode is the code for returning (or sending a NOC for) an entry with the given code.
+func returnTransactionCode(code int) int {
+	switch code {
+	case ach.CheckingCredit, ach.CheckingDebit, ach.SavingsCredit, ach.SavingsDebit:
+		return code - 1
+	}
+	return code
+}
+
+func aba8(routingNumber string) string {
+	if len(routingNumber) > 8 {
+		return routingNumber[:8]
+	}
+	return routingNumber
+}
+
+func writeInboundFile(dir, filename string, file *ach.File) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("problem creating %s: %v", dir, err)
+	}
+	// Write to a temporary name first so paygate never reads a partial file
+	path := filepath.Join(dir, filename)
+	fd, err := os.Create(path + ".tmp")
+	if err != nil {
+		return "", fmt.Errorf("problem creating inbound file: %v", err)
+	}
+	if err := ach.NewWriter(fd).Write(file); err != nil {
+		fd.Close()
+		os.Remove(fd.Name())
+		return "", fmt.Errorf("problem writing inbound file: %v", err)
+	}
+	if err := fd.Close(); err != nil {
+		return "", fmt.Errorf("problem closing inbound file: %v", err)
+	}
+	return path, os.Rename(fd.Name(), path)
+}
+
+// waitForInboundFile polls the transfer and Receiver's Depository until paygate has applied the
+// inbound file, or -verify-transfers.timeout passes.
+func waitForInboundFile(ctx context.Context, iter *iteration, expected *inboundExpectation) error {
+	deadline := time.Now().Add(*flagVerifyTimeout)
+	for {
+		problems, err := checkInboundFile(ctx, iter, expected)
+		if err != nil {
+			return err
+		}
+		if len(problems) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not processed after %v: %s", *flagVerifyTimeout, strings.Join(problems, ", "))
+		}
+		select {
+		case <-time.After(*flagVerifyPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func checkInboundFile(ctx context.Context, iter *iteration, expected *inboundExpectation) ([]string, error) {
+	var problems []string
+	check := func(field, want, got string) {
+		if want != "" && !strings.EqualFold(want, got) {
+			problems = append(problems, fmt.Sprintf("%s is %q, expected %q", field, got, want))
+		}
+	}
+
+	tr, resp, err := iter.api.TransfersApi.GetTransferByID(ctx, iter.transfer.ID, iter.userID, nil)
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("problem reading transfer: %v", err)
+	}
+	check("transfer status", expected.transferStatus, tr.Status)
+	check("transfer returnCode", expected.returnCode, tr.ReturnCode.Code)
+
+	dep, err := getDepository(ctx, iter, iter.receiverDepository.ID)
+	if err != nil {
+		return nil, err
+	}
+	check("depository status", expected.depositoryStatus, dep.Status)
+	check("depository accountNumber", expected.accountNumber, dep.AccountNumber)
+	check("depository routingNumber", expected.routingNumber, dep.RoutingNumber)
+	return problems, nil
+}
+
+func getDepository(ctx context.Context, iter *iteration, depositoryID string) (moov.Depository, error) {
+	dep, resp, err := iter.api.DepositoriesApi.GetDepositoryByID(ctx, depositoryID, iter.userID, nil)
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return dep, fmt.Errorf("problem reading depository: %v", err)
+	}
+	return dep, nil
+}
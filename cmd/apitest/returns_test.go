@@ -0,0 +1,117 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moov-io/ach"
+	moov "github.com/moov-io/go-client/client"
+)
+
+func TestReturns__validateInboundFlags(t *testing.T) {
+	returns := []*scenario{scenarios["returns"]}
+	defer func(dir, codes string) {
+		*flagInboundDir, *flagInboundCodes = dir, codes
+	}(*flagInboundDir, *flagInboundCodes)
+
+	if err := validateInboundFlags([]*scenario{scenarios["push"]}); err != nil {
+		t.Errorf("push scenario doesn't need -inbound.dir: %v", err)
+	}
+	if err := validateInboundFlags(returns); err == nil || !strings.Contains(err.Error(), "-inbound.dir") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	*flagInboundDir = "/tmp/inbound"
+	if err := validateInboundFlags(returns); err != nil {
+		t.Error(err)
+	}
+	*flagInboundCodes = "R01, c01"
+	if err := validateInboundFlags(returns); err != nil {
+		t.Error(err)
+	}
+	*flagInboundCodes = "C05"
+	if err := validateInboundFlags(returns); err == nil || !strings.Contains(err.Error(), "unsupported NOC code C05") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	*flagInboundCodes = "R99"
+	if err := validateInboundFlags(returns); err == nil || !strings.Contains(err.Error(), "unknown return code R99") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestReturns__buildInboundFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildInboundFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestACHFile(t, dir, ach.CheckingCredit)
+	file, err := parseACHFilepath(filepath.Join(dir, "merged.ach"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := fileEntries("merged.ach", file)[0]
+
+	iter := testIteration()
+	dep := moov.Depository{RoutingNumber: "231380104", AccountNumber: "987654321", Status: "verified"}
+
+	// Returns
+	ret, expected, err := buildInboundFile(iter, dep, merged, "R03")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.Header.ImmediateOrigin != "231380104" || ret.Header.ImmediateDestination != "121042882" {
+		t.Errorf("unexpected file header: %#v", ret.Header)
+	}
+	ed := ret.Batches[0].GetEntries()[0]
+	if ed.Addenda99 == nil || ed.Addenda99.ReturnCode != "R03" || ed.Addenda99.OriginalTrace != merged.traceNumber() {
+		t.Errorf("unexpected addenda99: %#v", ed.Addenda99)
+	}
+	if ed.TransactionCode != ach.CheckingReturnNOCCredit || ed.Amount != 1234 {
+		t.Errorf("unexpected entry: %#v", ed)
+	}
+	if expected.transferStatus != "reclaimed" || expected.returnCode != "R03" || expected.depositoryStatus != "rejected" {
+		t.Errorf("unexpected expectation: %#v", expected)
+	}
+
+	// R01 doesn't reject the depository
+	if _, expected, err = buildInboundFile(iter, dep, merged, "R01"); err != nil {
+		t.Fatal(err)
+	}
+	if expected.depositoryStatus != "verified" {
+		t.Errorf("unexpected expectation: %#v", expected)
+	}
+
+	// NOCs
+	noc, expected, err := buildInboundFile(iter, dep, merged, "C02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sec := noc.Batches[0].GetHeader().StandardEntryClassCode; sec != ach.COR {
+		t.Errorf("unexpected SEC code: %s", sec)
+	}
+	ed = noc.Batches[0].GetEntries()[0]
+	if ed.Addenda98 == nil || ed.Addenda98.ChangeCode != "C02" || strings.TrimSpace(ed.Addenda98.CorrectedData) != "121042882" {
+		t.Errorf("unexpected addenda98: %#v", ed.Addenda98)
+	}
+	if expected.transferStatus != "" || expected.routingNumber != "121042882" || expected.accountNumber != "987654321" {
+		t.Errorf("unexpected expectation: %#v", expected)
+	}
+
+	// inbound files can be written and read back
+	path, err := writeInboundFile(dir, "noc.ach", noc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseACHFilepath(path); err != nil {
+		t.Error(err)
+	}
+}
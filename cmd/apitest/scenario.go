@@ -0,0 +1,144 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	flagScenarios = flag.String("scenario", "push", "Comma separated list of scenarios to run (e.g. push,pull)")
+
+	// scenarios holds every registered scenario by name. Scenarios are added
+	// with registerScenario, typically from an init() function.
+	scenarios = make(map[string]*scenario)
+)
+
+// step is one named action within a scenario. Steps share state through the *iteration
+// they are ran against and can require other (earlier) steps have passed first.
+type step struct {
+	name      string
+	dependsOn []string
+
+	run func(ctx context.Context, iter *iteration) error
+}
+
+// scenario is an ordered set of steps which together exercise a flow through the Moov API.
+type scenario struct {
+	name  string
+	steps []*step
+}
+
+// stepResult is the outcome of a single step from a scenario run.
+type stepResult struct {
+	name     string
+	err      error
+	skipped  bool
+	duration time.Duration
+}
+
+func (r stepResult) passed() bool {
+	return !r.skipped && r.err == nil
+}
+
+// registerScenario adds s to the set of scenarios selectable with -scenario.
+//
+// Steps can only depend on steps declared earlier in the scenario, so an invalid
+// scenario will panic (similar to registering a duplicate scenario name).
+func registerScenario(s *scenario) {
+	if s == nil || s.name == "" {
+		panic("scenario: missing name")
+	}
+	if _, exists := scenarios[s.name]; exists {
+		panic(fmt.Sprintf("scenario: %s already registered", s.name))
+	}
+	if err := s.validate(); err != nil {
+		panic(fmt.Sprintf("scenario: %s: %v", s.name, err))
+	}
+	scenarios[s.name] = s
+}
+
+func (s *scenario) validate() error {
+	if len(s.steps) == 0 {
+		return errors.New("no steps")
+	}
+	seen := make(map[string]bool)
+	for i := range s.steps {
+		st := s.steps[i]
+		if st.name == "" || st.run == nil {
+			return fmt.Errorf("step #%d is missing a name or run func", i)
+		}
+		if seen[st.name] {
+			return fmt.Errorf("duplicate step %s", st.name)
+		}
+		for _, dep := range st.dependsOn {
+			if !seen[dep] {
+				return fmt.Errorf("step %s depends on %s which isn't an earlier step", st.name, dep)
+			}
+		}
+		seen[st.name] = true
+	}
+	return nil
+}
+
+// run executes each step in order against iter. A step is skipped (and not ran) when
+// any of the steps it depends on failed or were skipped themselves.
+func (s *scenario) run(ctx context.Context, iter *iteration) []stepResult {
+	passed := make(map[string]bool)
+	results := make([]stepResult, 0, len(s.steps))
+	for _, st := range s.steps {
+		result := stepResult{name: st.name}
+		for _, dep := range st.dependsOn {
+			if !passed[dep] {
+				result.skipped = true
+				result.err = fmt.Errorf("dependency %s did not pass", dep)
+				break
+			}
+		}
+		if !result.skipped {
+			start := time.Now()
+			result.err = st.run(ctx, iter)
+			result.duration = time.Since(start)
+		}
+		passed[st.name] = result.passed()
+		results = append(results, result)
+	}
+	return results
+}
+
+// findScenarios returns the registered scenarios for a comma separated list of names.
+func findScenarios(names string) ([]*scenario, error) {
+	var out []*scenario
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		s, exists := scenarios[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown scenario %q, options: %s", name, strings.Join(scenarioNames(), ", "))
+		}
+		out = append(out, s)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no scenarios selected")
+	}
+	return out, nil
+}
+
+func scenarioNames() []string {
+	var names []string
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
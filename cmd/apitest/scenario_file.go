@@ -0,0 +1,366 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	flagScenarioFiles = flag.String("scenario.files", "", "Comma separated list of YAML or JSON scenario files (globs allowed) to register as scenarios")
+)
+
+// scenarioFile is a declarative scenario, which is a sequence of Moov API calls. Each call can capture
+// fields from its response for later steps and make assertions on the response status and body.
+//
+// Example:
+//
+//	name: customer-lookup
+//	requires: [user]
+//	steps:
+//	  - name: create-customer
+//	    operation: POST /v1/customers
+//	    body: '{"firstName": "{{ name }}", "lastName": "Doe", "email": "{{ email }}"}'
+//	    capture:
+//	      customerID: ID
+//	    expect:
+//	      status: 200
+//	  - name: get-customer
+//	    operation: GET /v1/customers/{{ .customerID }}
+//	    expect:
+//	      status: 200
+//	      body:
+//	        lastName: Doe
+type scenarioFile struct {
+	Name string `yaml:"name"`
+
+	// Requires is a list of Go defined steps (e.g. user, oauth, originator) which run
+	// before any steps from the file. Their dependencies are included automatically.
+	Requires []string `yaml:"requires"`
+
+	Steps []scenarioFileStep `yaml:"steps"`
+}
+
+type scenarioFileStep struct {
+	Name string `yaml:"name"`
+
+	// Operation is the HTTP method and path (e.g. "GET /v1/ach/originators") of the Moov API call.
+	Operation string `yaml:"operation"`
+
+	Headers map[string]string `yaml:"headers"`
+
+	// Body is either a string or object which is encoded as JSON. Either are rendered
+	// as a template prior to sending.
+	Body interface{} `yaml:"body"`
+
+	// Capture saves response body fields (by their dotted path, e.g. "clients.0.client_id")
+	// under the given variable name for templates in later steps.
+	Capture map[string]string `yaml:"capture"`
+
+	Expect scenarioExpectation `yaml:"expect"`
+}
+
+type scenarioExpectation struct {
+	// Status is the expected HTTP status code, any 2xx status is accepted when it's not set.
+	Status int `yaml:"status"`
+
+	// Body is a set of dotted paths and their expected (templated) values.
+	Body map[string]string `yaml:"body"`
+}
+
+// loadScenarioFiles reads each comma separated file (or glob) and registers it as a scenario.
+func loadScenarioFiles(patterns string) error {
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("scenario files: %v", err)
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("scenario files: no files found for %s", pattern)
+		}
+		for _, path := range matches {
+			sc, err := readScenarioFile(path)
+			if err != nil {
+				return fmt.Errorf("scenario file %s: %v", path, err)
+			}
+			if _, exists := scenarios[sc.name]; exists {
+				return fmt.Errorf("scenario file %s: scenario %s already registered", path, sc.name)
+			}
+			registerScenario(sc)
+		}
+	}
+	return nil
+}
+
+func readScenarioFile(path string) (*scenario, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// YAML is a superset of JSON, so either file type can be read here.
+	var file scenarioFile
+	if err := yaml.UnmarshalStrict(bs, &file); err != nil {
+		return nil, err
+	}
+	if file.Name == "" {
+		file.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return file.scenario(builtinSteps())
+}
+
+// scenario converts the file into steps. Required Go steps (and their dependencies)
+// run first and then each file step runs only if the one before it passed.
+func (f *scenarioFile) scenario(builtin map[string]*step) (*scenario, error) {
+	sc := &scenario{name: f.Name}
+
+	added := make(map[string]bool)
+	var add func(name string) error
+	add = func(name string) error {
+		if added[name] {
+			return nil
+		}
+		st, exists := builtin[name]
+		if !exists {
+			return fmt.Errorf("unknown required step %q", name)
+		}
+		for _, dep := range st.dependsOn {
+			if err := add(dep); err != nil {
+				return err
+			}
+		}
+		added[name] = true
+		sc.steps = append(sc.steps, st)
+		return nil
+	}
+	for _, name := range f.Requires {
+		if err := add(name); err != nil {
+			return nil, err
+		}
+	}
+
+	dependsOn := f.Requires
+	for i := range f.Steps {
+		fs := f.Steps[i]
+		if fs.Name == "" {
+			fs.Name = fmt.Sprintf("step-%d", i+1)
+		}
+		if _, _, err := parseOperation(fs.Operation); err != nil {
+			return nil, fmt.Errorf("step %s: %v", fs.Name, err)
+		}
+		sc.steps = append(sc.steps, &step{
+			name:      fs.Name,
+			dependsOn: dependsOn,
+			run:       fs.run,
+		})
+		dependsOn = []string{fs.Name}
+	}
+	if err := sc.validate(); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+func parseOperation(op string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimSpace(op), " ", 2)
+	if len(parts) != 2 || parts[0] == "" || !strings.HasPrefix(strings.TrimSpace(parts[1]), "/") {
+		return "", "", fmt.Errorf("invalid operation %q, expected 'METHOD /path'", op)
+	}
+	return strings.ToUpper(parts[0]), strings.TrimSpace(parts[1]), nil
+}
+
+func (fs scenarioFileStep) run(ctx context.Context, iter *iteration) error {
+	if iter.vars == nil {
+		iter.vars = make(map[string]string)
+	}
+	iter.vars["requestID"] = iter.requestID
+	iter.vars["userID"] = iter.userID
+
+	op, err := renderTemplate(fs.Operation, iter.vars)
+	if err != nil {
+		return fmt.Errorf("operation: %v", err)
+	}
+	method, path, _ := parseOperation(op)
+
+	var body io.Reader
+	if fs.Body != nil {
+		tpl, err := bodyTemplate(fs.Body)
+		if err != nil {
+			return err
+		}
+		rendered, err := renderTemplate(tpl, iter.vars)
+		if err != nil {
+			return fmt.Errorf("body: %v", err)
+		}
+		body = strings.NewReader(rendered)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(iter.conf.BasePath, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range iter.conf.DefaultHeader {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("User-Agent", iter.conf.UserAgent)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range fs.Headers {
+		rendered, err := renderTemplate(v, iter.vars)
+		if err != nil {
+			return fmt.Errorf("header %s: %v", k, err)
+		}
+		req.Header.Set(k, rendered)
+	}
+
+	resp, err := iter.conf.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s %s: problem reading response: %v", method, path, err)
+	}
+	switch {
+	case fs.Expect.Status != 0 && fs.Expect.Status != resp.StatusCode:
+		return fmt.Errorf("%s %s: got %s response, expected %d: %s", method, path, resp.Status, fs.Expect.Status, string(bs))
+	case fs.Expect.Status == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299):
+		return fmt.Errorf("%s %s: got %s response, expected 2xx: %s", method, path, resp.Status, string(bs))
+	}
+	if len(fs.Capture) == 0 && len(fs.Expect.Body) == 0 {
+		iter.logf("SUCCESS: %s %s (status %d)", method, path, resp.StatusCode)
+		return nil
+	}
+
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("%s %s: problem reading JSON response: %v", method, path, err)
+	}
+	for field, tpl := range fs.Expect.Body {
+		expected, err := renderTemplate(tpl, iter.vars)
+		if err != nil {
+			return fmt.Errorf("expect %s: %v", field, err)
+		}
+		actual, err := lookupField(doc, field)
+		if err != nil {
+			return fmt.Errorf("%s %s: %v", method, path, err)
+		}
+		if v := fmt.Sprintf("%v", actual); v != expected {
+			return fmt.Errorf("%s %s: %s is %q, expected %q", method, path, field, v, expected)
+		}
+	}
+	for name, field := range fs.Capture {
+		actual, err := lookupField(doc, field)
+		if err != nil {
+			return fmt.Errorf("%s %s: capture %s: %v", method, path, name, err)
+		}
+		iter.vars[name] = fmt.Sprintf("%v", actual)
+	}
+	iter.logf("SUCCESS: %s %s (status %d)", method, path, resp.StatusCode)
+	return nil
+}
+
+var templateFuncs = template.FuncMap{
+	"id":     generateID,
+	"amount": amount,
+	"phone":  phone,
+	"name": func() string {
+		first, _ := name()
+		return first
+	},
+	"email": func() string {
+		return email(name())
+	},
+}
+
+func renderTemplate(tpl string, vars map[string]string) (string, error) {
+	t, err := template.New("").Funcs(templateFuncs).Option("missingkey=error").Parse(tpl)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// bodyTemplate returns the request body template, which is either given directly as a string
+// or an object that needs to be encoded as JSON.
+func bodyTemplate(body interface{}) (string, error) {
+	if s, ok := body.(string); ok {
+		return s, nil
+	}
+	bs, err := json.Marshal(normalizeYAML(body))
+	if err != nil {
+		return "", fmt.Errorf("body: %v", err)
+	}
+	return string(bs), nil
+}
+
+// normalizeYAML converts the map[interface{}]interface{} values yaml.v2 decodes into
+// map[string]interface{} so they can be encoded as JSON.
+func normalizeYAML(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(vv))
+		for k, v := range vv {
+			out[fmt.Sprintf("%v", k)] = normalizeYAML(v)
+		}
+		return out
+	case []interface{}:
+		for i := range vv {
+			vv[i] = normalizeYAML(vv[i])
+		}
+		return vv
+	}
+	return v
+}
+
+// lookupField finds the value at a dotted path (e.g. "lines.0.amount") in a decoded JSON document.
+func lookupField(doc interface{}, path string) (interface{}, error) {
+	current := doc
+	for _, part := range strings.Split(path, ".") {
+		switch v := current.(type) {
+		case map[string]interface{}:
+			next, exists := v[part]
+			if !exists {
+				return nil, fmt.Errorf("field %s not found", path)
+			}
+			current = next
+		case []interface{}:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return nil, fmt.Errorf("field %s: invalid index %q", path, part)
+			}
+			current = v[idx]
+		default:
+			return nil, fmt.Errorf("field %s not found", path)
+		}
+	}
+	return current, nil
+}
@@ -0,0 +1,234 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+func writeScenarioFile(t *testing.T, name, contents string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "apitest-scenario")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestScenarioFile__run(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/customers", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("X-User-Id") != "user" || req["lastName"] != "Doe" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"ID": "foo", "lastName": "Doe", "phones": [{"number": "555.555.5555"}]}`))
+	})
+	mux.HandleFunc("/v1/customers/foo", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ID": "foo", "status": "OFAC", "amount": 1200}`))
+	})
+	svc := httptest.NewServer(mux)
+	defer svc.Close()
+
+	path := writeScenarioFile(t, "customers.yaml", `
+name: customers-test
+steps:
+  - name: create-customer
+    operation: POST /v1/customers
+    body:
+      firstName: "{{ name }}"
+      lastName: Doe
+    capture:
+      customerID: ID
+      phone: phones.0.number
+    expect:
+      status: 200
+  - name: get-customer
+    operation: GET /v1/customers/{{ .customerID }}
+    expect:
+      status: 200
+      body:
+        status: OFAC
+        amount: 1200
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	sc, err := readScenarioFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.name != "customers-test" || len(sc.steps) != 2 {
+		t.Fatalf("unexpected scenario: %#v", sc)
+	}
+
+	conf := moov.NewConfiguration()
+	conf.BasePath = svc.URL
+	conf.HTTPClient = svc.Client()
+	conf.AddDefaultHeader("X-User-Id", "user")
+
+	iter := &iteration{conf: conf, logf: t.Logf, userID: "user"}
+	for _, result := range sc.run(context.Background(), iter) {
+		if !result.passed() {
+			t.Errorf("%s: %v", result.name, result.err)
+		}
+	}
+	if v := iter.vars["phone"]; v != "555.555.5555" {
+		t.Errorf("unexpected phone capture: %q", v)
+	}
+}
+
+func TestScenarioFile__failedExpectation(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": "not found"}`))
+	}))
+	defer svc.Close()
+
+	// JSON files are read the same way
+	path := writeScenarioFile(t, "missing.json", `{
+  "steps": [
+    {"operation": "GET /v1/ach/transfers/missing", "expect": {"status": 200}},
+    {"operation": "GET /v1/ach/transfers/other"}
+  ]
+}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	sc, err := readScenarioFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.name != "missing" {
+		t.Errorf("unexpected name: %s", sc.name)
+	}
+
+	conf := moov.NewConfiguration()
+	conf.BasePath = svc.URL
+	conf.HTTPClient = svc.Client()
+
+	results := sc.run(context.Background(), &iteration{conf: conf, logf: t.Logf})
+	if len(results) != 2 {
+		t.Fatalf("got %d results", len(results))
+	}
+	if results[0].err == nil || !strings.Contains(results[0].err.Error(), "404") {
+		t.Errorf("unexpected error: %v", results[0].err)
+	}
+	if !results[1].skipped {
+		t.Error("expected second step to be skipped")
+	}
+}
+
+func TestScenarioFile__requires(t *testing.T) {
+	f := &scenarioFile{
+		Name:     "test",
+		Requires: []string{"originator"},
+		Steps: []scenarioFileStep{
+			{Operation: "GET /v1/ach/originators"},
+		},
+	}
+	sc, err := f.scenario(builtinSteps())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for i := range sc.steps {
+		names = append(names, sc.steps[i].name)
+	}
+	if v := strings.Join(names, ","); v != "features,user,oauth,micro-deposit-account,originator,step-1" {
+		t.Errorf("unexpected steps: %s", v)
+	}
+
+	// pull transfers have their own steps
+	f.Requires = []string{"pull-transactions"}
+	sc, err = f.scenario(builtinSteps())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sc.steps); n < 3 || sc.steps[n-3].name != "pull-transfer" || sc.steps[n-2].name != "pull-transactions" {
+		t.Errorf("unexpected steps: %#v", sc.steps)
+	}
+
+	f.Requires = []string{"missing"}
+	if _, err := f.scenario(builtinSteps()); err == nil {
+		t.Error("expected error")
+	}
+
+	f.Requires = nil
+	f.Steps[0].Operation = "/v1/ach/originators"
+	if _, err := f.scenario(builtinSteps()); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestScenarioFile__lookupField(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(`{"a": {"b": [{"c": "d"}]}}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := lookupField(doc, "a.b.0.c"); err != nil || v != "d" {
+		t.Errorf("v=%v error=%v", v, err)
+	}
+	if _, err := lookupField(doc, "a.b.1.c"); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := lookupField(doc, "a.x"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestScenarioFile__defaultStatus(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/ach/transfers/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer svc.Close()
+
+	path := writeScenarioFile(t, "default-status.yaml", `
+steps:
+  - operation: GET /v1/ach/transfers/created
+  - operation: GET /v1/ach/transfers/error
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	sc, err := readScenarioFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := moov.NewConfiguration()
+	conf.BasePath = svc.URL
+	conf.HTTPClient = svc.Client()
+
+	// any 2xx passes, but other statuses fail without expect.status
+	results := sc.run(context.Background(), &iteration{conf: conf, logf: t.Logf})
+	if len(results) != 2 || results[0].err != nil {
+		t.Fatalf("unexpected results: %#v", results)
+	}
+	if err := results[1].err; err == nil || !strings.Contains(err.Error(), "500 Internal Server Error response, expected 2xx") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
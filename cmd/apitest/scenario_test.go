@@ -0,0 +1,96 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestScenario__run(t *testing.T) {
+	var ran []string
+	record := func(name string, err error) func(context.Context, *iteration) error {
+		return func(_ context.Context, _ *iteration) error {
+			ran = append(ran, name)
+			return err
+		}
+	}
+	sc := &scenario{
+		name: "test",
+		steps: []*step{
+			{name: "a", run: record("a", nil)},
+			{name: "b", run: record("b", errors.New("bad thing")), dependsOn: []string{"a"}},
+			{name: "c", run: record("c", nil), dependsOn: []string{"b"}},
+			{name: "d", run: record("d", nil), dependsOn: []string{"a"}},
+		},
+	}
+	if err := sc.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	results := sc.run(context.Background(), &iteration{})
+	if len(results) != 4 {
+		t.Fatalf("got %d results", len(results))
+	}
+	if v := strings.Join(ran, ","); v != "a,b,d" {
+		t.Errorf("ran steps: %s", v)
+	}
+	if !results[0].passed() || results[1].passed() || results[1].skipped {
+		t.Errorf("unexpected results: %#v", results[:2])
+	}
+	if !results[2].skipped || results[2].err == nil {
+		t.Errorf("step c should have been skipped: %#v", results[2])
+	}
+	if !results[3].passed() {
+		t.Errorf("step d should have passed: %#v", results[3])
+	}
+}
+
+func TestScenario__validate(t *testing.T) {
+	noop := func(_ context.Context, _ *iteration) error { return nil }
+
+	sc := &scenario{name: "test"}
+	if err := sc.validate(); err == nil {
+		t.Error("expected error on empty scenario")
+	}
+
+	sc.steps = []*step{
+		{name: "a", run: noop, dependsOn: []string{"b"}},
+		{name: "b", run: noop},
+	}
+	if err := sc.validate(); err == nil {
+		t.Error("expected error on out of order dependency")
+	}
+
+	sc.steps = []*step{
+		{name: "a", run: noop},
+		{name: "a", run: noop},
+	}
+	if err := sc.validate(); err == nil {
+		t.Error("expected error on duplicate step")
+	}
+}
+
+func TestScenario__findScenarios(t *testing.T) {
+	found, err := findScenarios("push")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].name != "push" {
+		t.Errorf("unexpected scenarios: %#v", found)
+	}
+
+	if _, err := findScenarios("push,other"); err == nil {
+		t.Error("expected error")
+	} else if !strings.Contains(err.Error(), "unknown scenario") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if _, err := findScenarios(" , "); err == nil {
+		t.Error("expected error")
+	}
+}
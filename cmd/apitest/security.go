@@ -5,14 +5,21 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
-	"path"
+	"strings"
 	"time"
+
+	"github.com/moov-io/base"
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/antihax/optional"
 )
 
 var (
@@ -21,6 +28,100 @@ var (
 	}
 )
 
+// authProtectedRoutes are every route documented in openapi.yaml.tpl which requires authentication.
+// Path parameters are filled with the IDs of objects apitest created, or random IDs otherwise.
+var authProtectedRoutes = []string{
+	// auth
+	"/v1/users/{userID}",
+	"/v1/oauth2/authorize",
+	"/v1/oauth2/clients",
+	"/v1/oauth2/client",
+
+	// ach
+	"/v1/ach/files",
+	"/v1/ach/files/create",
+	"/v1/ach/files/{fileID}",
+	"/v1/ach/files/{fileID}/contents",
+	"/v1/ach/files/{fileID}/validate",
+	"/v1/ach/files/{fileID}/segment",
+	"/v1/ach/files/{fileID}/batches",
+	"/v1/ach/files/{fileID}/batches/{batchID}",
+
+	// paygate
+	"/v1/ach/originators",
+	"/v1/ach/originators/{originatorID}",
+	"/v1/ach/receivers",
+	"/v1/ach/receivers/{receiverID}",
+	"/v1/ach/receivers/{receiverID}/depositories",
+	"/v1/ach/receivers/{receiverID}/depositories/{depositoryID}",
+	"/v1/ach/depositories",
+	"/v1/ach/depositories/{depositoryID}",
+	"/v1/ach/depositories/{depositoryID}/micro-deposits",
+	"/v1/ach/depositories/{depositoryID}/micro-deposits/confirm",
+	"/v1/ach/transfers",
+	"/v1/ach/transfers/batch",
+	"/v1/ach/transfers/{transferID}",
+	"/v1/ach/transfers/{transferID}/failed",
+	"/v1/ach/transfers/{transferID}/files",
+	"/v1/ach/transfers/{transferID}/events",
+	"/v1/ach/events",
+	"/v1/ach/events/{eventID}",
+	"/v1/ach/gateways",
+
+	// watchman
+	"/v1/watchman/companies/{companyID}",
+	"/v1/watchman/companies/{companyID}/watch",
+	"/v1/watchman/companies/{companyID}/watch/{watchID}",
+	"/v1/watchman/companies/watch",
+	"/v1/watchman/companies/watch/{watchID}",
+	"/v1/watchman/ofac/customers/{customerID}",
+	"/v1/watchman/ofac/customers/{customerID}/watch",
+	"/v1/watchman/ofac/customers/{customerID}/watch/{watchID}",
+	"/v1/watchman/ofac/customers/watch",
+	"/v1/watchman/ofac/customers/watch/{watchID}",
+	"/v1/watchman/ofac/downloads",
+	"/v1/watchman/ofac/search",
+	"/v1/watchman/ofac/sdn/{sdnID}",
+	"/v1/watchman/ofac/sdn/{sdnID}/alts",
+	"/v1/watchman/ofac/sdn/{sdnID}/addresses",
+
+	// fed
+	"/v1/fed/ach/search",
+	"/v1/fed/wire/search",
+
+	// accounts
+	"/v1/accounts",
+	"/v1/accounts/search",
+	"/v1/accounts/transactions",
+	"/v1/accounts/{accountID}/transactions",
+
+	// customers
+	"/v1/customers",
+	"/v1/customers/{customerID}",
+	"/v1/customers/{customerID}/documents",
+	"/v1/customers/{customerID}/documents/{documentID}",
+
+	// imagecashletter
+	"/v1/imagecashletter/files",
+	"/v1/imagecashletter/files/create",
+	"/v1/imagecashletter/files/{fileID}",
+	"/v1/imagecashletter/files/{fileID}/contents",
+	"/v1/imagecashletter/files/{fileID}/validate",
+	"/v1/imagecashletter/files/{fileID}/cashLetters",
+	"/v1/imagecashletter/files/{fileID}/cashLetters/{cashLetterID}",
+
+	// wire
+	"/v1/wire/files",
+	"/v1/wire/files/create",
+	"/v1/wire/files/{fileID}",
+	"/v1/wire/files/{fileID}/contents",
+	"/v1/wire/files/{fileID}/validate",
+	"/v1/wire/files/{fileID}/FEDWireMessage",
+}
+
+// authProbeMethods are sent to every route, a body of {} is sent with PUT and PATCH.
+var authProbeMethods = []string{"GET", "PUT", "PATCH", "DELETE"}
+
 type authChecker struct {
 	apiAddress string
 
@@ -29,53 +130,220 @@ type authChecker struct {
 	recDepID     string
 	receiverID   string
 	transferID   string
+	accountID    string
+	customerID   string
 
 	requestID string
 	userID    string
+
+	// track records objects created for the checks, see iteration.track
+	track func(kind, id string, remove func(ctx context.Context) (*http.Response, error))
+}
+
+// authProbe is a request made without (valid) credentials for the user who owns the resource.
+type authProbe struct {
+	method string
+	path   string
+
+	// ownedIDs is true when the path contains IDs of objects apitest created
+	ownedIDs bool
 }
 
-func (ac *authChecker) checkAll() error {
+// authCredentials are sent with probes, along with the X-User-Id header.
+type authCredentials struct {
+	name   string
+	userID string
+	cookie string
+
+	// crossUser credentials are valid, but belong to another user
+	crossUser bool
+}
+
+// probes expands every route and method with the IDs of the objects apitest created.
+func (ac *authChecker) probes() []authProbe {
+	ids := map[string][]string{
+		"userID":       {ac.userID},
+		"originatorID": {ac.originatorID},
+		"receiverID":   {ac.receiverID},
+		"depositoryID": {ac.origDepID, ac.recDepID},
+		"transferID":   {ac.transferID},
+		"accountID":    {ac.accountID},
+		"customerID":   {ac.customerID},
+	}
+	var out []authProbe
+	for _, route := range authProtectedRoutes {
+		paths, owned := expandRoute(route, ids)
+		for _, p := range paths {
+			for _, method := range authProbeMethods {
+				out = append(out, authProbe{method: method, path: p, ownedIDs: owned})
+			}
+		}
+	}
+	return out
+}
+
+// expandRoute fills path parameters of route with known IDs (one path per ID) or a random ID.
+func expandRoute(route string, ids map[string][]string) ([]string, bool) {
+	paths := []string{""}
+	owned := false
+	for _, segment := range strings.Split(strings.Trim(route, "/"), "/") {
+		values := []string{segment}
+		if strings.HasPrefix(segment, "{") {
+			values = nil
+			for _, id := range ids[strings.Trim(segment, "{}")] {
+				if id != "" {
+					values = append(values, id)
+				}
+			}
+			if len(values) > 0 {
+				owned = true
+			} else {
+				values = []string{base.ID()}
+			}
+		}
+		var next []string
+		for _, p := range paths {
+			for _, v := range values {
+				next = append(next, p+"/"+v)
+			}
+		}
+		paths = next
+	}
+	return paths, owned
+}
+
+func (ac *authChecker) checkAll(ctx context.Context) error {
 	if *flagLocal {
 		return nil // skip this check in local dev
 	}
 
-	if err := ac.canWeBypassAuth("depositories", ac.origDepID); err != nil {
-		return fmt.Errorf("originator depository: %v", err)
+	creds, err := ac.otherUserCredentials(ctx)
+	if err != nil {
+		return fmt.Errorf("other user: %v", err)
 	}
-	if err := ac.canWeBypassAuth("originators", ac.originatorID); err != nil {
-		return fmt.Errorf("originators: %v", err)
+	probes := ac.probes()
+	for i := range creds {
+		err := testReport.record("auth-bypass", creds[i].name, ac.requestID, func() error {
+			return ac.probeAll(probes, creds[i])
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %v", creds[i].name, err)
+		}
 	}
 
-	if err := ac.canWeBypassAuth("depositories", ac.recDepID); err != nil {
-		return fmt.Errorf("receiver depository: %v", err)
+	log.Println("INFO: unable to naively bypass auth")
+
+	return nil
+}
+
+// otherUserCredentials creates a second user and returns the ways it (or nobody) tries to read our user's objects:
+// only the X-User-Id header, a second user's valid cookie, a cookie from a logged out session and a tampered cookie.
+func (ac *authChecker) otherUserCredentials(ctx context.Context) ([]authCredentials, error) {
+	conf := makeConfiguration()
+	conf.AddDefaultHeader("X-Request-ID", ac.requestID)
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+	api := moov.NewAPIClient(conf)
+
+	other, err := createUser(ctx, api)
+	if err != nil {
+		return nil, err
+	}
+	if ac.track != nil {
+		ac.track("user", other.ID, nil)
 	}
-	if err := ac.canWeBypassAuth("receivers", ac.receiverID); err != nil {
-		return fmt.Errorf("receivers: %v", err)
+	if other.Cookie == nil {
+		return nil, fmt.Errorf("no cookie for user %s", other.ID)
+	}
+	expired, err := loggedOutCookie(ctx, api, other)
+	if err != nil {
+		return nil, err
 	}
+	tampered := []byte(other.Cookie.Value)
+	tampered[len(tampered)-1] ^= 1
 
-	if err := ac.canWeBypassAuth("transfers", ac.transferID); err != nil {
-		return fmt.Errorf("transfers: %v", err)
+	return []authCredentials{
+		{name: "spoofed x-user-id", userID: ac.userID},
+		{name: "other user", userID: other.ID, cookie: other.Cookie.Value, crossUser: true},
+		{name: "other user with spoofed x-user-id", userID: ac.userID, cookie: other.Cookie.Value, crossUser: true},
+		{name: "logged out cookie", userID: ac.userID, cookie: expired},
+		{name: "tampered cookie", userID: ac.userID, cookie: string(tampered)},
+	}, nil
+}
+
+// loggedOutCookie logs u in again and then out, returning the session's (now invalid) cookie.
+func loggedOutCookie(ctx context.Context, api *moov.APIClient, u *user) (string, error) {
+	_, resp, err := api.UserApi.UserLogin(ctx, moov.Login{Email: u.Email, Password: *flagPassword}, &moov.UserLoginOpts{
+		XIdempotencyKey: optional.NewString(generateID()),
+	})
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return "", fmt.Errorf("problem logging in: %v", err)
+	}
+	cookie := findMoovCookie(resp.Cookies())
+	if cookie == nil {
+		return "", fmt.Errorf("no cookie for user %s", u.ID)
 	}
 
-	log.Println("INFO: unable to naively bypass auth")
+	conf := makeConfiguration()
+	conf.AddDefaultHeader("Cookie", fmt.Sprintf("moov_auth=%s", cookie.Value))
+	resp, err = moov.NewAPIClient(conf).UserApi.UserLogout(ctx, &moov.UserLogoutOpts{})
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return "", fmt.Errorf("problem logging out: %v", err)
+	}
+	return cookie.Value, nil
+}
 
+// probeAll sends every probe with creds and reports each one which wasn't rejected.
+func (ac *authChecker) probeAll(probes []authProbe, creds authCredentials) error {
+	var failures []string
+	sent := 0
+	for _, probe := range probes {
+		if creds.crossUser && !probe.ownedIDs {
+			continue // other users can read their own (empty) collections
+		}
+		sent++
+		if err := ac.canWeBypassAuth(probe, creds); err != nil {
+			failures = append(failures, fmt.Sprintf("%s %s: %v", probe.method, probe.path, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d requests weren't rejected:\n  %s", len(failures), sent, strings.Join(failures, "\n  "))
+	}
+	if *flagDebug {
+		log.Printf("DEBUG: %d requests rejected with %s", sent, creds.name)
+	}
 	return nil
 }
 
-func (ac *authChecker) canWeBypassAuth(objPathSegments ...string) error {
+func (ac *authChecker) canWeBypassAuth(probe authProbe, creds authCredentials) error {
 	u, err := url.Parse(ac.apiAddress)
 	if err != nil {
 		return err
 	}
-	u.Path = path.Join(append([]string{"v1", "ach"}, objPathSegments...)...)
+	u.Path = probe.path
 
-	req, err := http.NewRequest("GET", u.String(), nil)
+	var body io.Reader
+	if probe.method == "PUT" || probe.method == "PATCH" {
+		body = strings.NewReader("{}")
+	}
+	req, err := http.NewRequest(probe.method, u.String(), body)
 	if err != nil {
 		return err
 	}
 	req.Header.Set("x-request-id", ac.requestID)
-	req.Header.Set("x-user-id", ac.userID)
+	req.Header.Set("x-user-id", creds.userID)
 	req.Header.Set("Origin", "https://moov.io") // ask for CORS headers
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if creds.cookie != "" {
+		req.Header.Set("Cookie", fmt.Sprintf("moov_auth=%s", creds.cookie))
+	}
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
@@ -84,26 +352,24 @@ func (ac *authChecker) canWeBypassAuth(objPathSegments ...string) error {
 	defer resp.Body.Close()
 
 	if err := checkCORSHeaders(resp); err != nil {
-		fmt.Printf("response headers:\n%#v\n", resp.Header)
 		return err
 	}
 
 	switch resp.StatusCode {
-	case http.StatusOK:
-		bs, _ := ioutil.ReadAll(resp.Body)
-		if len(bs) > 0 {
-			fmt.Printf("response body:\n%s\n", string(bs))
-		}
-		return fmt.Errorf("got HTTP status %v back, expected %d", resp.StatusCode, http.StatusForbidden)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil // We expect to be blocked
 
-	case http.StatusForbidden:
-		if *flagDebug {
-			log.Printf("DEBUG: ")
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		if creds.crossUser {
+			return nil // another user's objects can't be found
 		}
-		return nil // We expect to be blocked
 	}
-
-	return fmt.Errorf("unexpected HTTP status %v", resp.Status)
+	if *flagDebug {
+		if bs, _ := ioutil.ReadAll(resp.Body); len(bs) > 0 {
+			log.Printf("DEBUG: %s %s response body: %s", probe.method, probe.path, string(bs))
+		}
+	}
+	return fmt.Errorf("got HTTP status %s", resp.Status)
 }
 
 func checkCORSHeaders(resp *http.Response) error {
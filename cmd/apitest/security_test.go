@@ -0,0 +1,107 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// publicRoutes don't require authentication
+var publicRoutes = map[string]bool{
+	"/v1/users/create": true,
+	"/v1/users/login":  true,
+	"/v1/oauth2/token": true,
+}
+
+func TestSecurity__authProtectedRoutes(t *testing.T) {
+	fd, err := os.Open(filepath.Join("..", "..", "openapi.yaml.tpl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	known := make(map[string]bool)
+	for _, route := range authProtectedRoutes {
+		known[route] = true
+	}
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "  /v1/") {
+			continue
+		}
+		route := strings.TrimSuffix(strings.TrimSpace(line), ":")
+		if publicRoutes[route] || strings.HasSuffix(route, "/ping") {
+			continue
+		}
+		if !known[route] {
+			t.Errorf("%s isn't probed by authChecker", route)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSecurity__expandRoute(t *testing.T) {
+	ids := map[string][]string{
+		"receiverID":   {"rec"},
+		"depositoryID": {"dep1", "dep2"},
+		"transferID":   {""},
+	}
+	paths, owned := expandRoute("/v1/ach/receivers/{receiverID}/depositories/{depositoryID}", ids)
+	if !owned || len(paths) != 2 || paths[0] != "/v1/ach/receivers/rec/depositories/dep1" || paths[1] != "/v1/ach/receivers/rec/depositories/dep2" {
+		t.Errorf("owned=%v paths=%v", owned, paths)
+	}
+
+	paths, owned = expandRoute("/v1/ach/transfers/{transferID}", ids)
+	if owned || len(paths) != 1 || !strings.HasPrefix(paths[0], "/v1/ach/transfers/") || paths[0] == "/v1/ach/transfers/" {
+		t.Errorf("owned=%v paths=%v", owned, paths)
+	}
+}
+
+func TestSecurity__probeAll(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/v1/ach/transfers/transfer":
+			w.WriteHeader(http.StatusOK) // trusts x-user-id
+		case r.Header.Get("Cookie") == "moov_auth=valid":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer svc.Close()
+
+	ac := &authChecker{apiAddress: svc.URL, userID: "user", transferID: "transfer"}
+	probes := ac.probes()
+	if len(probes) != len(authProtectedRoutes)*len(authProbeMethods) {
+		t.Errorf("got %d probes", len(probes))
+	}
+
+	err := ac.probeAll(probes, authCredentials{name: "spoofed x-user-id", userID: "user"})
+	if err == nil || !strings.Contains(err.Error(), "1 of ") || !strings.Contains(err.Error(), "GET /v1/ach/transfers/transfer: got HTTP status 200 OK") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// other users only probe our objects, which can't be found
+	err = ac.probeAll(probes, authCredentials{name: "other user", userID: "other", cookie: "valid", crossUser: true})
+	if err == nil || !strings.Contains(err.Error(), "1 of 20 requests") { // /v1/users/{userID} and four transfer routes
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// a valid cookie for the user who owns the objects isn't expected to be rejected
+	if err := ac.probeAll(probes, authCredentials{name: "tampered cookie", userID: "user", cookie: "valid"}); err == nil {
+		t.Error("expected error")
+	}
+}
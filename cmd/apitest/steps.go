@@ -0,0 +1,324 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerScenario(&scenario{
+		name: "push",
+		steps: []*step{
+			featuresStep,
+			userStep,
+			oauthStep,
+			microDepositAccountStep,
+			originatorStep,
+			receiverStep,
+			transferStep,
+			transactionsStep,
+			failedLoginStep,
+			failedOAuthStep,
+		},
+	})
+	registerScenario(&scenario{
+		name: "pull",
+		steps: []*step{
+			featuresStep,
+			userStep,
+			oauthStep,
+			microDepositAccountStep,
+			originatorStep,
+			receiverStep,
+			pullTransferStep,
+			pullTransactionsStep,
+		},
+	})
+}
+
+// builtinSteps returns the Go defined steps by name so scenario files can require them.
+func builtinSteps() map[string]*step {
+	steps := make(map[string]*step)
+	for _, st := range []*step{
+		featuresStep,
+		userStep,
+		oauthStep,
+		microDepositAccountStep,
+		originatorStep,
+		receiverStep,
+		transferStep,
+		transactionsStep,
+		pullTransferStep,
+		pullTransactionsStep,
+		failedLoginStep,
+		failedOAuthStep,
+	} {
+		steps[st.name] = st
+	}
+	return steps
+}
+
+var (
+	featuresStep = &step{
+		name: "features",
+		run: func(ctx context.Context, iter *iteration) error {
+			flags, err := grabPaygateFeatures(flagLocal, *flagPaygateAdminAddress, adminHTTPClient)
+			if err != nil {
+				return err
+			}
+			iter.featureFlags = flags
+			return nil
+		},
+	}
+
+	userStep = &step{
+		name: "user",
+		run: func(ctx context.Context, iter *iteration) error {
+			// Create our random user
+			user, err := createUser(ctx, iter.api)
+			if err != nil {
+				return err
+			}
+			iter.user, iter.userID = user, user.ID
+			iter.track("user", user.ID, nil)
+			iter.logf("SUCCESS: Created user %s (email: %s)", user.ID, user.Email)
+
+			// Add auth cookie and userId on every request from now on
+			if err := setMoovAuthCookie(iter.conf, user); err != nil {
+				return err
+			}
+
+			// Verify Cookie works
+			if err := verifyUserIsLoggedIn(ctx, iter.api, user); err != nil {
+				return err
+			}
+			iter.logf("SUCCESS: Cookie works for user %s", user.ID)
+			return nil
+		},
+	}
+
+	oauthStep = &step{
+		name:      "oauth",
+		dependsOn: []string{"user"},
+		run: func(ctx context.Context, iter *iteration) error {
+			client, oauthToken, err := createOAuthToken(ctx, iter.api, iter.user)
+			if client != nil {
+				iter.track("oauth-client", client.ClientId, nil)
+			}
+			if err != nil {
+				return err
+			}
+			iter.oauthToken = *oauthToken
+
+			expiresIn, _ := time.ParseDuration(fmt.Sprintf("%ds", oauthToken.ExpiresIn))
+			if v := os.Getenv("TRAVIS_OS_NAME"); v != "" {
+				// Hide our OAuth2 access_token from TravisCI logs...
+				iter.logf("SUCCESS: Created OAuth access token, expires in %v", expiresIn)
+			} else {
+				iter.logf("SUCCESS: Created OAuth access token (%s), expires in %v", oauthToken.AccessToken, expiresIn)
+			}
+
+			if *flagOAuth {
+				iter.logf("Using OAuth for all requests now.")
+
+				removeMoovAuthCookie(iter.conf) // we only want OAuth credentials on requests
+				useOAuthTokenSource(iter, client, oauthToken)
+			}
+			return nil
+		},
+	}
+
+	microDepositAccountStep = &step{
+		name:      "micro-deposit-account",
+		dependsOn: []string{"oauth"},
+		run: func(ctx context.Context, iter *iteration) error {
+			// Setup our micro-deposit origination account (or read its info if already setup)
+			acct, err := createMicroDepositAccount(ctx, iter.api, iter.user)
+			if err != nil {
+				return err
+			}
+			iter.microDepositAccount = acct
+
+			balance, err := checkMicroDepositBalance(ctx, iter, acct)
+			if err != nil {
+				return err
+			}
+			iter.logf("INFO: micro-deposit account=%s balance=USD %.2f", acct.ID, float64(balance)/100)
+			return nil
+		},
+	}
+
+	originatorStep = &step{
+		name:      "originator",
+		dependsOn: []string{"features", "micro-deposit-account"},
+		run: func(ctx context.Context, iter *iteration) error {
+			// Create Originator Account
+			// We create these accounts because they won't exist in the Accounts service already. (We're using fake data/accounts.)
+			acct, err := createAccount(ctx, iter.api, iter.user, "from account", "")
+			if err != nil {
+				return err
+			}
+			iter.originatorAccount = acct
+			iter.track("account", acct.ID, nil)
+
+			// Create Originator Depository
+			dep, err := createDepository(ctx, iter.api, iter.user, acct)
+			if err != nil {
+				return err
+			}
+			iter.originatorDepository = dep
+			iter.trackDepository(dep)
+			iter.logf("SUCCESS: Created Originator Depository (id=%s) for user", dep.ID)
+
+			// Create Originator
+			orig, err := createOriginator(ctx, iter.api, iter.user, iter.featureFlags, dep.ID)
+			if err != nil {
+				return err
+			}
+			iter.originator = orig
+			iter.track("customer", orig.CustomerID, nil)
+			iter.track("originator", orig.ID, func(ctx context.Context) (*http.Response, error) {
+				return iter.api.OriginatorsApi.DeleteOriginator(ctx, orig.ID, iter.userID, nil)
+			})
+			iter.logf("SUCCESS: Created Originator (id=%s) for user", orig.ID)
+
+			return approveCustomer(ctx, iter, orig.CustomerID)
+		},
+	}
+
+	receiverStep = &step{
+		name:      "receiver",
+		dependsOn: []string{"features", "micro-deposit-account"},
+		run: func(ctx context.Context, iter *iteration) error {
+			// Create Receiver Account
+			acct, err := createAccount(ctx, iter.api, iter.user, "to account", "")
+			if err != nil {
+				return err
+			}
+			iter.receiverAccount = acct
+			iter.track("account", acct.ID, nil)
+
+			// Create Receiver Depository
+			dep, err := createDepository(ctx, iter.api, iter.user, acct)
+			if err != nil {
+				return err
+			}
+			iter.receiverDepository = dep
+			iter.trackDepository(dep)
+			iter.logf("SUCCESS: Created Receiver Depository (id=%s) for user", dep.ID)
+
+			// Create Receiver
+			receiver, err := createReceiver(ctx, iter.api, iter.user, iter.featureFlags, dep.ID)
+			if err != nil {
+				return err
+			}
+			iter.receiver = receiver
+			iter.track("customer", receiver.CustomerID, nil)
+			iter.track("receiver", receiver.ID, func(ctx context.Context) (*http.Response, error) {
+				return iter.api.ReceiversApi.DeleteReceiver(ctx, receiver.ID, iter.userID, nil)
+			})
+			iter.logf("SUCCESS: Created Receiver (id=%s) for user", receiver.ID)
+
+			return approveCustomer(ctx, iter, receiver.CustomerID)
+		},
+	}
+
+	transferStep     = newTransferStep("transfer", "Push")
+	pullTransferStep = newTransferStep("pull-transfer", "Pull")
+
+	transactionsStep     = newTransactionsStep("transactions", transferStep)
+	pullTransactionsStep = newTransactionsStep("pull-transactions", pullTransferStep)
+
+	failedLoginStep = &step{
+		name: "failed-login",
+		run: func(ctx context.Context, iter *iteration) error {
+			// Attempt a Failed login
+			if err := attemptFailedLogin(ctx, iter.api); err != nil {
+				return err
+			}
+			iter.logf("SUCCESS: invalid login credentials were rejected")
+			return nil
+		},
+	}
+
+	failedOAuthStep = &step{
+		name: "failed-oauth",
+		run: func(ctx context.Context, iter *iteration) error {
+			// Attempt a Failed OAuth2 auth check
+			if err := attemptFailedOAuth2Login(ctx, iter.api); err != nil {
+				return err
+			}
+			iter.logf("SUCCESS: invalid OAuth2 access token was rejected")
+			return nil
+		},
+	}
+)
+
+// newTransferStep returns a step called name which originates a transferType (Push or Pull) transfer.
+func newTransferStep(name, transferType string) *step {
+	return &step{
+		name:      name,
+		dependsOn: []string{"originator", "receiver"},
+		run: func(ctx context.Context, iter *iteration) error {
+			tx, err := createTransfer(ctx, iter.api, iter.receiver, iter.originator, transferType, amount(), iter.userID)
+			if err != nil {
+				return err
+			}
+			iter.transfer = tx
+			iter.track("transfer", tx.ID, func(ctx context.Context) (*http.Response, error) {
+				return iter.api.TransfersApi.DeleteTransferByID(ctx, tx.ID, iter.userID, nil)
+			})
+			iter.logf("SUCCESS: Created %s %s transfer (id=%s) for user", tx.Amount, strings.ToLower(transferType), tx.ID)
+			return nil
+		},
+	}
+}
+
+// newTransactionsStep returns a step called name which checks both accounts posted the transfer made by transfer.
+func newTransactionsStep(name string, transfer *step) *step {
+	return &step{
+		name:      name,
+		dependsOn: []string{transfer.name},
+		run: func(ctx context.Context, iter *iteration) error {
+
+			// Verify the Transaction was posted
+			if iter.featureFlags.AccountsCallsDisabled {
+				return nil
+			}
+			// Push transfers move money from the originator to the receiver, Pull transfers the other way.
+			origPurpose, recPurpose := "ACHDebit", "ACHCredit"
+			if strings.EqualFold(iter.transfer.TransferType, "pull") {
+				origPurpose, recPurpose = recPurpose, origPurpose
+			}
+			if err := checkTransactions(ctx, iter.api, iter.originatorAccount.ID, iter.user, iter.transfer.Amount, origPurpose); err != nil {
+				return err
+			}
+			if err := checkTransactions(ctx, iter.api, iter.receiverAccount.ID, iter.user, iter.transfer.Amount, recPurpose); err != nil {
+				return err
+			}
+			iter.logf("SUCCESS: Matched transactions on accounts")
+			return nil
+		},
+	}
+}
+
+// approveCustomer marks customerID as approved when paygate is calling out to Moov's Customers service.
+func approveCustomer(ctx context.Context, iter *iteration, customerID string) error {
+	// By default with -local assume we want to approve customers.
+	if iter.featureFlags.CustomersCallsDisabled {
+		return nil
+	}
+	if err := attemptCustomerApproval(ctx, *flagCustomersAdminAddress, customerID); err != nil {
+		return err
+	}
+	iter.logf("INFO: approved customer=%s", customerID)
+	return nil
+}
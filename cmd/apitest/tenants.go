@@ -0,0 +1,306 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+func init() {
+	registerScenario(&scenario{
+		name: "tenants",
+		steps: []*step{
+			featuresStep,
+			userStep,
+			oauthStep,
+			microDepositAccountStep,
+			originatorStep,
+			receiverStep,
+			transferStep,
+			tenantIsolationStep,
+		},
+	})
+}
+
+// tenantMetadata is written by the other user, so any object which has it was modified across tenants.
+const tenantMetadata = "modified by another tenant"
+
+var (
+	// tenantIsolationStep has a second user read, list, modify and delete the objects our user created,
+	// first with its cookie and then with its OAuth token.
+	tenantIsolationStep = &step{
+		name:      "tenant-isolation",
+		dependsOn: []string{"transfer"},
+		run: func(ctx context.Context, iter *iteration) error {
+			others, err := otherTenantClients(ctx, iter)
+			if err != nil {
+				return err
+			}
+			for _, other := range others {
+				if err := checkTenantIsolation(ctx, iter, other); err != nil {
+					return fmt.Errorf("%s: %v", other.name, err)
+				}
+				iter.logf("SUCCESS: another user's %s can't access our objects", other.name)
+			}
+			return checkTenantObjectsUnchanged(ctx, iter)
+		},
+	}
+)
+
+// tenantClient makes requests as another user.
+type tenantClient struct {
+	name   string
+	api    *moov.APIClient
+	userID string
+}
+
+// otherTenantClients creates a second user with its own cookie and OAuth token.
+func otherTenantClients(ctx context.Context, iter *iteration) ([]*tenantClient, error) {
+	conf := makeConfiguration()
+	conf.AddDefaultHeader("X-Request-ID", iter.requestID)
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+	api := moov.NewAPIClient(conf)
+
+	other, err := createUser(ctx, api)
+	if err != nil {
+		return nil, fmt.Errorf("other user: %v", err)
+	}
+	iter.track("user", other.ID, nil)
+	if err := setMoovAuthCookie(conf, other); err != nil {
+		return nil, err
+	}
+	client, token, err := createOAuthToken(ctx, api, other)
+	if client != nil {
+		iter.track("oauth-client", client.ClientId, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("other user: %v", err)
+	}
+	iter.logf("INFO: Created another user %s to access our objects", other.ID)
+
+	oauthConf := makeConfiguration()
+	oauthConf.AddDefaultHeader("X-Request-ID", iter.requestID)
+	oauthConf.AddDefaultHeader("Origin", "https://moov.io")
+	if err := setMoovOAuthToken(oauthConf, token); err != nil {
+		return nil, err
+	}
+	return []*tenantClient{
+		{name: "cookie", api: api, userID: other.ID},
+		{name: "OAuth token", api: moov.NewAPIClient(oauthConf), userID: other.ID},
+	}, nil
+}
+
+// tenantCall is a request for one of our objects made as another user.
+type tenantCall struct {
+	name string
+	call func(ctx context.Context, other *tenantClient) (*http.Response, error)
+}
+
+// checkTenantIsolation expects every read, modification and deletion of our objects by other to be
+// rejected and our objects to be missing from other's lists.
+func checkTenantIsolation(ctx context.Context, iter *iteration, other *tenantClient) error {
+	var failures []string
+	for _, c := range tenantCalls(iter) {
+		resp, err := c.call(ctx, other)
+		if err := expectTenantRejected(resp, err); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", c.name, err))
+		}
+	}
+	if err := checkTenantLists(ctx, iter, other); err != nil {
+		failures = append(failures, err.Error())
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d cross-tenant requests weren't rejected:\n  %s", len(failures), strings.Join(failures, "\n  "))
+	}
+	return nil
+}
+
+// expectTenantRejected accepts responses which hide or deny another user's object.
+func expectTenantRejected(resp *http.Response, err error) error {
+	if resp == nil {
+		return fmt.Errorf("no response: %v", err)
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return nil
+	}
+	return fmt.Errorf("got HTTP status %s", resp.Status)
+}
+
+func tenantCalls(iter *iteration) []tenantCall {
+	orig, rec, transfer := iter.originator.ID, iter.receiver.ID, iter.transfer.ID
+	deps := []string{iter.originatorDepository.ID, iter.receiverDepository.ID}
+
+	calls := []tenantCall{
+		// read
+		{"get originator", func(ctx context.Context, o *tenantClient) (*http.Response, error) {
+			_, resp, err := o.api.OriginatorsApi.GetOriginatorByID(ctx, orig, o.userID, nil)
+			return resp, err
+		}},
+		{"get receiver", func(ctx context.Context, o *tenantClient) (*http.Response, error) {
+			_, resp, err := o.api.ReceiversApi.GetReceiverByID(ctx, rec, o.userID, nil)
+			return resp, err
+		}},
+		{"get receiver depositories", func(ctx context.Context, o *tenantClient) (*http.Response, error) {
+			_, resp, err := o.api.ReceiversApi.GetDepositoriesByReceiverID(ctx, rec, o.userID, nil)
+			return resp, err
+		}},
+		{"get transfer", func(ctx context.Context, o *tenantClient) (*http.Response, error) {
+			_, resp, err := o.api.TransfersApi.GetTransferByID(ctx, transfer, o.userID, nil)
+			return resp, err
+		}},
+		{"get transfer events", func(ctx context.Context, o *tenantClient) (*http.Response, error) {
+			_, resp, err := o.api.TransfersApi.GetTransferEventsByID(ctx, transfer, o.userID, nil)
+			return resp, err
+		}},
+
+		// modify
+		{"update originator", func(ctx context.Context, o *tenantClient) (*http.Response, error) {
+			_, resp, err := o.api.OriginatorsApi.UpdateOriginator(ctx, orig, o.userID, moov.CreateOriginator{Metadata: tenantMetadata}, nil)
+			return resp, err
+		}},
+		{"update receiver", func(ctx context.Context, o *tenantClient) (*http.Response, error) {
+			_, resp, err := o.api.ReceiversApi.UpdateReceiver(ctx, rec, o.userID, moov.CreateReceiver{Metadata: tenantMetadata}, nil)
+			return resp, err
+		}},
+	}
+	for i := range deps {
+		depID := deps[i]
+		calls = append(calls,
+			tenantCall{"get depository " + depID, func(ctx context.Context, o *tenantClient) (*http.Response, error) {
+				_, resp, err := o.api.DepositoriesApi.GetDepositoryByID(ctx, depID, o.userID, nil)
+				return resp, err
+			}},
+			tenantCall{"update depository " + depID, func(ctx context.Context, o *tenantClient) (*http.Response, error) {
+				_, resp, err := o.api.DepositoriesApi.UpdateDepository(ctx, depID, o.userID, moov.CreateDepository{Metadata: tenantMetadata}, nil)
+				return resp, err
+			}},
+		)
+	}
+
+	// delete, dependent objects first
+	calls = append(calls,
+		tenantCall{"delete transfer", func(ctx context.Context, o *tenantClient) (*http.Response, error) {
+			return o.api.TransfersApi.DeleteTransferByID(ctx, transfer, o.userID, nil)
+		}},
+		tenantCall{"delete receiver", func(ctx context.Context, o *tenantClient) (*http.Response, error) {
+			return o.api.ReceiversApi.DeleteReceiver(ctx, rec, o.userID, nil)
+		}},
+		tenantCall{"delete originator", func(ctx context.Context, o *tenantClient) (*http.Response, error) {
+			return o.api.OriginatorsApi.DeleteOriginator(ctx, orig, o.userID, nil)
+		}},
+	)
+	for i := range deps {
+		depID := deps[i]
+		calls = append(calls, tenantCall{"delete depository " + depID, func(ctx context.Context, o *tenantClient) (*http.Response, error) {
+			return o.api.DepositoriesApi.DeleteDepository(ctx, depID, o.userID, nil)
+		}})
+	}
+	return calls
+}
+
+// checkTenantLists makes sure none of our objects are listed for other.
+func checkTenantLists(ctx context.Context, iter *iteration, other *tenantClient) error {
+	var found []string
+
+	originators, resp, err := other.api.OriginatorsApi.GetOriginators(ctx, other.userID, nil)
+	if err := closeListResponse("originators", resp, err); err != nil {
+		return err
+	}
+	for i := range originators {
+		if originators[i].ID == iter.originator.ID {
+			found = append(found, "originator "+originators[i].ID)
+		}
+	}
+
+	receivers, resp, err := other.api.ReceiversApi.GetReceivers(ctx, other.userID, nil)
+	if err := closeListResponse("receivers", resp, err); err != nil {
+		return err
+	}
+	for i := range receivers {
+		if receivers[i].ID == iter.receiver.ID {
+			found = append(found, "receiver "+receivers[i].ID)
+		}
+	}
+
+	deps, resp, err := other.api.DepositoriesApi.GetDepositories(ctx, other.userID, nil)
+	if err := closeListResponse("depositories", resp, err); err != nil {
+		return err
+	}
+	for i := range deps {
+		if deps[i].ID == iter.originatorDepository.ID || deps[i].ID == iter.receiverDepository.ID {
+			found = append(found, "depository "+deps[i].ID)
+		}
+	}
+
+	transfers, resp, err := other.api.TransfersApi.GetTransfers(ctx, other.userID, nil)
+	if err := closeListResponse("transfers", resp, err); err != nil {
+		return err
+	}
+	for i := range transfers {
+		if transfers[i].ID == iter.transfer.ID {
+			found = append(found, "transfer "+transfers[i].ID)
+		}
+	}
+
+	if len(found) > 0 {
+		return fmt.Errorf("listed our %s", strings.Join(found, ", "))
+	}
+	return nil
+}
+
+func closeListResponse(what string, resp *http.Response, err error) error {
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("problem listing %s: %v", what, err)
+	}
+	return nil
+}
+
+// checkTenantObjectsUnchanged reads our objects back to make sure the other user didn't modify or delete them.
+func checkTenantObjectsUnchanged(ctx context.Context, iter *iteration) error {
+	orig, resp, err := iter.api.OriginatorsApi.GetOriginatorByID(ctx, iter.originator.ID, iter.userID, nil)
+	if err := closeTenantResponse("originator", resp, err, orig.Metadata); err != nil {
+		return err
+	}
+	rec, resp, err := iter.api.ReceiversApi.GetReceiverByID(ctx, iter.receiver.ID, iter.userID, nil)
+	if err := closeTenantResponse("receiver", resp, err, rec.Metadata); err != nil {
+		return err
+	}
+	for _, id := range []string{iter.originatorDepository.ID, iter.receiverDepository.ID} {
+		dep, resp, err := iter.api.DepositoriesApi.GetDepositoryByID(ctx, id, iter.userID, nil)
+		if err := closeTenantResponse("depository "+id, resp, err, dep.Metadata); err != nil {
+			return err
+		}
+	}
+	_, resp, err = iter.api.TransfersApi.GetTransferByID(ctx, iter.transfer.ID, iter.userID, nil)
+	if err := closeTenantResponse("transfer", resp, err, ""); err != nil {
+		return err
+	}
+	iter.logf("SUCCESS: our objects are unchanged after another user's requests")
+	return nil
+}
+
+func closeTenantResponse(what string, resp *http.Response, err error, metadata string) error {
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("problem reading our %s after another user's requests: %v", what, err)
+	}
+	if metadata == tenantMetadata {
+		return fmt.Errorf("our %s was modified by another user", what)
+	}
+	return nil
+}
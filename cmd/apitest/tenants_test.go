@@ -0,0 +1,68 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+func TestTenants__checkTenantIsolation(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/v1/ach/transfers/transfer":
+			json.NewEncoder(w).Encode(moov.Transfer{ID: "transfer"}) // leaks our transfer
+		case r.Method == "GET" && r.URL.Path == "/v1/ach/receivers":
+			json.NewEncoder(w).Encode([]moov.Receiver{{ID: "receiver"}})
+		case r.Method == "GET" && strings.Count(r.URL.Path, "/") == 3:
+			w.Write([]byte("[]"))
+		case r.Method == "DELETE" && r.URL.Path == "/v1/ach/originators/originator":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer svc.Close()
+
+	conf := moov.NewConfiguration()
+	conf.BasePath = svc.URL
+	api := moov.NewAPIClient(conf)
+	iter := &iteration{
+		api:                  api,
+		userID:               "user",
+		originator:           moov.Originator{ID: "originator"},
+		originatorDepository: moov.Depository{ID: "orig-dep"},
+		receiver:             moov.Receiver{ID: "receiver"},
+		receiverDepository:   moov.Depository{ID: "rec-dep"},
+		transfer:             moov.Transfer{ID: "transfer"},
+	}
+
+	err := checkTenantIsolation(context.Background(), iter, &tenantClient{name: "cookie", api: api, userID: "other"})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, expected := range []string{"3 cross-tenant requests", "get transfer: got HTTP status 200 OK", "delete originator: got HTTP status 200 OK", "listed our receiver receiver"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("missing %q: %v", expected, err)
+		}
+	}
+}
+
+func TestTenants__closeTenantResponse(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}
+	if err := closeTenantResponse("originator", resp, nil, ""); err != nil {
+		t.Error(err)
+	}
+	if err := closeTenantResponse("originator", resp, nil, tenantMetadata); err == nil || !strings.Contains(err.Error(), "modified by another user") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
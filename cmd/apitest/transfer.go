@@ -8,6 +8,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
 	"time"
 
@@ -18,6 +19,21 @@ import (
 )
 
 func createDepository(ctx context.Context, api *moov.APIClient, u *user, account *moov.Account) (moov.Depository, error) {
+	dep, err := addDepository(ctx, api, u, account)
+	if err != nil {
+		return dep, err
+	}
+
+	// verify with (known, fixed values) micro-deposits
+	if err := verifyDepository(ctx, api, account.ID, dep, u); err != nil {
+		return dep, fmt.Errorf("problem verifying depository (name: %q) for user (userID=%s): %v", account.Name, u.ID, err)
+	}
+
+	return dep, nil
+}
+
+// addDepository creates an unverified Depository for account.
+func addDepository(ctx context.Context, api *moov.APIClient, u *user, account *moov.Account) (moov.Depository, error) {
 	req := moov.CreateDepository{
 		BankName:      "Moov Bank",
 		AccountNumber: account.AccountNumber,
@@ -38,16 +54,30 @@ func createDepository(ctx context.Context, api *moov.APIClient, u *user, account
 	if err != nil {
 		return dep, fmt.Errorf("problem creating depository (name: %q) for user (userID=%s): %v", account.Name, u.ID, err)
 	}
+	return dep, nil
+}
 
-	// verify with (known, fixed values) micro-deposits
-	if err := verifyDepository(ctx, api, account.ID, dep, u); err != nil {
-		return dep, fmt.Errorf("problem verifying depository (name: %q) for user (userID=%s): %v", account.Name, u.ID, err)
+func verifyDepository(ctx context.Context, api *moov.APIClient, accountID string, dep moov.Depository, u *user) error {
+	microDeposits, err := initiateMicroDeposits(ctx, api, accountID, dep, u)
+	if err != nil {
+		return err
 	}
 
-	return dep, nil
+	if *flagDebug {
+		log.Printf("verifying Depository with micro-deposit amounts: %s", strings.Join(microDeposits.Amounts, ", "))
+	}
+
+	// confirm micro deposits
+	if _, err := confirmMicroDeposits(ctx, api, dep, u, microDeposits); err != nil {
+		return fmt.Errorf("problem verifying micro deposits: %v", err)
+	}
+	return nil
 }
 
-func verifyDepository(ctx context.Context, api *moov.APIClient, accountID string, dep moov.Depository, u *user) error {
+// initiateMicroDeposits starts micro-deposits to the Depository and returns the amounts posted to accountID.
+func initiateMicroDeposits(ctx context.Context, api *moov.APIClient, accountID string, dep moov.Depository, u *user) (moov.Amounts, error) {
+	var microDeposits moov.Amounts
+
 	// start micro deposits
 	resp, err := api.DepositoriesApi.InitiateMicroDeposits(ctx, dep.ID, u.ID, &moov.InitiateMicroDepositsOpts{
 		XIdempotencyKey: optional.NewString(generateID()),
@@ -55,11 +85,11 @@ func verifyDepository(ctx context.Context, api *moov.APIClient, accountID string
 	if resp != nil {
 		resp.Body.Close()
 		if err := checkCORSHeaders(resp); err != nil {
-			return fmt.Errorf("initiate micro-deposits: %v", err)
+			return microDeposits, fmt.Errorf("initiate micro-deposits: %v", err)
 		}
 	}
 	if err != nil {
-		return fmt.Errorf("problem starting micro deposits: %v", err)
+		return microDeposits, fmt.Errorf("problem starting micro deposits: %v", err)
 	}
 
 	// Grab the micro-deposit transactions
@@ -72,34 +102,46 @@ func verifyDepository(ctx context.Context, api *moov.APIClient, accountID string
 		}
 	}
 	if err != nil {
-		return fmt.Errorf("problem getting micro-deposit transaction: %v", err)
+		return microDeposits, fmt.Errorf("problem getting micro-deposit transaction: %v", err)
 	}
-	var microDeposits moov.Amounts
 	for i := range microDepositTransactions {
 		microDeposits.Amounts = append(microDeposits.Amounts, fmt.Sprintf("USD %.2f", microDepositTransactions[i].Lines[0].Amount/100))
 	}
+	return microDeposits, nil
+}
 
-	if *flagDebug {
-		log.Printf("verifying Depository with micro-deposit amounts: %s", strings.Join(microDeposits.Amounts, ", "))
+// confirmMicroDeposits sends amounts to paygate, the response is returned so callers can check its status code.
+func confirmMicroDeposits(ctx context.Context, api *moov.APIClient, dep moov.Depository, u *user, amounts moov.Amounts) (*http.Response, error) {
+	resp, err := api.DepositoriesApi.ConfirmMicroDeposits(ctx, dep.ID, u.ID, amounts, &moov.ConfirmMicroDepositsOpts{
+		XIdempotencyKey: optional.NewString(generateID()),
+	})
+	if resp != nil {
+		resp.Body.Close()
+		if err := checkCORSHeaders(resp); err != nil {
+			return resp, fmt.Errorf("confirm micro-deposits: %v", err)
+		}
 	}
+	return resp, err
+}
 
-	// confirm micro deposits
-	resp, err = api.DepositoriesApi.ConfirmMicroDeposits(ctx, dep.ID, u.ID, microDeposits, &moov.ConfirmMicroDepositsOpts{
+func createOriginator(ctx context.Context, api *moov.APIClient, u *user, flags *featureFlags, depId string) (moov.Originator, error) {
+	req := originatorRequest(flags, depId)
+	orig, resp, err := api.OriginatorsApi.AddOriginator(ctx, u.ID, req, &moov.AddOriginatorOpts{
 		XIdempotencyKey: optional.NewString(generateID()),
 	})
 	if resp != nil {
 		resp.Body.Close()
 		if err := checkCORSHeaders(resp); err != nil {
-			return fmt.Errorf("confirm micro-deposits: %v", err)
+			return orig, fmt.Errorf("create originator: %v", err)
 		}
 	}
 	if err != nil {
-		return fmt.Errorf("problem verifying micro deposits: %v", err)
+		return orig, fmt.Errorf("problem creating originator: %v", err)
 	}
-	return nil
+	return orig, nil
 }
 
-func createOriginator(ctx context.Context, api *moov.APIClient, u *user, flags *featureFlags, depId string) (moov.Originator, error) {
+func originatorRequest(flags *featureFlags, depId string) moov.CreateOriginator {
 	first, _ := name()
 	req := moov.CreateOriginator{
 		DefaultDepository: depId,
@@ -117,22 +159,27 @@ func createOriginator(ctx context.Context, api *moov.APIClient, u *user, flags *
 			PostalCode: "90301",
 		}
 	}
-	orig, resp, err := api.OriginatorsApi.AddOriginator(ctx, u.ID, req, &moov.AddOriginatorOpts{
+	return req
+}
+
+func createReceiver(ctx context.Context, api *moov.APIClient, u *user, flags *featureFlags, depId string) (moov.Receiver, error) {
+	req := receiverRequest(u, flags, depId)
+	receiver, resp, err := api.ReceiversApi.AddReceivers(ctx, u.ID, req, &moov.AddReceiversOpts{
 		XIdempotencyKey: optional.NewString(generateID()),
 	})
 	if resp != nil {
 		resp.Body.Close()
 		if err := checkCORSHeaders(resp); err != nil {
-			return orig, fmt.Errorf("create originator: %v", err)
+			return receiver, fmt.Errorf("create receiver: %v", err)
 		}
 	}
 	if err != nil {
-		return orig, fmt.Errorf("problem creating originator: %v", err)
+		return receiver, fmt.Errorf("problem creating receiver: %v", err)
 	}
-	return orig, nil
+	return receiver, nil
 }
 
-func createReceiver(ctx context.Context, api *moov.APIClient, u *user, flags *featureFlags, depId string) (moov.Receiver, error) {
+func receiverRequest(u *user, flags *featureFlags, depId string) moov.CreateReceiver {
 	req := moov.CreateReceiver{
 		Email:             email(name()), // new random email address
 		DefaultDepository: depId,
@@ -150,24 +197,71 @@ func createReceiver(ctx context.Context, api *moov.APIClient, u *user, flags *fe
 			PostalCode: "90301",
 		}
 	}
-	receiver, resp, err := api.ReceiversApi.AddReceivers(ctx, u.ID, req, &moov.AddReceiversOpts{
+	return req
+}
+
+// supportedSECCodes are the Standard Entry Class codes paygate can originate transfers with.
+var supportedSECCodes = []string{ach.CCD, ach.IAT, ach.PPD, ach.TEL, ach.WEB}
+
+// validateACHType checks -ach.type is a SEC code we can create transfers for, so a typo fails before any
+// users or transfers are created.
+func validateACHType(code string) error {
+	for i := range supportedSECCodes {
+		if code == supportedSECCodes[i] {
+			return nil
+		}
+	}
+	options := strings.Join(supportedSECCodes, ", ")
+	switch code {
+	case ach.ARC, ach.BOC, ach.COR, ach.CTX, ach.POP:
+		// CreateTransfer has no fields for their details (e.g. check serial numbers or CTX addenda),
+		// so paygate can't build valid entries for them.
+		return fmt.Errorf("-ach.type %s is not supported by paygate transfers, options: %s", code, options)
+	}
+	return fmt.Errorf("unknown -ach.type %q, options: %s", code, options)
+}
+
+// validateTransferTypes rejects scenarios which would push (credit) funds with a SEC code only valid for debits.
+func validateTransferTypes(code string, selected []*scenario) error {
+	if code != ach.TEL {
+		return nil
+	}
+	for _, sc := range selected {
+		for _, st := range sc.steps {
+			if st == transferStep {
+				return fmt.Errorf("%s entries can only debit the receiver, the %s scenario pushes funds (try -scenario=pull)", code, sc.name)
+			}
+		}
+	}
+	return nil
+}
+
+// createTransfer originates a transfer of amount between orig and receiver. Push transfers credit the
+// receiver's account and Pull transfers debit it.
+func createTransfer(ctx context.Context, api *moov.APIClient, receiver moov.Receiver, orig moov.Originator, transferType, amount string, userID string) (moov.Transfer, error) {
+	req, err := transferRequest(receiver, orig, transferType, amount)
+	if err != nil {
+		return moov.Transfer{}, err
+	}
+	tx, resp, err := api.TransfersApi.AddTransfer(ctx, userID, req, &moov.AddTransferOpts{
 		XIdempotencyKey: optional.NewString(generateID()),
 	})
 	if resp != nil {
 		resp.Body.Close()
 		if err := checkCORSHeaders(resp); err != nil {
-			return receiver, fmt.Errorf("create receiver: %v", err)
+			return tx, fmt.Errorf("create transfer: %v", err)
 		}
 	}
 	if err != nil {
-		return receiver, fmt.Errorf("problem creating receiver: %v", err)
+		return tx, fmt.Errorf("problem creating %s %s transfer: %v", amount, transferType, err)
 	}
-	return receiver, nil
+	return tx, nil
 }
 
-func createTransfer(ctx context.Context, api *moov.APIClient, receiver moov.Receiver, orig moov.Originator, amount string, userID string) (moov.Transfer, error) {
+// transferRequest builds a transfer with the SEC code from -ach.type and its details.
+func transferRequest(receiver moov.Receiver, orig moov.Originator, transferType, amount string) (moov.CreateTransfer, error) {
 	req := moov.CreateTransfer{
-		TransferType:         "Push",
+		TransferType:         transferType,
 		Amount:               amount,
 		Originator:           orig.ID,
 		OriginatorDepository: orig.DefaultDepository,
@@ -175,45 +269,22 @@ func createTransfer(ctx context.Context, api *moov.APIClient, receiver moov.Rece
 		ReceiverDepository:   receiver.DefaultDepository,
 		Description:          fmt.Sprintf("apitest transfer to %s", receiver.Metadata),
 	}
+	req.StandardEntryClassCode = *flagACHType
 	switch *flagACHType {
+	case ach.CCD:
+		req.CCDDetail = createCCDDetail()
 	case ach.IAT:
-		req.StandardEntryClassCode = "IAT"
 		req.IATDetail = createIATDetail(receiver, orig)
 	case ach.PPD:
-		req.StandardEntryClassCode = "PPD"
+		// PPD transfers need no extra details
+	case ach.TEL:
+		req.TELDetail = createTELDetail()
 	case ach.WEB:
-		req.StandardEntryClassCode = "WEB"
 		req.WEBDetail = createWEBDetail()
-
-	}
-
-	tx, resp, err := api.TransfersApi.AddTransfer(ctx, userID, req, &moov.AddTransferOpts{
-		XIdempotencyKey: optional.NewString(generateID()),
-	})
-	if resp != nil {
-		resp.Body.Close()
-		if err := checkCORSHeaders(resp); err != nil {
-			return tx, fmt.Errorf("create transfer: %v", err)
-		}
+	default:
+		return req, fmt.Errorf("unsupported -ach.type %s", *flagACHType)
 	}
-	if err != nil {
-		return tx, fmt.Errorf("problem creating %s transfer: %v", amount, err)
-	}
-
-	if *flagCleanup {
-		// Delete the transfer (and underlying file) since we're only making one Transfer
-		resp, err = api.TransfersApi.DeleteTransferByID(ctx, tx.ID, userID, &moov.DeleteTransferByIDOpts{})
-		if resp != nil {
-			resp.Body.Close()
-			if err := checkCORSHeaders(resp); err != nil {
-				return tx, fmt.Errorf("delete transfer: %v", err)
-			}
-		}
-		if err != nil {
-			return tx, fmt.Errorf("problem deleting transfer: %v", err)
-		}
-	}
-	return tx, nil
+	return req, nil
 }
 
 func createIATDetail(receiver moov.Receiver, orig moov.Originator) moov.IatDetail {
@@ -245,6 +316,19 @@ func createIATDetail(receiver moov.Receiver, orig moov.Originator) moov.IatDetai
 	}
 }
 
+func createCCDDetail() moov.CcdDetail {
+	return moov.CcdDetail{
+		PaymentInformation: "apitest corporate payment",
+	}
+}
+
+func createTELDetail() moov.TelDetail {
+	return moov.TelDetail{
+		PhoneNumber: "5555555555",
+		PaymentType: "single",
+	}
+}
+
 func createWEBDetail() moov.WebDetail {
 	return moov.WebDetail{
 		PaymentInformation: "apitest payment",
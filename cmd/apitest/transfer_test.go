@@ -0,0 +1,36 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestTransfer__validateACHType(t *testing.T) {
+	for _, code := range []string{"CCD", "IAT", "PPD", "TEL", "WEB"} {
+		if err := validateACHType(code); err != nil {
+			t.Errorf("%s: %v", code, err)
+		}
+	}
+	for _, code := range []string{"", "ppd", "CTX", "COR", "ARC", "BOC", "POP", "XYZ"} {
+		if err := validateACHType(code); err == nil {
+			t.Errorf("%s: expected error", code)
+		}
+	}
+}
+
+func TestTransfer__validateTransferTypes(t *testing.T) {
+	push, pull := scenarios["push"], scenarios["pull"]
+
+	if err := validateTransferTypes("TEL", []*scenario{pull}); err != nil {
+		t.Error(err)
+	}
+	if err := validateTransferTypes("TEL", []*scenario{pull, push}); err == nil {
+		t.Error("expected error")
+	}
+	if err := validateTransferTypes("PPD", []*scenario{push}); err != nil {
+		t.Error(err)
+	}
+}
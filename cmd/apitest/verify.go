@@ -10,9 +10,13 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/moov-io/ach"
+	moov "github.com/moov-io/go-client/client"
 )
 
 func verifyDirIsEmpty(dir string) bool {
@@ -31,89 +35,434 @@ func verifyDirIsEmpty(dir string) bool {
 	return true
 }
 
-// verifyTransfersWereMerged will take the incoming iterations (i.e. Transfers and related metadata) to
-// verify all transfers exist in the merged ACH files in dir. This is done to help ensure paygate handles
-// and uploads all the given transfers to the FED / receiving FI.
-func verifyTransfersWereMerged(dir string, iterations []*iteration) error {
-	iterationsBeforeMatching, mergedFilesProcessed := len(iterations), 0
+// waitForMergedTransfers polls src (a local directory or FTP / SFTP server) for new or changed ACH files until
+// every transfer is matched, or returns the remaining mismatches once timeout has passed. Files are re-read as
+// paygate writes and updates them. This is done to help ensure paygate handles and uploads all the given
+// transfers to the FED / receiving FI.
+//
+// Each transfer must match an entry field by field (see mergedEntry.diff). When only entries with
+// differing fields are found the closest one is reported as a diff.
+func waitForMergedTransfers(src mergedFileSource, iterations []*iteration, timeout, interval time.Duration) error {
 	if len(iterations) == 0 {
 		return fmt.Errorf("no iterations (transfers) found")
 	}
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if (err != nil && err != filepath.SkipDir) || info.IsDir() {
-			return nil // Ignore SkipDir and directories
-		}
+	log.Printf("Waiting up to %v for paygate to collect and merge %d transfers into %s", timeout, len(iterations), src)
 
-		file, err := parseACHFilepath(path)
-		if err != nil {
-			return fmt.Errorf("error reading %s: %v", path, err)
+	w := newMergedFileWatcher(src)
+	deadline := time.Now().Add(timeout)
+	found := make(map[*iteration]bool)
+	for {
+		if err := w.refresh(); err != nil {
+			return err
 		}
-		i := -1
-		mergedFilesProcessed++
-		for {
-			i++
-			if i >= len(iterations) {
-				break
+		matched, problems := matchTransfers(w.entries(), iterations)
+		for _, iter := range matched {
+			if !found[iter] {
+				found[iter] = true
+				log.Printf("INFO: Matched transfer %s for %s", iter.transfer.ID, iter.transfer.Amount)
 			}
-			if file.Header.ImmediateOrigin != iterations[i].originatorDepository.RoutingNumber {
+		}
+		if len(problems) == 0 || time.Now().After(deadline) {
+			return verifyResult(len(iterations), len(w.files), append(problems, w.errors()...))
+		}
+		log.Printf("INFO: matched %d/%d transfers in %d merged files, checking again in %v (%v left)",
+			len(matched), len(iterations), len(w.files), interval, time.Until(deadline).Truncate(time.Second))
+		time.Sleep(interval)
+	}
+}
+
+// withTransfers returns the iterations whose scenario created a transfer.
+func withTransfers(iterations []*iteration) []*iteration {
+	var out []*iteration
+	for _, iter := range iterations {
+		if iter.transfer.ID != "" {
+			out = append(out, iter)
+		}
+	}
+	return out
+}
+
+// matchTransfers pairs each iteration's transfer with an unmatched entry. Transfers without an exact match
+// are described in problems.
+func matchTransfers(entries []*mergedEntry, iterations []*iteration) ([]*iteration, []string) {
+	var matched []*iteration
+	var problems []string
+	for _, iter := range iterations {
+		var closest *mergedEntry
+		var closestDiffs []fieldDiff
+		found := false
+		for _, entry := range entries {
+			if entry.matched || !entry.sameParties(iter) {
 				continue
 			}
-			if file.Header.ImmediateDestination != iterations[i].receiverDepository.RoutingNumber {
+			if *flagDebug {
+				log.Printf("DEBUG: amounts %s vs %s\n", iter.transfer.Amount, entry.amount())
+			}
+			if entry.amount() != iter.transfer.Amount {
 				continue
 			}
-			if *flagDebug {
-				log.Printf("origin: %s vs %s destination: %s vs %s\n",
-					file.Header.ImmediateOrigin, iterations[i].originatorDepository.RoutingNumber,
-					file.Header.ImmediateDestination, iterations[i].receiverDepository.RoutingNumber)
+			diffs := entry.diff(iter)
+			if len(diffs) == 0 {
+				entry.matched, found = true, true
+				break
 			}
-			// Check file's batches
-			for j := range file.Batches {
-				entries := file.Batches[j].GetEntries()
-				for k := range entries {
-					amount := fmt.Sprintf("USD %.2f", float64(entries[k].Amount)/100.0) // TODO(adam): use paygate's shared Amount type
-					if *flagDebug {
-						log.Printf("DEBUG: amounts %s vs %s\n", iterations[i].transfer.Amount, amount)
-					}
-					if iterations[i].transfer.Amount == amount {
-						log.Printf("INFO: Matched transfer %s for %s", iterations[i].transfer.ID, iterations[i].transfer.Amount)
-						// found a match // TODO(adam): compare more fields?
-						iterations = append(iterations[:i], iterations[i+1:]...) // remove iteration
-						i = -1                                                   // reset i so we reprocess entire iterations array
-						goto next
-					}
-				}
+			if closest == nil || len(diffs) < len(closestDiffs) {
+				closest, closestDiffs = entry, diffs
 			}
-		next:
-			// check the next iteration, iterations leftover are those that weren't found in a file
 		}
+		if found {
+			matched = append(matched, iter)
+			continue
+		}
+		if closest == nil {
+			problems = append(problems, fmt.Sprintf("%s (amount: %s) not found", iter.transfer.ID, iter.transfer.Amount))
+			continue
+		}
+		lines := []string{fmt.Sprintf("%s (amount: %s) differs from trace number %s in %s:", iter.transfer.ID, iter.transfer.Amount, closest.traceNumber(), filepath.Base(closest.path))}
+		for _, d := range closestDiffs {
+			lines = append(lines, fmt.Sprintf("  - %s: %q", d.field, d.want), fmt.Sprintf("  + %s: %q", d.field, d.got))
+		}
+		problems = append(problems, strings.Join(lines, "\n"))
+	}
+	return matched, problems
+}
+
+func verifyResult(transfers, mergedFilesProcessed int, problems []string) error {
+	if len(problems) > 0 {
+		if len(problems) >= transfers || mergedFilesProcessed == 0 {
+			log.Printf("0/%d transfers matched, did paygate create any merged files? (%d files processed)", transfers, mergedFilesProcessed)
+		}
+		return fmt.Errorf("transfers not matched!!\n%s", strings.Join(problems, "\n"))
+	}
+	log.Printf("SUCCESS: all transfers matched in merged file(s)")
+	return nil
+}
+
+// mergedEntry is an EntryDetail or IATEntryDetail read from a merged file which a transfer can match.
+type mergedEntry struct {
+	path    string
+	header  ach.FileHeader
+	matched bool
+
+	batch *ach.BatchHeader
+	entry *ach.EntryDetail
+
+	iatBatch *ach.IATBatchHeader
+	iatEntry *ach.IATEntryDetail
+}
+
+// fieldDiff is a field of a merged entry which didn't have the value expected from a transfer.
+type fieldDiff struct {
+	field string
+	want  string
+	got   string
+}
+
+func fileEntries(path string, file *ach.File) []*mergedEntry {
+	var entries []*mergedEntry
+	for i := range file.Batches {
+		bh := file.Batches[i].GetHeader()
+		for _, ed := range file.Batches[i].GetEntries() {
+			entries = append(entries, &mergedEntry{path: path, header: file.Header, batch: bh, entry: ed})
+		}
+	}
+	for i := range file.IATBatches {
+		bh := file.IATBatches[i].GetHeader()
+		for _, ed := range file.IATBatches[i].GetEntries() {
+			entries = append(entries, &mergedEntry{path: path, header: file.Header, iatBatch: bh, iatEntry: ed})
+		}
+	}
+	return entries
+}
+
+// mergedFileSource is where merged files are read from, either a local directory or the FTP / SFTP
+// server paygate uploads to.
+type mergedFileSource interface {
+	// list returns every file under the source's directory
+	list() ([]sourceFile, error)
+	open(path string) (io.ReadCloser, error)
+	close() error
+
+	String() string
+}
+
+type sourceFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// localDir is a directory of merged files on this host.
+type localDir string
+
+func (dir localDir) list() ([]sourceFile, error) {
+	var files []sourceFile
+	err := filepath.Walk(string(dir), func(path string, info os.FileInfo, err error) error {
+		if (err != nil && err != filepath.SkipDir) || info.IsDir() {
+			return nil // Ignore SkipDir and directories
+		}
+		files = append(files, sourceFile{path: path, modTime: info.ModTime(), size: info.Size()})
 		return nil
 	})
+	return files, err
+}
+
+func (dir localDir) open(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+func (dir localDir) close() error {
+	return nil
+}
+
+func (dir localDir) String() string {
+	return string(dir)
+}
+
+// mergedFileWatcher keeps the entries of every ACH file in a source, re-reading files as they change.
+type mergedFileWatcher struct {
+	src   mergedFileSource
+	files map[string]*watchedFile
+}
+
+type watchedFile struct {
+	modTime time.Time
+	size    int64
+
+	file *ach.File
+	err  error // the file might be partially written, so it's read again once changed
+}
+
+func newMergedFileWatcher(src mergedFileSource) *mergedFileWatcher {
+	return &mergedFileWatcher{
+		src:   src,
+		files: make(map[string]*watchedFile),
+	}
+}
+
+// refresh reads new or changed files and forgets about removed files.
+func (w *mergedFileWatcher) refresh() error {
+	infos, err := w.src.list()
 	if err != nil {
-		return err
+		return fmt.Errorf("problem listing %s: %v", w.src, err)
 	}
-	if len(iterations) > 0 {
-		var transferLine []string
-		for i := range iterations {
-			transferLine = append(transferLine, fmt.Sprintf("%s (amount: %s)", iterations[i].transfer.ID, iterations[i].transfer.Amount))
+	seen := make(map[string]bool)
+	for _, info := range infos {
+		seen[info.path] = true
+
+		if wf, exists := w.files[info.path]; exists && wf.modTime.Equal(info.modTime) && wf.size == info.size {
+			continue // unchanged
 		}
-		if iterationsBeforeMatching == len(iterations) || mergedFilesProcessed == 0 {
-			log.Printf("0/%d transfers matched, did paygate create any merged files? (%d files processed)", iterationsBeforeMatching, mergedFilesProcessed)
+		wf := &watchedFile{modTime: info.modTime, size: info.size}
+		wf.file, wf.err = readACHFile(w.src, info.path)
+		if *flagDebug {
+			log.Printf("DEBUG: read %s (error: %v)", info.path, wf.err)
+		}
+		w.files[info.path] = wf
+	}
+	for path := range w.files {
+		if !seen[path] {
+			delete(w.files, path)
 		}
-		return fmt.Errorf(fmt.Sprintf("transfers not matched!!\n%s", strings.Join(transferLine, "\n")))
-	} else {
-		log.Printf("SUCCESS: all transfers matched in merged file(s)")
 	}
 	return nil
 }
 
+// entries returns every unmatched entry of the files which could be read, in filename order.
+func (w *mergedFileWatcher) entries() []*mergedEntry {
+	var paths []string
+	for path := range w.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var entries []*mergedEntry
+	for _, path := range paths {
+		if wf := w.files[path]; wf.err == nil {
+			entries = append(entries, fileEntries(path, wf.file)...)
+		}
+	}
+	return entries
+}
+
+// errors describes files which couldn't be read.
+func (w *mergedFileWatcher) errors() []string {
+	var out []string
+	for path, wf := range w.files {
+		if wf.err != nil {
+			out = append(out, fmt.Sprintf("error reading %s: %v", path, wf.err))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (e *mergedEntry) sameParties(iter *iteration) bool {
+	if *flagDebug {
+		log.Printf("origin: %s vs %s destination: %s vs %s\n",
+			e.header.ImmediateOrigin, iter.originatorDepository.RoutingNumber,
+			e.header.ImmediateDestination, iter.receiverDepository.RoutingNumber)
+	}
+	return e.header.ImmediateOrigin == iter.originatorDepository.RoutingNumber &&
+		e.header.ImmediateDestination == iter.receiverDepository.RoutingNumber
+}
+
+func (e *mergedEntry) amount() string {
+	cents := 0
+	if e.entry != nil {
+		cents = e.entry.Amount
+	} else {
+		cents = e.iatEntry.Amount
+	}
+	return fmt.Sprintf("USD %.2f", float64(cents)/100.0) // TODO(adam): use paygate's shared Amount type
+}
+
+func (e *mergedEntry) traceNumber() string {
+	if e.entry != nil {
+		return e.entry.TraceNumber
+	}
+	return e.iatEntry.TraceNumber
+}
+
+// diff compares the entry against what paygate should have created for the iteration's transfer.
+func (e *mergedEntry) diff(iter *iteration) []fieldDiff {
+	var diffs []fieldDiff
+	check := func(field, want, got string) {
+		if want != got {
+			diffs = append(diffs, fieldDiff{field: field, want: want, got: got})
+		}
+	}
+	// checkText allows for got to be truncated to the width of its record field
+	checkText := func(field, want, got string) {
+		want, got = strings.TrimSpace(want), strings.TrimSpace(got)
+		if want == "" {
+			return // nothing to compare against
+		}
+		if got == "" || !strings.HasPrefix(strings.ToUpper(want), strings.ToUpper(got)) {
+			diffs = append(diffs, fieldDiff{field: field, want: want, got: got})
+		}
+	}
+
+	tr, dep := iter.transfer, iter.receiverDepository
+	sec := strings.ToUpper(tr.StandardEntryClassCode)
+	if sec == "" {
+		sec = *flagACHType
+	}
+	odfi := iter.originatorDepository.RoutingNumber
+	if len(odfi) > 8 {
+		odfi = odfi[:8]
+	}
+
+	if e.entry != nil {
+		check("standardEntryClassCode", sec, e.batch.StandardEntryClassCode)
+		check("ODFIIdentification", odfi, e.batch.ODFIIdentification)
+		check("transactionCode", strconv.Itoa(expectedTransactionCode(tr, dep)), strconv.Itoa(e.entry.TransactionCode))
+		check("DFIAccountNumber", dep.AccountNumber, strings.TrimSpace(e.entry.DFIAccountNumber))
+		checkText("individualName", dep.Holder, e.entry.IndividualName)
+		if strings.TrimSpace(e.entry.IdentificationNumber) == "" {
+			diffs = append(diffs, fieldDiff{field: "identificationNumber", want: "<non-blank>", got: ""})
+		}
+		checkTraceNumber(check, e.batch.ODFIIdentification, e.entry.TraceNumber)
+		checkEffectiveEntryDate(check, tr, e.batch.EffectiveEntryDate)
+
+		switch sec {
+		case ach.CCD:
+			checkText("addenda05.paymentRelatedInformation", tr.CCDDetail.PaymentInformation, addenda05(e.entry))
+		case ach.TEL:
+			check("paymentType", expectedPaymentType(tr.TELDetail.PaymentType), strings.TrimSpace(e.entry.DiscretionaryData))
+		case ach.WEB:
+			check("paymentType", expectedPaymentType(tr.WEBDetail.PaymentType), strings.TrimSpace(e.entry.DiscretionaryData))
+			checkText("addenda05.paymentRelatedInformation", tr.WEBDetail.PaymentInformation, addenda05(e.entry))
+		}
+		return diffs
+	}
+
+	check("standardEntryClassCode", sec, e.iatBatch.StandardEntryClassCode)
+	check("ODFIIdentification", odfi, e.iatBatch.ODFIIdentification)
+	check("transactionCode", strconv.Itoa(expectedTransactionCode(tr, dep)), strconv.Itoa(e.iatEntry.TransactionCode))
+	check("DFIAccountNumber", dep.AccountNumber, strings.TrimSpace(e.iatEntry.DFIAccountNumber))
+	checkTraceNumber(check, e.iatBatch.ODFIIdentification, e.iatEntry.TraceNumber)
+	checkEffectiveEntryDate(check, tr, e.iatBatch.EffectiveEntryDate)
+
+	detail := tr.IATDetail
+	if e.iatEntry.Addenda10 == nil || e.iatEntry.Addenda11 == nil || e.iatEntry.Addenda13 == nil || e.iatEntry.Addenda14 == nil || e.iatEntry.Addenda15 == nil {
+		return append(diffs, fieldDiff{field: "addenda", want: "addenda10 through addenda16", got: "missing records"})
+	}
+	checkText("addenda10.name", detail.ReceiverName, e.iatEntry.Addenda10.Name)
+	check("addenda10.foreignPaymentAmount", strconv.Itoa(e.iatEntry.Amount), strconv.Itoa(e.iatEntry.Addenda10.ForeignPaymentAmount))
+	checkText("addenda11.originatorName", detail.OriginatorName, e.iatEntry.Addenda11.OriginatorName)
+	checkText("addenda11.originatorStreetAddress", detail.OriginatorAddress, e.iatEntry.Addenda11.OriginatorStreetAddress)
+	checkText("addenda13.ODFIName", detail.ODFIName, e.iatEntry.Addenda13.ODFIName)
+	checkText("addenda14.RDFIName", detail.RDFIName, e.iatEntry.Addenda14.RDFIName)
+	checkText("addenda15.receiverStreetAddress", detail.ReceiverAddress, e.iatEntry.Addenda15.ReceiverStreetAddress)
+	return diffs
+}
+
+// expectedTransactionCode returns the credit (push) or debit (pull) code for the receiver's account type.
+func expectedTransactionCode(tr moov.Transfer, dep moov.Depository) int {
+	pull := strings.EqualFold(tr.TransferType, "pull")
+	savings := strings.EqualFold(dep.Type, "savings")
+	switch {
+	case pull && savings:
+		return ach.SavingsDebit
+	case pull:
+		return ach.CheckingDebit
+	case savings:
+		return ach.SavingsCredit
+	}
+	return ach.CheckingCredit
+}
+
+// expectedPaymentType returns the WEB and TEL discretionary data for single or recurring payments.
+func expectedPaymentType(paymentType string) string {
+	if strings.EqualFold(paymentType, "recurring") {
+		return "R"
+	}
+	return "S"
+}
+
+func addenda05(ed *ach.EntryDetail) string {
+	if len(ed.Addenda05) == 0 {
+		return ""
+	}
+	return ed.Addenda05[0].PaymentRelatedInformation
+}
+
+// checkTraceNumber expects the trace number to be the batch's ODFI followed by a 7 digit sequence number.
+func checkTraceNumber(check func(field, want, got string), odfi, traceNumber string) {
+	if len(traceNumber) != 15 || !strings.HasPrefix(traceNumber, odfi) {
+		check("traceNumber", odfi+"NNNNNNN", traceNumber)
+	}
+}
+
+// checkEffectiveEntryDate expects entries to settle within a week of the transfer's creation.
+func checkEffectiveEntryDate(check func(field, want, got string), tr moov.Transfer, effective string) {
+	if tr.Created.IsZero() {
+		return
+	}
+	date, err := time.Parse("060102", effective)
+	if err != nil {
+		check("effectiveEntryDate", "YYMMDD", effective)
+		return
+	}
+	created := tr.Created.UTC().Truncate(24 * time.Hour)
+	if date.Before(created) || date.After(created.AddDate(0, 0, 7)) {
+		check("effectiveEntryDate", fmt.Sprintf("%s to %s", created.Format("060102"), created.AddDate(0, 0, 7).Format("060102")), effective)
+	}
+}
+
 func parseACHFilepath(path string) (*ach.File, error) {
-	fd, err := os.Open(path)
+	return readACHFile(localDir(filepath.Dir(path)), path)
+}
+
+func readACHFile(src mergedFileSource, path string) (*ach.File, error) {
+	r, err := src.open(path)
 	if err != nil {
 		return nil, err
 	}
-	defer fd.Close()
+	defer r.Close()
 
-	file, err := ach.NewReader(fd).Read()
+	file, err := ach.NewReader(r).Read()
 	if err != nil {
 		return nil, err
 	}
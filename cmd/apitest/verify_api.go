@@ -0,0 +1,164 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/moov-io/ach"
+)
+
+var (
+	flagVerifyTransfersAPI = flag.Bool("verify-transfers.api", false, "Verify the created transfers through paygate's transfer files and events endpoints")
+	flagVerifyStatuses     = flag.String("verify-transfers.status", "processed,reclaimed", "Comma separated transfer statuses accepted with -verify-transfers.api, pending transfers haven't been merged yet")
+)
+
+// verifyTransfersThroughAPI polls paygate for each transfer's ACH files, events and status until every
+// transfer has been merged, or returns what's missing once timeout has passed. Unlike -verify-transfers.dir
+// this works against remote environments where paygate's merged files can't be read.
+func verifyTransfersThroughAPI(ctx context.Context, iterations []*iteration, statuses []string, timeout, interval time.Duration) error {
+	if len(iterations) == 0 {
+		return fmt.Errorf("no iterations (transfers) found")
+	}
+	log.Printf("Waiting up to %v for paygate to merge %d transfers", timeout, len(iterations))
+
+	deadline := time.Now().Add(timeout)
+	verified := make(map[*iteration]bool)
+	for {
+		var problems []string
+		for _, iter := range iterations {
+			if verified[iter] {
+				continue
+			}
+			if err := verifyTransferThroughAPI(ctx, iter, statuses); err != nil {
+				problems = append(problems, fmt.Sprintf("%s (amount: %s) %v", iter.transfer.ID, iter.transfer.Amount, err))
+				continue
+			}
+			verified[iter] = true
+			log.Printf("INFO: Verified transfer %s for %s", iter.transfer.ID, iter.transfer.Amount)
+		}
+		if len(problems) == 0 {
+			log.Printf("SUCCESS: all transfers verified through the paygate API")
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("transfers not verified!!\n%s", strings.Join(problems, "\n"))
+		}
+		log.Printf("INFO: verified %d/%d transfers, checking again in %v (%v left)",
+			len(verified), len(iterations), interval, time.Until(deadline).Truncate(time.Second))
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// verifyTransferThroughAPI checks a transfer has an allowed status, at least one event and an ACH file
+// containing an entry which matches it. paygate serves a transfer's file and creation event as soon as
+// it's created, so only the status shows the transfer was merged.
+func verifyTransferThroughAPI(ctx context.Context, iter *iteration, statuses []string) error {
+	tr, resp, err := iter.api.TransfersApi.GetTransferByID(ctx, iter.transfer.ID, iter.userID, nil)
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("problem reading transfer: %v", err)
+	}
+	if !containsFold(statuses, tr.Status) {
+		return fmt.Errorf("has status %q, expected one of %s", tr.Status, strings.Join(statuses, ", "))
+	}
+
+	events, resp, err := iter.api.TransfersApi.GetTransferEventsByID(ctx, iter.transfer.ID, iter.userID, nil)
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("problem reading events: %v", err)
+	}
+	if len(events) == 0 {
+		return errors.New("has no events")
+	}
+
+	files, err := getTransferFiles(ctx, iter)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("has no ACH files")
+	}
+	var entries []*mergedEntry
+	for i := range files {
+		entries = append(entries, fileEntries(files[i].ID, files[i])...)
+	}
+	if _, problems := matchTransfers(entries, []*iteration{iter}); len(problems) > 0 {
+		prefix := fmt.Sprintf("%s (amount: %s) ", iter.transfer.ID, iter.transfer.Amount)
+		return errors.New(strings.TrimPrefix(problems[0], prefix))
+	}
+	return nil
+}
+
+func containsFold(values []string, v string) bool {
+	for i := range values {
+		if strings.EqualFold(strings.TrimSpace(values[i]), v) {
+			return true
+		}
+	}
+	return false
+}
+
+// getTransferFiles reads the ACH files of a transfer. go-client's File model doesn't match the JSON of
+// moov-io/ach (and drops IAT entries) so the response is parsed with ach instead.
+func getTransferFiles(ctx context.Context, iter *iteration) ([]*ach.File, error) {
+	address := fmt.Sprintf("%s/v1/ach/transfers/%s/files", strings.TrimSuffix(iter.conf.BasePath, "/"), iter.transfer.ID)
+	req, err := http.NewRequest("POST", address, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range iter.conf.DefaultHeader {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("User-Agent", iter.conf.UserAgent)
+	req.Header.Set("X-User-ID", iter.userID)
+
+	resp, err := iter.conf.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("problem reading transfer files: %v", err)
+	}
+	defer resp.Body.Close()
+
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("problem reading transfer files: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("problem reading transfer files: %s: %s", resp.Status, strings.TrimSpace(string(bs)))
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(bs, &raw); err != nil {
+		return nil, fmt.Errorf("problem reading transfer files: %v", err)
+	}
+	files := make([]*ach.File, 0, len(raw))
+	for i := range raw {
+		file, err := ach.FileFromJSON(raw[i])
+		if err != nil {
+			return nil, fmt.Errorf("problem parsing transfer file: %v", err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
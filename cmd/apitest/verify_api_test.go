@@ -0,0 +1,93 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moov-io/ach"
+	moov "github.com/moov-io/go-client/client"
+)
+
+func TestVerifyAPI__transfersThroughAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verifyTransfersThroughAPI")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestACHFile(t, dir, ach.CheckingCredit)
+	file, err := parseACHFilepath(filepath.Join(dir, "merged.ach"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, events := "processed", []moov.Event{{ID: "event", Type: "TransferEvent"}}
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/ach/transfers/transfer":
+			json.NewEncoder(w).Encode(moov.Transfer{ID: "transfer", Status: status})
+		case "/v1/ach/transfers/transfer/events":
+			json.NewEncoder(w).Encode(events)
+		case "/v1/ach/transfers/transfer/files":
+			json.NewEncoder(w).Encode([]*ach.File{file})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer svc.Close()
+
+	conf := moov.NewConfiguration()
+	conf.BasePath = svc.URL
+	iter := testIteration()
+	iter.conf = conf
+	iter.api = moov.NewAPIClient(conf)
+	iter.userID = "userID"
+	ctx := context.Background()
+	statuses := strings.Split(*flagVerifyStatuses, ",")
+
+	if err := verifyTransfersThroughAPI(ctx, []*iteration{iter}, statuses, time.Second, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	// pending transfers haven't been merged yet, even though their file and creation event are served
+	status = "pending"
+	err = verifyTransfersThroughAPI(ctx, []*iteration{iter}, statuses, 0, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), `has status "pending"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// unexpected status
+	status = "failed"
+	err = verifyTransfersThroughAPI(ctx, []*iteration{iter}, statuses, 0, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), `has status "failed"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// missing events
+	status, events = "processed", nil
+	err = verifyTransfersThroughAPI(ctx, []*iteration{iter}, statuses, 0, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "has no events") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// the file's entry doesn't match
+	events = []moov.Event{{ID: "event"}}
+	iter.transfer.TransferType = "Pull"
+	err = verifyTransfersThroughAPI(ctx, []*iteration{iter}, statuses, 0, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), `- transactionCode: "27"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	flagVerifyRemoteAddress       = flag.String("verify-transfers.remote.address", "", "Verify the created transfers were uploaded to an FTP or SFTP server (e.g. sftp://localhost:2222)")
+	flagVerifyRemoteUsername      = flag.String("verify-transfers.remote.username", "", "Username for -verify-transfers.remote.address")
+	flagVerifyRemotePassword      = flag.String("verify-transfers.remote.password", "", "Password for -verify-transfers.remote.address")
+	flagVerifyRemotePath          = flag.String("verify-transfers.remote.path", "/", "Directory on the FTP or SFTP server paygate uploads merged files into")
+	flagVerifyRemoteHostPublicKey = flag.String("verify-transfers.remote.host-public-key", "", "Expected SSH host public key (authorized_keys format) of the SFTP server")
+)
+
+const remoteDialTimeout = 10 * time.Second
+
+// openRemoteSource connects to the FTP or SFTP server paygate uploads merged files to.
+func openRemoteSource(address, username, password, dir string) (mergedFileSource, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -verify-transfers.remote.address: %v", err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "ftp":
+		return openFTPSource(hostPort(u.Host, "21"), username, password, dir)
+	case "sftp":
+		return openSFTPSource(hostPort(u.Host, "22"), username, password, dir, *flagVerifyRemoteHostPublicKey)
+	default:
+		return nil, fmt.Errorf("unsupported -verify-transfers.remote.address %q, expected ftp:// or sftp://", address)
+	}
+}
+
+func hostPort(host, defaultPort string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, defaultPort)
+}
+
+// ftpSource reads merged files from an FTP server.
+type ftpSource struct {
+	address string
+	dir     string
+	conn    *ftp.ServerConn
+}
+
+func openFTPSource(address, username, password, dir string) (*ftpSource, error) {
+	conn, err := ftp.Dial(address, ftp.DialWithTimeout(remoteDialTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("problem connecting to %s: %v", address, err)
+	}
+	if err := conn.Login(username, password); err != nil {
+		conn.Quit()
+		return nil, fmt.Errorf("problem logging into %s: %v", address, err)
+	}
+	return &ftpSource{address: address, dir: dir, conn: conn}, nil
+}
+
+func (s *ftpSource) list() ([]sourceFile, error) {
+	var files []sourceFile
+	w := s.conn.Walk(s.dir)
+	for w.Next() {
+		if entry := w.Stat(); entry.Type == ftp.EntryTypeFile {
+			files = append(files, sourceFile{path: w.Path(), modTime: entry.Time, size: int64(entry.Size)})
+		}
+	}
+	return files, w.Err()
+}
+
+func (s *ftpSource) open(path string) (io.ReadCloser, error) {
+	return s.conn.Retr(path)
+}
+
+func (s *ftpSource) close() error {
+	return s.conn.Quit()
+}
+
+func (s *ftpSource) String() string {
+	return fmt.Sprintf("ftp://%s%s", s.address, path.Clean("/"+s.dir))
+}
+
+// sftpSource reads merged files from an SFTP server.
+type sftpSource struct {
+	address string
+	dir     string
+
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+func openSFTPSource(address, username, password, dir, hostPublicKey string) (*sftpSource, error) {
+	hostKeyCallback, err := sftpHostKeyCallback(hostPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            username,
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         remoteDialTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("problem connecting to %s: %v", address, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("problem starting SFTP session with %s: %v", address, err)
+	}
+	return &sftpSource{address: address, dir: dir, conn: conn, client: client}, nil
+}
+
+func sftpHostKeyCallback(hostPublicKey string) (ssh.HostKeyCallback, error) {
+	if hostPublicKey == "" {
+		log.Println("WARN: -verify-transfers.remote.host-public-key is empty, the SFTP server's host key won't be checked")
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostPublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid -verify-transfers.remote.host-public-key: %v", err)
+	}
+	return ssh.FixedHostKey(key), nil
+}
+
+func (s *sftpSource) list() ([]sourceFile, error) {
+	var files []sourceFile
+	w := s.client.Walk(s.dir)
+	for w.Step() {
+		if err := w.Err(); err != nil {
+			return nil, err
+		}
+		if info := w.Stat(); info.Mode().IsRegular() {
+			files = append(files, sourceFile{path: w.Path(), modTime: info.ModTime(), size: info.Size()})
+		}
+	}
+	return files, nil
+}
+
+func (s *sftpSource) open(path string) (io.ReadCloser, error) {
+	return s.client.Open(path)
+}
+
+func (s *sftpSource) close() error {
+	s.client.Close()
+	return s.conn.Close()
+}
+
+func (s *sftpSource) String() string {
+	return fmt.Sprintf("sftp://%s%s", s.address, path.Clean("/"+s.dir))
+}
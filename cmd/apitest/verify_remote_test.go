@@ -0,0 +1,149 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moov-io/ach"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// startSFTPServer serves the host's filesystem over SFTP to the "moov" user until the listener is closed.
+func startSFTPServer(t *testing.T) (net.Listener, ssh.PublicKey) {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "moov" && string(pass) == "secret" {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	conf.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(conn, conf)
+		}
+	}()
+	return ln, signer.PublicKey()
+}
+
+func serveSFTP(conn net.Conn, conf *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, conf)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func(in <-chan *ssh.Request) {
+			for req := range in {
+				req.Reply(req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp", nil)
+			}
+		}(requests)
+
+		server, err := sftp.NewServer(channel)
+		if err != nil {
+			return
+		}
+		server.Serve()
+		server.Close()
+	}
+}
+
+func TestVerifyRemote__sftp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verifyRemoteSFTP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestACHFile(t, dir, ach.CheckingCredit)
+
+	ln, hostKey := startSFTPServer(t)
+	defer ln.Close()
+
+	*flagVerifyRemoteHostPublicKey = string(ssh.MarshalAuthorizedKey(hostKey))
+	defer func() { *flagVerifyRemoteHostPublicKey = "" }()
+
+	address := "sftp://" + ln.Addr().String()
+	if _, err := openRemoteSource(address, "moov", "wrong", dir); err == nil {
+		t.Error("expected error")
+	}
+	src, err := openRemoteSource(address, "moov", "secret", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.close()
+
+	iter := testIteration()
+	if err := waitForMergedTransfers(src, []*iteration{iter}, time.Second, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := src.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].path != filepath.Join(dir, "merged.ach") {
+		t.Errorf("unexpected files: %#v", files)
+	}
+}
+
+func TestVerifyRemote__openRemoteSource(t *testing.T) {
+	if _, err := openRemoteSource("https://example.com", "", "", "/"); err == nil || !strings.Contains(err.Error(), "expected ftp:// or sftp://") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	*flagVerifyRemoteHostPublicKey = "invalid"
+	defer func() { *flagVerifyRemoteHostPublicKey = "" }()
+	if _, err := openRemoteSource("sftp://localhost", "", "", "/"); err == nil || !strings.Contains(err.Error(), "host-public-key") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestVerifyRemote__hostPort(t *testing.T) {
+	if v := hostPort("localhost", "22"); v != "localhost:22" {
+		t.Errorf("got %q", v)
+	}
+	if v := hostPort("localhost:2222", "22"); v != "localhost:2222" {
+		t.Errorf("got %q", v)
+	}
+}
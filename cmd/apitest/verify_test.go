@@ -11,6 +11,10 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/moov-io/ach"
+	moov "github.com/moov-io/go-client/client"
 )
 
 func TestVerify_verifyDirIsEmpty(t *testing.T) {
@@ -47,3 +51,186 @@ func TestVerify_verifyDirIsEmpty(t *testing.T) {
 		t.Error("empty dir should be empty")
 	}
 }
+
+func writeTestACHFile(t *testing.T, dir string, transactionCode int) {
+	t.Helper()
+
+	file := ach.NewFile()
+	file.Header = ach.NewFileHeader()
+	file.Header.ImmediateOrigin = "121042882"
+	file.Header.ImmediateOriginName = "Moov Bank"
+	file.Header.ImmediateDestination = "231380104"
+	file.Header.ImmediateDestinationName = "Moov Bank"
+	file.Header.FileCreationDate = time.Now().Format("060102")
+
+	bh := ach.NewBatchHeader()
+	bh.ServiceClassCode = ach.MixedDebitsAndCredits
+	bh.CompanyName = "Jane Corp"
+	bh.CompanyIdentification = "123456789"
+	bh.StandardEntryClassCode = ach.PPD
+	bh.CompanyEntryDescription = "TRANSFER"
+	bh.EffectiveEntryDate = time.Now().AddDate(0, 0, 1).Format("060102")
+	bh.ODFIIdentification = "12104288"
+
+	ed := ach.NewEntryDetail()
+	ed.TransactionCode = transactionCode
+	ed.SetRDFI("231380104")
+	ed.DFIAccountNumber = "987654321"
+	ed.Amount = 1234
+	ed.IdentificationNumber = "receiver"
+	ed.IndividualName = "John Doe"
+	ed.SetTraceNumber(bh.ODFIIdentification, 1)
+
+	batch, _ := ach.NewBatch(bh)
+	batch.AddEntry(ed)
+	if err := batch.Create(); err != nil {
+		t.Fatal(err)
+	}
+	file.AddBatch(batch)
+	if err := file.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	fd, err := os.Create(filepath.Join(dir, "merged.ach"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	if err := ach.NewWriter(fd).Write(file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testIteration returns an iteration whose push transfer matches the entry written by writeTestACHFile.
+func testIteration() *iteration {
+	return &iteration{
+		originatorDepository: moov.Depository{RoutingNumber: "121042882"},
+		receiverDepository:   moov.Depository{RoutingNumber: "231380104", AccountNumber: "987654321", Holder: "John Doe", Type: "Checking"},
+		transfer: moov.Transfer{
+			ID:                     "transfer",
+			TransferType:           "Push",
+			Amount:                 "USD 12.34",
+			StandardEntryClassCode: "PPD",
+			Created:                time.Now(),
+		},
+	}
+}
+
+func TestVerify__transfersWereMerged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transfersWereMerged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	iter := testIteration()
+
+	// a zero timeout checks the files once
+	writeTestACHFile(t, dir, ach.CheckingCredit)
+	if err := waitForMergedTransfers(localDir(dir), []*iteration{iter}, 0, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	// a debit doesn't match our push transfer
+	writeTestACHFile(t, dir, ach.CheckingDebit)
+	err = waitForMergedTransfers(localDir(dir), []*iteration{iter}, 0, time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), `- transactionCode: "22"`) || !strings.Contains(err.Error(), `+ transactionCode: "27"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// each entry only matches one transfer
+	other := *iter
+	other.transfer.TransferType = "Pull"
+	err = waitForMergedTransfers(localDir(dir), []*iteration{&other, &other}, 0, time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "transfer (amount: USD 12.34) not found") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// transfers without any entry of their amount
+	other.transfer.Amount = "USD 1.00"
+	err = waitForMergedTransfers(localDir(dir), []*iteration{&other}, 0, time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "transfer (amount: USD 1.00) not found") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestVerify__waitForMergedTransfers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "waitForMergedTransfers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	iter := testIteration()
+
+	// nothing is merged before the timeout
+	err = waitForMergedTransfers(localDir(dir), []*iteration{iter}, 50*time.Millisecond, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "transfer (amount: USD 12.34) not found") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// a partially written file is read again once it's complete
+	path := filepath.Join(dir, "merged.ach")
+	if err := ioutil.WriteFile(path, []byte("101"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	complete, err := ioutil.TempDir("", "waitForMergedTransfers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(complete)
+	writeTestACHFile(t, complete, ach.CheckingCredit)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.Rename(filepath.Join(complete, "merged.ach"), path)
+	}()
+	if err := waitForMergedTransfers(localDir(dir), []*iteration{iter}, 5*time.Second, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify__mergedFileWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mergedFileWatcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := newMergedFileWatcher(localDir(dir))
+	if err := w.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(w.entries()); n != 0 {
+		t.Errorf("unexpected %d entries", n)
+	}
+
+	writeTestACHFile(t, dir, ach.CheckingCredit)
+	if err := w.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(w.entries()); n != 1 {
+		t.Errorf("unexpected %d entries", n)
+	}
+
+	// removed files are forgotten
+	if err := os.Remove(filepath.Join(dir, "merged.ach")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(w.files); n != 0 {
+		t.Errorf("unexpected %d files", n)
+	}
+}
+
+func TestVerify__withTransfers(t *testing.T) {
+	push := &iteration{transfer: moov.Transfer{ID: "transfer"}}
+	iterations := []*iteration{{}, push, {}}
+	if out := withTransfers(iterations); len(out) != 1 || out[0] != push {
+		t.Errorf("unexpected iterations: %#v", out)
+	}
+	if out := withTransfers(nil); len(out) != 0 {
+		t.Errorf("unexpected iterations: %#v", out)
+	}
+}
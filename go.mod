@@ -4,11 +4,16 @@ require (
 	github.com/antihax/optional v1.0.0
 	github.com/docker/docker v1.13.1
 	github.com/go-kit/kit v0.10.0
+	github.com/jlaffaye/ftp v0.0.0-20200422224957-b9f3ade29122
 	github.com/moov-io/ach v1.3.1
 	github.com/moov-io/base v0.11.1-0.20200130212608-140496be02c3
 	github.com/moov-io/go-client v0.3.1-0.20191202144850-b9cf06046bc8
+	github.com/pkg/sftp v1.11.0
 	github.com/prometheus/client_golang v1.5.1
+	github.com/prometheus/client_model v0.2.0
 	go4.org v0.0.0-20200312051459-7028f7b4a332
+	golang.org/x/crypto v0.0.0-20200302210943-78000ba7a073
+	gopkg.in/yaml.v2 v2.2.8
 )
 
 go 1.13